@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/processimage"
+)
+
+// Status of a write
+const (
+	// StatusAcknowledged the slave answered with a response
+	StatusAcknowledged = "acknowledged"
+	// StatusException the slave answered with an exception
+	StatusException = "exception"
+	// StatusTimeout the slave did not answer
+	StatusTimeout = "timeout"
+	// StatusBroadcast written to all slaves (address 0), which do not answer
+	StatusBroadcast = "broadcast"
+)
+
+// Record a write to a slave: FC5, FC6, FC15, FC16, FC22 or FC23 request, and its outcome
+type Record struct {
+	// Time of the request
+	Time time.Time `json:"time"`
+	// Port the request was read from, the master's in duplex
+	Port         string          `json:"port"`
+	Slave        uint32          `json:"slave"`
+	FunctionCode uint32          `json:"functionCode"`
+	Table        dissector.Table `json:"table"`
+	// Start first coil/register written
+	Start    uint32 `json:"start"`
+	Quantity uint32 `json:"quantity"`
+
+	// Old values before the write, as last seen on the bus, null if unknown
+	Old []*uint32 `json:"old"`
+	// New values written, 0 or 1 for coils. Of mask writes (FC22), null if the old value is unknown.
+	New []*uint32 `json:"new"`
+	// AndMask and OrMask of mask writes (FC22)
+	AndMask *uint32 `json:"andMask,omitempty"`
+	OrMask  *uint32 `json:"orMask,omitempty"`
+
+	Status        string `json:"status"`
+	ExceptionCode uint32 `json:"exceptionCode,omitempty"`
+}
+
+// NewRecord creates the record of a write request req, answered by rsp (nil if not answered), with old values from
+// image, before it is updated with the write. Returns nil if req is not a write.
+func NewRecord(req *dissector.Result, rsp *dissector.Result, image *processimage.ProcessImage) *Record {
+	adu := req.GetAdu()
+	pdu := adu.GetPduRequest()
+	if !adu.IsRequest() || !pdu.IsWrite() {
+		return nil
+	}
+	r := &Record{
+		Time:         adu.GetTimeTime(),
+		Port:         req.GetPort(),
+		Slave:        adu.GetAddress(),
+		FunctionCode: pdu.GetFunctionCode(),
+		Table:        dissector.TableOf(pdu.GetFunctionCode()),
+	}
+	r.Start, r.Quantity = pdu.WriteRange()
+
+	for _, p := range image.Get(r.Slave, r.Table, r.Start, r.Quantity) {
+		var old *uint32
+		if p.Known() {
+			v := p.Value
+			old = &v
+		}
+		r.Old = append(r.Old, old)
+	}
+	if and, or, ok := pdu.WriteMasks(); ok {
+		r.AndMask, r.OrMask = &and, &or
+		var v *uint32
+		if len(r.Old) == 1 && r.Old[0] != nil {
+			n := *r.Old[0]&and | or&^and
+			v = &n
+		}
+		r.New = []*uint32{v}
+	} else {
+		for _, v := range pdu.WriteValues() {
+			n := v
+			r.New = append(r.New, &n)
+		}
+	}
+
+	switch a := rsp.GetAdu(); {
+	case a != nil && a.IsResponse():
+		r.Status = StatusAcknowledged
+	case a != nil && a.IsException():
+		r.Status = StatusException
+		r.ExceptionCode = a.GetPduResponseException().GetExceptionCode()
+	case r.Slave == 0:
+		r.Status = StatusBroadcast
+	default:
+		r.Status = StatusTimeout
+	}
+	return r
+}
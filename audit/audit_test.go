@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/processimage"
+	"github.com/andreaaizza/sniffer/util"
+)
+
+func TestAudit(t *testing.T) {
+	frames := [][]byte{
+		{0x02, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC4, 0x38}, // read 0-1
+		{0x02, 0x03, 0x04, 0x00, 0x01, 0x00, 0x02, 0x19, 0x32},
+		{0x02, 0x10, 0x00, 0x00, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02, 0x2C, 0xEA}, // write 0-1
+		{0x02, 0x10, 0x00, 0x00, 0x00, 0x02, 0x41, 0xFB},
+		{0x02, 0x06, 0x00, 0x01, 0x12, 0x34, 0xD5, 0x4E}, // write 1, echoed
+		{0x02, 0x06, 0x00, 0x01, 0x12, 0x34, 0xD5, 0x4E},
+		{0x02, 0x16, 0x00, 0x00, 0x00, 0xF2, 0x00, 0x25, 0xD6, 0x3B}, // mask write 0, echoed
+		{0x02, 0x16, 0x00, 0x00, 0x00, 0xF2, 0x00, 0x25, 0xD6, 0x3B},
+		{0x02, 0x17, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x01, 0x02, 0x00, 0xAA, 0xD0, 0xC3}, // write 1, read 0
+		{0x02, 0x17, 0x02, 0x00, 0x05, 0x39, 0xB7},
+		{0x02, 0x05, 0x00, 0x10, 0xFF, 0x00, 0x8D, 0xCC},                               // write coil 16, not answered
+		{0x02, 0x10, 0x00, 0x00, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02, 0x2C, 0xEA}, // write 0-1, exception
+		{0x02, 0x90, 0x02, 0x3D, 0xC1},
+		{0x00, 0x06, 0x00, 0x01, 0x00, 0x07, 0x98, 0x19}, // broadcast write 1
+		// an exception is dissected only when followed by enough bytes
+		{0x02, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC4, 0x38},
+	}
+	t0 := time.Date(2020, 9, 14, 8, 45, 54, 0, time.UTC)
+	var dus []*logger.DataUnit
+	for i, f := range frames {
+		ts := util.TimestampBuilder(t0.Add(time.Duration(i) * 100 * time.Millisecond))
+		dus = append(dus, &logger.DataUnit{Time: &ts, Data: f})
+	}
+	results, _ := dissector.Dissect(dus, "port", dissector.FilterAnyModbus{})
+	if len(results) != len(frames) {
+		t.Fatalf("got %d ADUs, want %d", len(results), len(frames))
+	}
+
+	// a request is answered by the next ADU, if a response
+	var b bytes.Buffer
+	w := NewCSVWriter(&b, true)
+	image := processimage.New()
+	for i, req := range results {
+		if !req.GetAdu().IsRequest() {
+			continue
+		}
+		var rsp *dissector.Result
+		if i+1 < len(results) && !results[i+1].GetAdu().IsRequest() {
+			rsp = results[i+1]
+		}
+		if r := NewRecord(req, rsp, image); r != nil {
+			if err := w.Write(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if rsp != nil {
+			image.Update(req.GetAdu(), rsp.GetAdu())
+		}
+	}
+
+	want := []string{
+		strings.Join(CSVColumns, ","),
+		"2020-09-14T08:45:54.2Z,port,2,16,holdingRegisters,0,2,1;2,1;2,,,acknowledged,",
+		"2020-09-14T08:45:54.4Z,port,2,6,holdingRegisters,1,1,2,4660,,,acknowledged,",
+		"2020-09-14T08:45:54.6Z,port,2,22,holdingRegisters,0,1,1,5,242,37,acknowledged,",
+		"2020-09-14T08:45:54.8Z,port,2,23,holdingRegisters,1,1,4660,170,,,acknowledged,",
+		"2020-09-14T08:45:55Z,port,2,5,coils,16,1,,1,,,timeout,",
+		"2020-09-14T08:45:55.1Z,port,2,16,holdingRegisters,0,2,5;170,1;2,,,exception,2",
+		"2020-09-14T08:45:55.3Z,port,0,6,holdingRegisters,1,1,,7,,,broadcast,",
+	}
+	got := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), b.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %s, want %s", got[i], want[i])
+		}
+	}
+	if p := image.Get(2, dissector.TableHoldingRegisters, 0, 2); p[0].Value != 5 || p[1].Value != 170 {
+		t.Errorf("got registers %d, %d, want 5, 170", p[0].Value, p[1].Value)
+	}
+}
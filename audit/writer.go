@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Writer appends records to an audit log
+type Writer interface {
+	Write(r *Record) error
+}
+
+// JSONWriter writes records as JSON lines
+type JSONWriter struct {
+	mux sync.Mutex
+	w   io.Writer
+}
+
+// NewJSONWriter creates a writer of JSON lines to w
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{w: w}
+}
+
+// Write writes r as a line, with a single write to the underlying writer
+func (j *JSONWriter) Write(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
+
+// CSVColumns header of CSV audit logs. Values of a record are separated by ;, unknown ones are empty.
+var CSVColumns = []string{"time", "port", "slave", "functionCode", "table", "start", "quantity", "old", "new",
+	"andMask", "orMask", "status", "exceptionCode"}
+
+// CSVWriter writes records as CSV rows
+type CSVWriter struct {
+	mux    sync.Mutex
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVWriter creates a writer of CSV rows to w, starting with the CSVColumns header if header is true, e.g.
+// when w is a new file
+func NewCSVWriter(w io.Writer, header bool) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w), header: header}
+}
+
+// Write writes r as a row, flushed to the underlying writer
+func (c *CSVWriter) Write(r *Record) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.header {
+		if err := c.w.Write(CSVColumns); err != nil {
+			return err
+		}
+		c.header = false
+	}
+	number := func(n uint32) string { return strconv.FormatUint(uint64(n), 10) }
+	values := func(vs []*uint32) string {
+		s := make([]string, len(vs))
+		for i, v := range vs {
+			if v != nil {
+				s[i] = number(*v)
+			}
+		}
+		return strings.Join(s, ";")
+	}
+	exception := ""
+	if r.Status == StatusException {
+		exception = number(r.ExceptionCode)
+	}
+	err := c.w.Write([]string{
+		r.Time.Format(time.RFC3339Nano),
+		r.Port,
+		number(r.Slave),
+		number(r.FunctionCode),
+		r.Table.String(),
+		number(r.Start),
+		number(r.Quantity),
+		values(r.Old),
+		values(r.New),
+		values([]*uint32{r.AndMask}),
+		values([]*uint32{r.OrMask}),
+		r.Status,
+		exception,
+	})
+	if err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,124 @@
+package baseline
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/andreaaizza/sniffer/dissector"
+)
+
+// Baseline normal traffic learned over a training window: transactions with their poll period, latency and
+// exceptions, and the range of values of registers, coils and inputs
+type Baseline struct {
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	Transactions []*Transaction `json:"transactions"`
+	Values       []*ValueRange  `json:"values"`
+}
+
+// Key a transaction: a request to a slave, function code and range
+type Key struct {
+	Slave        uint32 `json:"slave"`
+	FunctionCode uint32 `json:"functionCode"`
+	Start        uint32 `json:"start"`
+	Quantity     uint32 `json:"quantity"`
+}
+
+// Transaction what is normal for a request
+type Transaction struct {
+	Key
+	Count      uint64 `json:"count"`
+	Exceptions uint64 `json:"exceptions"`
+	// Period between requests [seconds]
+	Period Stats `json:"period"`
+	// Latency of responses/exceptions [seconds]
+	Latency Stats `json:"latency"`
+}
+
+// ValueRange values a coil, input or register had
+type ValueRange struct {
+	Slave   uint32          `json:"slave"`
+	Table   dissector.Table `json:"table"`
+	Address uint32          `json:"address"`
+	Min     uint32          `json:"min"`
+	Max     uint32          `json:"max"`
+}
+
+// Stats of samples
+type Stats struct {
+	Count  uint64  `json:"count"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stdDev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+
+	// m2 sum of squared differences from the mean
+	m2 float64
+}
+
+// add adds a sample (Welford)
+func (s *Stats) add(x float64) {
+	s.Count++
+	if s.Count == 1 || x < s.Min {
+		s.Min = x
+	}
+	if s.Count == 1 || x > s.Max {
+		s.Max = x
+	}
+	d := x - s.Mean
+	s.Mean += d / float64(s.Count)
+	s.m2 += d * (x - s.Mean)
+	s.StdDev = math.Sqrt(s.m2 / float64(s.Count))
+}
+
+// Load loads a baseline saved as JSON
+func Load(path string) (*Baseline, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bl := &Baseline{}
+	if err = json.Unmarshal(b, bl); err != nil {
+		return nil, err
+	}
+	return bl, nil
+}
+
+// Save saves the baseline as JSON
+func (b *Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// sort sorts transactions and values, for stable output
+func (b *Baseline) sort() {
+	sort.Slice(b.Transactions, func(i, j int) bool { return b.Transactions[i].Key.less(b.Transactions[j].Key) })
+	sort.Slice(b.Values, func(i, j int) bool {
+		x, y := b.Values[i], b.Values[j]
+		switch {
+		case x.Slave != y.Slave:
+			return x.Slave < y.Slave
+		case x.Table != y.Table:
+			return x.Table < y.Table
+		}
+		return x.Address < y.Address
+	})
+}
+
+func (k Key) less(o Key) bool {
+	switch {
+	case k.Slave != o.Slave:
+		return k.Slave < o.Slave
+	case k.FunctionCode != o.FunctionCode:
+		return k.FunctionCode < o.FunctionCode
+	case k.Start != o.Start:
+		return k.Start < o.Start
+	}
+	return k.Quantity < o.Quantity
+}
@@ -0,0 +1,79 @@
+package baseline
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+)
+
+func TestDetector(t *testing.T) {
+	req3 := []byte{0x02, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC4, 0x38}
+	req3b := sniffertest.ReadHolding
+	rsp3 := sniffertest.ReadHoldingResponse
+	rsp3b := []byte{0x02, 0x03, 0x04, 0x00, 0x01, 0x00, 0x03, 0xD8, 0xF2}
+
+	// request every second, response after 20ms
+	result := func(at time.Duration, req, rsp []byte) *sniffer.Result {
+		frames := sniffertest.Every(20*time.Millisecond, req, rsp, req)
+		frames[0].After = at
+		results := sniffertest.Dissect(t, "port", frames)
+		return &sniffer.Result{Request: results[0], Response: results[1]}
+	}
+
+	var learned *Baseline
+	d := New(nil, Options{TrainSeconds: 10, OnLearned: func(b *Baseline) { learned = b }})
+	for i := 0; i < 10; i++ {
+		if a := d.Add(result(time.Duration(i)*time.Second, req3, rsp3)); len(a) != 0 {
+			t.Fatalf("got anomalies while learning: %v", a)
+		}
+	}
+	if !d.Learning() {
+		t.Fatal("got learned before the end of the training window")
+	}
+
+	for i, tc := range []struct {
+		at       time.Duration
+		req, rsp []byte
+		kinds    []string
+	}{
+		{10 * time.Second, req3, rsp3, nil},
+		{11 * time.Second, req3, rsp3b, []string{KindValue}},
+		{15 * time.Second, req3, rsp3, []string{KindRate}},
+		{15500 * time.Millisecond, req3b, rsp3, []string{KindUnknownTransaction}},
+		// reported once within Holdoff
+		{16 * time.Second, req3, rsp3b, nil},
+	} {
+		anomalies := d.Add(result(tc.at, tc.req, tc.rsp))
+		if len(anomalies) != len(tc.kinds) {
+			t.Errorf("result %d: got %d anomalies, want %v", i, len(anomalies), tc.kinds)
+			continue
+		}
+		for j, a := range anomalies {
+			if a.Kind != tc.kinds[j] {
+				t.Errorf("result %d: got %s, want %s", i, a.PrettyString(), tc.kinds[j])
+			}
+		}
+	}
+
+	if learned == nil || len(learned.Transactions) != 1 || learned.Transactions[0].Period.Mean != 1 || len(learned.Values) != 2 {
+		t.Fatalf("got baseline %+v, want 1 transaction every 1s, 2 values", learned)
+	}
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := learned.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = New(loaded, Options{})
+	if d.Learning() {
+		t.Error("got learning with a baseline")
+	}
+	if a := d.Add(result(0, req3, rsp3b)); len(a) != 1 || a[0].Kind != KindValue {
+		t.Errorf("got %d anomalies with the loaded baseline, want a value one", len(a))
+	}
+}
@@ -0,0 +1,282 @@
+package baseline
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/processimage"
+)
+
+const (
+	// TrainSecondsDefault training window when no baseline is given
+	TrainSecondsDefault = 600
+	// ValueMarginDefault values are out of range when beyond the range learned by more than this share of it
+	ValueMarginDefault = 0.1
+	// LatencySigmasDefault latencies are anomalous when more than this many standard deviations above the mean
+	LatencySigmasDefault = 4
+	// RateFactorDefault periods are anomalous when this many times shorter or longer than the mean
+	RateFactorDefault = 2
+	// HoldoffDefault an anomaly of the same kind and transaction or point is reported at most once in this time
+	HoldoffDefault = time.Minute
+
+	// latencyMinStdDev floor of the standard deviation of latencies, so constant ones do not make any jitter anomalous
+	latencyMinStdDev = 0.002
+)
+
+// Kinds of anomalies
+const (
+	KindUnknownTransaction = "unknownTransaction"
+	KindRate               = "rate"
+	KindLatency            = "latency"
+	KindValue              = "value"
+	KindException          = "exception"
+)
+
+// Anomaly a deviation from the baseline
+type Anomaly struct {
+	Time time.Time `json:"time"`
+	Port string    `json:"port"`
+	Key
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+}
+
+func (a *Anomaly) PrettyString() string {
+	return fmt.Sprintf("ANOMALY %s [%s] %02X FC%d %d+%d: %s", a.Kind, a.Time.Format(time.RFC3339Nano),
+		a.Slave, a.FunctionCode, a.Start, a.Quantity, a.Description)
+}
+
+// Options of a Detector. Zero values are replaced by defaults.
+type Options struct {
+	// TrainSeconds training window, from the first result, when no baseline is given
+	TrainSeconds float64
+	// ValueMargin, LatencySigmas, RateFactor, Holdoff see the defaults
+	ValueMargin   float64
+	LatencySigmas float64
+	RateFactor    float64
+	Holdoff       time.Duration
+	// OnLearned is called with the baseline at the end of training, e.g. to save it
+	OnLearned func(*Baseline)
+}
+
+type valueKey struct {
+	slave   uint32
+	table   dissector.Table
+	address uint32
+}
+
+type holdoffKey struct {
+	kind string
+	key  Key
+	vk   valueKey
+}
+
+// Detector learns a baseline of matched results, then flags results deviating from it. All methods are safe for
+// concurrent use.
+type Detector struct {
+	opts Options
+
+	mux      sync.Mutex
+	baseline *Baseline
+	learning bool
+
+	transactions map[Key]*Transaction
+	values       map[valueKey]*ValueRange
+	// last request time of transactions
+	last map[Key]time.Time
+	// last report of anomalies
+	reported map[holdoffKey]time.Time
+	// image of values read and written
+	image *processimage.ProcessImage
+}
+
+// New creates a detector flagging deviations from b. If b is nil, it first learns a baseline for
+// opts.TrainSeconds.
+func New(b *Baseline, opts Options) *Detector {
+	if opts.TrainSeconds <= 0 {
+		opts.TrainSeconds = TrainSecondsDefault
+	}
+	if opts.ValueMargin <= 0 {
+		opts.ValueMargin = ValueMarginDefault
+	}
+	if opts.LatencySigmas <= 0 {
+		opts.LatencySigmas = LatencySigmasDefault
+	}
+	if opts.RateFactor <= 1 {
+		opts.RateFactor = RateFactorDefault
+	}
+	if opts.Holdoff <= 0 {
+		opts.Holdoff = HoldoffDefault
+	}
+	d := &Detector{
+		opts:         opts,
+		baseline:     b,
+		learning:     b == nil,
+		transactions: make(map[Key]*Transaction),
+		values:       make(map[valueKey]*ValueRange),
+		last:         make(map[Key]time.Time),
+		reported:     make(map[holdoffKey]time.Time),
+		image:        processimage.New(),
+	}
+	if b == nil {
+		d.baseline = &Baseline{}
+	}
+	for _, t := range d.baseline.Transactions {
+		d.transactions[t.Key] = t
+	}
+	for _, v := range d.baseline.Values {
+		d.values[valueKey{v.Slave, v.Table, v.Address}] = v
+	}
+	return d
+}
+
+// Learning returns true while the baseline is being learned
+func (d *Detector) Learning() bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.learning
+}
+
+// Baseline returns the baseline, being learned or learned
+func (d *Detector) Baseline() *Baseline {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.baseline
+}
+
+// Add learns r while training, then returns the anomalies of r. Use as Sniffer.OnResult() callback.
+func (d *Detector) Add(r *sniffer.Result) (anomalies []*Anomaly) {
+	req, rsp := r.GetRequest().GetAdu(), r.GetResponse().GetAdu()
+	pdu := req.GetPduRequest()
+	k := Key{Slave: req.GetAddress(), FunctionCode: pdu.GetFunctionCode(), Start: pdu.StartAddress(), Quantity: pdu.Quantity()}
+	t := req.GetTimeTime()
+	latency := r.Latency().Seconds()
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.learning {
+		if d.baseline.Start.IsZero() {
+			d.baseline.Start = t
+		}
+		if t.Sub(d.baseline.Start).Seconds() < d.opts.TrainSeconds {
+			d.learn(k, t, latency, req, rsp)
+			return nil
+		}
+		d.baseline.End = t
+		d.baseline.sort()
+		d.learning = false
+		if d.opts.OnLearned != nil {
+			d.opts.OnLearned(d.baseline)
+		}
+	}
+
+	report := func(kind string, vk valueKey, format string, a ...interface{}) {
+		hk := holdoffKey{kind: kind, key: k, vk: vk}
+		if last, ok := d.reported[hk]; ok && t.Sub(last) < d.opts.Holdoff {
+			return
+		}
+		d.reported[hk] = t
+		anomalies = append(anomalies, &Anomaly{Time: t, Port: r.GetRequest().GetPort(), Key: k, Kind: kind,
+			Description: fmt.Sprintf(format, a...)})
+	}
+
+	tr, ok := d.transactions[k]
+	if !ok {
+		report(KindUnknownTransaction, valueKey{}, "request not seen while training")
+	} else {
+		if last, ok := d.last[k]; ok && tr.Period.Count > 0 && tr.Period.Mean > 0 {
+			p := t.Sub(last).Seconds()
+			if p > tr.Period.Mean*d.opts.RateFactor || p < tr.Period.Mean/d.opts.RateFactor {
+				report(KindRate, valueKey{}, "period %.3fs, normal %.3fs", p, tr.Period.Mean)
+			}
+		}
+		if rsp.IsException() && tr.Exceptions == 0 {
+			report(KindException, valueKey{}, "exception %02X, never seen while training",
+				rsp.GetPduResponseException().GetExceptionCode())
+		}
+		if tr.Latency.Count > 0 {
+			limit := tr.Latency.Mean + d.opts.LatencySigmas*math.Max(tr.Latency.StdDev, latencyMinStdDev)
+			if latency > limit {
+				report(KindLatency, valueKey{}, "latency %.3fs, normal %.3fs ± %.3fs", latency, tr.Latency.Mean, tr.Latency.StdDev)
+			}
+		}
+	}
+	d.last[k] = t
+
+	for _, p := range d.update(req, rsp) {
+		vk := valueKey{p.Slave, p.Table, p.Address}
+		vr, ok := d.values[vk]
+		if !ok {
+			continue
+		}
+		margin := d.opts.ValueMargin * float64(vr.Max-vr.Min)
+		if float64(p.Value) < float64(vr.Min)-margin || float64(p.Value) > float64(vr.Max)+margin {
+			report(KindValue, vk, "%s %d value %d, normal %d..%d", p.Table, p.Address, p.Value, vr.Min, vr.Max)
+		}
+	}
+	return
+}
+
+// learn adds a transaction to the baseline
+func (d *Detector) learn(k Key, t time.Time, latency float64, req *dissector.ADU, rsp *dissector.ADU) {
+	tr, ok := d.transactions[k]
+	if !ok {
+		tr = &Transaction{Key: k}
+		d.transactions[k] = tr
+		d.baseline.Transactions = append(d.baseline.Transactions, tr)
+	}
+	tr.Count++
+	if rsp.IsException() {
+		tr.Exceptions++
+	}
+	tr.Latency.add(latency)
+	if last, ok := d.last[k]; ok {
+		tr.Period.add(t.Sub(last).Seconds())
+	}
+	d.last[k] = t
+
+	for _, p := range d.update(req, rsp) {
+		vk := valueKey{p.Slave, p.Table, p.Address}
+		vr, ok := d.values[vk]
+		if !ok {
+			vr = &ValueRange{Slave: p.Slave, Table: p.Table, Address: p.Address, Min: p.Value, Max: p.Value}
+			d.values[vk] = vr
+			d.baseline.Values = append(d.baseline.Values, vr)
+		}
+		if p.Value < vr.Min {
+			vr.Min = p.Value
+		}
+		if p.Value > vr.Max {
+			vr.Max = p.Value
+		}
+	}
+}
+
+// update returns the points read or written by a request and its response
+func (d *Detector) update(req *dissector.ADU, rsp *dissector.ADU) (points []processimage.Point) {
+	d.image.Update(req, rsp)
+	if !rsp.IsResponse() {
+		return nil
+	}
+	pdu := req.GetPduRequest()
+	table := dissector.TableOf(pdu.GetFunctionCode())
+	if pdu.GetFunctionCode() <= 4 || pdu.GetFunctionCode() == 23 {
+		points = append(points, d.image.Get(req.GetAddress(), table, pdu.StartAddress(), pdu.Quantity())...)
+	}
+	if start, quantity := pdu.WriteRange(); quantity > 0 {
+		points = append(points, d.image.Get(req.GetAddress(), table, start, quantity)...)
+	}
+	// points not known, e.g. masks written to unknown registers
+	known := points[:0]
+	for _, p := range points {
+		if p.Known() {
+			known = append(known, p)
+		}
+	}
+	return known
+}
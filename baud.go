@@ -0,0 +1,228 @@
+package sniffer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/util"
+)
+
+// ScanSpeeds speeds ranked by EstimateSpeeds: ModbusSpeeds and 230400. Others are ranked as the nearest of
+// logger.Speeds, as ports cannot be opened at them.
+var ScanSpeeds = append(append([]int{}, ModbusSpeeds...), 230400)
+
+// scanProbeSpeeds speeds data is read at to estimate the line speed
+var scanProbeSpeeds = []int{230400, 38400, 4800}
+
+const (
+	// ScanProbeSecondsDefault read at each probe speed for up to this time [seconds]
+	ScanProbeSecondsDefault = 2
+
+	// estimateMaxBitWidth a speed is estimated at the fastest probe speed at most this many times faster:
+	// longer bits do not fit in the 10 bits of a byte read
+	estimateMaxBitWidth = 8
+	// estimateProbeBytes bytes read at a probe speed which are enough to estimate
+	estimateProbeBytes = 1024
+	// estimateMinRuns bit runs needed to score a speed
+	estimateMinRuns = 20
+	// estimateFit share of bit runs which must fit a speed
+	estimateFit = 0.9
+	// estimateSingleRuns share of single bit runs needed for the line to be as fast as the probe
+	estimateSingleRuns = 0.2
+	// estimateRateWindow window to measure bytes per second read at a probe speed
+	estimateRateWindow = time.Second
+)
+
+// SpeedEstimate how likely a line speed is
+type SpeedEstimate struct {
+	Speed int `json:"speed"`
+	// Probe speed data was read at to score Speed, 0 if none
+	Probe int `json:"probe"`
+	// Score share of bit runs read at Probe speed with a length fitting Speed [0..1]
+	Score float64 `json:"score"`
+	// Runs number of bit runs scored
+	Runs int `json:"runs"`
+	// Fits if Score is high enough for Speed to be likely
+	Fits bool `json:"fits"`
+	// Rejected if more bytes per second were read at Probe speed than a line at Speed can produce
+	Rejected bool `json:"rejected"`
+}
+
+func (e *SpeedEstimate) PrettyString() string {
+	return fmt.Sprintf("speed: %d, probe: %d, score: %.2f, runs: %d, fits: %v, rejected: %v",
+		e.Speed, e.Probe, e.Score, e.Runs, e.Fits, e.Rejected)
+}
+
+// EstimateSpeeds reads conf ports at each probe speed for up to seconds, and ranks ScanSpeeds, most likely first.
+//
+// A line read faster than its speed shows each of its bits as a run of equal bits, as long as the ratio of
+// the speeds: speeds are scored by how well the length of runs within bytes read fit. Of the speeds which fit,
+// the slowest is the most likely, as runs also fit any speed whose bits are a fraction of the line ones.
+// Speeds which cannot produce as many bytes per second (a byte read needs a falling edge on the line) are
+// rejected. The probe speed itself is scored by framing errors instead.
+func EstimateSpeeds(ctx context.Context, conf Config, seconds int, debug bool) (estimates []SpeedEstimate, err error) {
+	probes := make(map[int][][]*logger.DataUnit)
+	marked := make(map[int]bool)
+	for _, p := range scanProbeSpeeds {
+		if debug {
+			log.Printf("Probing %s at %d", conf.portNames(), p)
+		}
+		probes[p], err = capture(ctx, conf, p, "8N1", true, seconds, debug,
+			func(captures [][]*logger.DataUnit, m bool) bool {
+				marked[p] = m
+				n := 0
+				for _, dus := range captures {
+					for _, du := range dus {
+						n += len(du.GetData())
+					}
+				}
+				return n >= estimateProbeBytes
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rankSpeeds(openSpeeds(ScanSpeeds), probes, marked), nil
+}
+
+// openSpeeds returns speeds as the nearest a port can be opened at, once each
+func openSpeeds(speeds []int) (open []int) {
+	seen := make(map[int]bool)
+	for _, s := range speeds {
+		if s = logger.NearestSpeed(s); !seen[s] {
+			seen[s] = true
+			open = append(open, s)
+		}
+	}
+	return
+}
+
+// rankSpeeds scores speeds with data read at probe speeds, and sorts them most likely first
+func rankSpeeds(speeds []int, probes map[int][][]*logger.DataUnit, marked map[int]bool) (estimates []SpeedEstimate) {
+	for _, speed := range speeds {
+		e := SpeedEstimate{Speed: speed}
+
+		// fastest probe, not too fast
+		for p := range probes {
+			if p >= speed && p <= speed*estimateMaxBitWidth && p > e.Probe {
+				e.Probe = p
+			}
+		}
+		if e.Probe > 0 {
+			captures := probes[e.Probe]
+			runs, singles := bitRuns(captures, marked[e.Probe])
+			e.Runs = len(runs)
+
+			if e.Probe == speed {
+				// most runs would be single bits, bytes read are consistent with a parity, or without errors
+				total, even, odd, high := parityCounts(captures, 8)
+				if total > 0 && float64(singles) >= estimateSingleRuns*float64(len(runs)) {
+					e.Score = 1
+					if marked[e.Probe] {
+						e.Score = math.Max(math.Max(float64(even), float64(odd)), float64(high)) / float64(total)
+					}
+				}
+			} else {
+				e.Score = fitRuns(runs, float64(e.Probe)/float64(speed))
+			}
+			if e.Runs < estimateMinRuns {
+				e.Score = 0
+			}
+			e.Rejected = bytesPerSecond(captures) > float64(speed)/2
+			e.Fits = !e.Rejected && e.Score >= estimateFit
+		}
+		estimates = append(estimates, e)
+	}
+
+	sort.SliceStable(estimates, func(i, j int) bool {
+		a, b := &estimates[i], &estimates[j]
+		switch {
+		case a.Fits != b.Fits:
+			return a.Fits
+		case a.Fits:
+			return a.Speed < b.Speed
+		case a.Rejected != b.Rejected:
+			return !a.Rejected
+		}
+		return a.Score > b.Score
+	})
+	return
+}
+
+// bitRuns returns the length of runs of equal bits within bytes read, from the start bit, and how many are single
+// bits. Runs truncated by the end of the byte are not returned. The stop bit is known only if errors were marked.
+func bitRuns(captures [][]*logger.DataUnit, marked bool) (runs []int, singles int) {
+	for _, dus := range captures {
+		for _, du := range dus {
+			errs := make(map[uint32]bool)
+			for _, e := range du.GetFramingErrors() {
+				errs[e] = true
+			}
+			for i, b := range du.GetData() {
+				// start bit, data bits LSB first, stop bit
+				line := []byte{0}
+				for j := 0; j < 8; j++ {
+					line = append(line, b>>j&1)
+				}
+				if marked {
+					if errs[uint32(i)] {
+						line = append(line, 0)
+					} else {
+						line = append(line, 1)
+					}
+				}
+
+				run := 1
+				for j := 1; j < len(line); j++ {
+					if line[j] == line[j-1] {
+						run++
+						continue
+					}
+					runs = append(runs, run)
+					if run == 1 {
+						singles++
+					}
+					run = 1
+				}
+			}
+		}
+	}
+	return
+}
+
+// fitRuns returns the share of runs with a length fitting a whole number of bits, each width long
+func fitRuns(runs []int, width float64) float64 {
+	if len(runs) == 0 {
+		return 0
+	}
+	fit := 0
+	for _, r := range runs {
+		n := math.Max(1, math.Round(float64(r)/width))
+		if math.Abs(float64(r)-n*width) < 1 {
+			fit++
+		}
+	}
+	return float64(fit) / float64(len(runs))
+}
+
+// bytesPerSecond returns the maximum bytes read on a port within estimateRateWindow, per second
+func bytesPerSecond(captures [][]*logger.DataUnit) (rate float64) {
+	for _, dus := range captures {
+		first, n := 0, 0
+		for _, du := range dus {
+			t := util.TimeBuilder(du.GetTime())
+			n += len(du.GetData())
+			for t.Sub(util.TimeBuilder(dus[first].GetTime())) >= estimateRateWindow {
+				n -= len(dus[first].GetData())
+				first++
+			}
+			rate = math.Max(rate, float64(n)/estimateRateWindow.Seconds())
+		}
+	}
+	return
+}
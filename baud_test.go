@@ -0,0 +1,97 @@
+package sniffer
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/util"
+)
+
+// readLine simulates a UART at probe speed, with errors marked, reading frames sent at speed 8N1
+func readLine(frames [][]byte, speed int, probe int) (dus []*logger.DataUnit) {
+	// line level at each 1/16 of a probe bit
+	const oversample = 16
+	tick := 1 / float64(probe*oversample)
+	line := []byte{}
+	level := func(bit byte, bits int) {
+		for n := int(float64(bits) / float64(speed) / tick); n > 0; n-- {
+			line = append(line, bit)
+		}
+	}
+	for _, f := range frames {
+		level(1, 40)
+		for _, b := range f {
+			level(0, 1)
+			for j := 0; j < 8; j++ {
+				level(b>>j&1, 1)
+			}
+			level(1, 1)
+		}
+	}
+	level(1, 40)
+
+	t0 := time.Date(2020, 9, 12, 19, 53, 58, 0, time.UTC)
+	for i := 1; i < len(line); i++ {
+		// falling edge is a start bit
+		if line[i-1] != 1 || line[i] != 0 {
+			continue
+		}
+		ts := util.TimestampBuilder(t0.Add(time.Duration(float64(i) * tick * float64(time.Second))))
+		du := &logger.DataUnit{Time: &ts}
+		var b byte
+		for j := 0; j < 8; j++ {
+			k := i + (j+1)*oversample + oversample/2
+			if k < len(line) {
+				b |= line[k] << j
+			}
+		}
+		stop := i + 9*oversample + oversample/2
+		if stop < len(line) && line[stop] == 0 {
+			du.FramingErrors = []uint32{0}
+		}
+		du.Data = []byte{b}
+		dus = append(dus, du)
+		i = stop
+	}
+	return
+}
+
+func TestRankSpeeds(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	frames := [][]byte{}
+	for i := 0; i < 20; i++ {
+		f := []byte{0x02, 0x03, 0x14}
+		for j := 0; j < 20; j++ {
+			f = append(f, byte(r.Intn(256)))
+		}
+		frames = append(frames, f)
+	}
+
+	for _, speed := range ScanSpeeds {
+		probes := make(map[int][][]*logger.DataUnit)
+		marked := make(map[int]bool)
+		for _, p := range scanProbeSpeeds {
+			probes[p] = [][]*logger.DataUnit{readLine(frames, speed, p)}
+			marked[p] = true
+		}
+		estimates := rankSpeeds(ScanSpeeds, probes, marked)
+		if estimates[0].Speed != speed {
+			t.Errorf("speed %d: got %s first", speed, estimates[0].PrettyString())
+			for _, e := range estimates {
+				t.Log(e.PrettyString())
+			}
+		}
+	}
+}
+
+func TestOpenSpeeds(t *testing.T) {
+	if got := openSpeeds(ScanSpeeds); !reflect.DeepEqual(got, ScanSpeeds) {
+		t.Errorf("got %v, want ScanSpeeds %v, which ports can be opened at", got, ScanSpeeds)
+	}
+	if got, want := openSpeeds([]int{9600, 14400, 19200, 76800}), []int{9600, 19200, 57600}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
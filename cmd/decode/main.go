@@ -2,7 +2,7 @@ package main
 
 import (
 	"bufio"
-	"fmt"
+	"flag"
 	"io"
 	"log"
 	"os"
@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/filter"
+	"github.com/andreaaizza/sniffer/output"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -17,6 +19,20 @@ import (
 // Decodes Sniffer.ProtoBytesAndFlush() data from stdin, encoded as fmt.Sprintf("%d"), terminated with \n
 // e.g. "10 68 10 32 10 30 8 1 120 153 99 130 1 12 8 153 214 149 252 5 16 248 ..."
 func main() {
+	filterExpr := flag.String("filter", "", "prints only results matching this display filter, e.g. \"slave == 2 && fc in {3,4} && latency > 50ms || exception\"")
+	format := flag.String("format", "text", "format of results printed: text, jsonl for a JSON object per line, or csv")
+	flag.Parse()
+	resultWriter, err := output.New(*format, os.Stdout)
+	if err != nil {
+		log.Panic(err)
+	}
+	var resultFilter *filter.Filter
+	if *filterExpr != "" {
+		if resultFilter, err = filter.Compile(*filterExpr); err != nil {
+			log.Panic(err)
+		}
+	}
+
 	file := os.Stdin
 	reader := bufio.NewReader(file)
 	if reader == nil {
@@ -63,7 +79,12 @@ func main() {
 		}
 
 		for _, rr := range r.GetResults() {
-			fmt.Print(rr.PrettyString(), "\n")
+			if !resultFilter.Match(rr) {
+				continue
+			}
+			if err := resultWriter.Write(rr); err != nil {
+				log.Print(err)
+			}
 		}
 	}
 }
@@ -1,24 +1,56 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/audit"
+	"github.com/andreaaizza/sniffer/baseline"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/events"
+	"github.com/andreaaizza/sniffer/filter"
+	"github.com/andreaaizza/sniffer/ids"
+	"github.com/andreaaizza/sniffer/influx"
+	"github.com/andreaaizza/sniffer/inventory"
 	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/modbustcp"
+	"github.com/andreaaizza/sniffer/mqtt"
+	"github.com/andreaaizza/sniffer/output"
+	"github.com/andreaaizza/sniffer/regmap"
+	"github.com/andreaaizza/sniffer/rpc"
+	"github.com/andreaaizza/sniffer/signals"
+	"github.com/andreaaizza/sniffer/store"
+	"github.com/andreaaizza/sniffer/web"
+
+	"google.golang.org/grpc"
 )
 
 const (
 	ScanSecondsModbusRTUDefault = 5
+
+	InventorySecondsDefault = 60
 )
 
 func main() {
 	// logging flags
 	log.SetFlags(log.LstdFlags)
 
+	// query subcommand
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		query(os.Args[2:])
+		return
+	}
+
 	// flag
 	duplex := flag.Bool("duplex", false, "duplex mode. Uses d1 and d2: d1 is TX, d2 is RX")
 	port1 := flag.String("d1", "/dev/ttyAPP3", "port1 half-duplex: tx and rx, duplex: tx only")
@@ -26,9 +58,57 @@ func main() {
 	baud := flag.Int("b", 9600, "baud")
 	frame := flag.String("f", "8N1", "frame config")
 	debug := flag.Bool("debug", false, "debug")
+	reconnect := flag.Bool("reconnect", true, "reopens a failed port (e.g. USB adapter unplugged) instead of exiting")
 	runFor := flag.Int("s", 0, "exits after specified amount of seconds (default 0==infinite)")
-	scanOnly := flag.Bool("scan", false, "scans each configuration for scan_seconds. Returns success if at least one request->{response/exception} match is found. In duplex mode, it is not supported to have different baud/frame between tx and rx lines")
-	scanEachPortSeconds := flag.Int("scan_seconds", ScanSecondsModbusRTUDefault, "try each configuration for seconds")
+	scanOnly := flag.Bool("scan", false, "scans each speed for scan_seconds, trying all frame formats on the same capture. Returns success if at least one request->{response/exception} match is found. d1 (and d2) can be comma separated lists of ports, scanned concurrently. In duplex mode, it is not supported to have different baud/frame between tx and rx lines")
+	scanEachPortSeconds := flag.Int("scan_seconds", ScanSecondsModbusRTUDefault, "capture each speed for up to seconds")
+	scanMinMatches := flag.Int("scan_matches", sniffer.ScanMinMatchesDefault, "stops scanning as soon as this many request->{response/exception} matches are found")
+	scanJSON := flag.Bool("scan_json", false, "prints the scan report, the score of each configuration tried, as JSON")
+	scanEstimate := flag.Bool("scan_estimate", true, "estimates the line speed, reading at a few probe speeds, and scans the most likely speeds first, non standard ones included")
+	inventoryMode := flag.Bool("inventory", false, "listens for s seconds (default 60) and reports every slave seen: function codes, register ranges and their poll period, exceptions, timeouts and latency")
+	inventoryJSON := flag.Bool("inventory_json", false, "prints the inventory as JSON instead of a table")
+	cycleReport := flag.Bool("cycle", false, "prints the polling cycle learned on exit: schedule, cycle time and jitter, entries skipped and requests out of schedule")
+	imageReport := flag.Bool("image", false, "prints the process image on exit: last value of every coil, input and register read or written")
+	eventsMode := flag.Bool("events", false, "prints change events instead of results: register map points changing beyond their deadband (or events_deadband*), coils and discrete inputs flipping")
+	eventsJSON := flag.Bool("events_json", false, "prints change events as JSON lines")
+	eventsDeadband := flag.Float64("events_deadband", 0, "default absolute deadband of register map points")
+	eventsDeadbandPercent := flag.Float64("events_deadband_percent", 0, "default deadband of register map points, in percent of the last value reported")
+	idsFile := flag.String("ids", "", "evaluates every request against the rules in this file (.yaml, .yml or .json) and prints an alert for each rule matched")
+	idsJSON := flag.Bool("ids_json", false, "prints alerts as JSON lines")
+	baselineFile := flag.String("baseline", "", "flags anomalies against the baseline of normal traffic saved in this file: unknown transactions, poll rate, latency, values out of range, new exceptions. If the file does not exist, the baseline is learned for baseline_train seconds and saved first")
+	baselineTrain := flag.Int("baseline_train", baseline.TrainSecondsDefault, "seconds of traffic to learn the baseline from")
+	baselineJSON := flag.Bool("baseline_json", false, "prints anomalies as JSON lines")
+	auditFile := flag.String("audit", "", "appends a record of every write (FC5, 6, 15, 16, 22, 23) to this file: port, slave, registers, old and new values, acknowledged or exception. CSV if the file name ends with .csv, JSON lines otherwise")
+	regmapFile := flag.String("regmap", "", "register map profile (.yaml, .yml, .json or .csv): decodes registers read and written into named values, printed with results")
+	filterExpr := flag.String("filter", "", "prints only results matching this display filter, e.g. \"slave == 2 && fc in {3,4} && reg >= 100 && latency > 50ms || exception\". Fields: slave, fc, reg, qty, value, latency, exception, port, write, request, response")
+	format := flag.String("format", "text", "format of results printed: text, jsonl for a JSON object per line with protojson field names of sniffer.proto, hex payloads, decoded fields, latency and status, or csv (see csv_*)")
+	csvColumns := flag.String("csv_columns", strings.Join(output.CSVColumnsDefault, ","), "comma separated columns of csv results, among "+strings.Join(output.CSVColumns, ",")+", or register map points (device.name or name) for their decoded values")
+	csvHeader := flag.Bool("csv_header", true, "writes a header row first with csv results")
+	csvDelimiter := flag.String("csv_delimiter", ",", "delimiter of columns of csv results, e.g. ; or tab")
+	csvTime := flag.String("csv_time", "", "time format of csv results: unix (seconds), unixms, excel (2006-01-02 15:04:05.000 local), or a Go layout (default RFC3339Nano UTC)")
+	mqttBroker := flag.String("mqtt", "", "publishes results (JSON, as -format jsonl) and values decoded with the register map (text) to this MQTT broker, e.g. tcp://localhost:1883, ssl://broker:8883 (default disabled)")
+	mqttTopic := flag.String("mqtt_topic", mqtt.TopicDefault, "topic template of results: {port}, {slave}, {fc}, {table}, {register} (first address requested) are replaced")
+	mqttValueTopic := flag.String("mqtt_value_topic", mqtt.ValueTopicDefault, "topic template of decoded values: as mqtt_topic, {register} is the address of the value, {device} and {name} its names")
+	mqttQoS := flag.Uint("mqtt_qos", 0, "MQTT QoS: 0, 1 or 2")
+	mqttRetained := flag.Bool("mqtt_retained", false, "publishes retained messages, so that subscribers get the last values right away")
+	mqttClientID := flag.String("mqtt_client_id", "", "MQTT client id (default sniffer-<host>-<pid>)")
+	mqttUsername := flag.String("mqtt_username", "", "MQTT username")
+	mqttPassword := flag.String("mqtt_password", "", "MQTT password")
+	mqttCA := flag.String("mqtt_ca", "", "PEM file of the CA verifying the MQTT broker, for ssl:// brokers (default system roots)")
+	mqttCert := flag.String("mqtt_cert", "", "PEM file of the client certificate, for ssl:// brokers requiring one")
+	mqttKey := flag.String("mqtt_key", "", "PEM file of the key of mqtt_cert")
+	mqttInsecure := flag.Bool("mqtt_insecure", false, "does not verify the certificate of ssl:// brokers")
+	influxTarget := flag.String("influx", "", "writes values decoded with the register map and bus metrics in InfluxDB line protocol to this file (appended), - for stdout, or HTTP write endpoint, e.g. http://localhost:8086/write?db=modbus (default disabled)")
+	influxToken := flag.String("influx_token", "", "token authorizing writes to InfluxDB 2.x endpoints")
+	influxMeasurement := flag.String("influx_measurement", influx.MeasurementDefault, "measurement of values; metrics are measurement_port and measurement_slave")
+	influxMetrics := flag.Int("influx_metrics", 10, "writes bus metrics every this many seconds, 0 to disable")
+	influxSpool := flag.String("influx_spool", "", "directory keeping batches the endpoint failed to write, written again once it is back (default dropped)")
+	storeFile := flag.String("store", "", "keeps frames, results, garbage (bytes which built no frame) and alerts in this SQLite database, see the query subcommand (default disabled)")
+	storeDays := flag.Int("store_days", 0, "deletes stored rows older than this many days (default 0==never)")
+	grpcListen := flag.String("grpc-listen", "", "serves live results, bus statistics, process image and ports over gRPC on this address, e.g. :50051, see rpc/rpc.proto (default disabled)")
+	httpListen := flag.String("http-listen", "", "serves a live view of the bus on this address, e.g. :8080: a web page of results, REST API of config, stats, recent results and process image, WebSocket feed of results (default disabled)")
+	metricsListen := flag.String("metrics-listen", "", "serves bus statistics in Prometheus text format on /metrics at this address, e.g. :9100 (default disabled)")
+	modbusTCPListen := flag.String("modbus-tcp-listen", "", "serves the process image read-only over Modbus TCP at this address, e.g. :502: unit id is the slave address, FC1-4 are answered with the values last seen on the bus (default disabled)")
 	flag.Parse()
 
 	// parse flags
@@ -39,16 +119,16 @@ func main() {
 	// parse flags
 	if *duplex {
 		ports := []*logger.Config{
-			&logger.Config{Port: *port1, Baud: int(*baud), FrameFormat: *frame, Debug: *debug},
-			&logger.Config{Port: *port2, Baud: int(*baud), FrameFormat: *frame, Debug: *debug},
+			&logger.Config{Port: *port1, Baud: int(*baud), FrameFormat: *frame, Debug: *debug, Reconnect: *reconnect},
+			&logger.Config{Port: *port2, Baud: int(*baud), FrameFormat: *frame, Debug: *debug, Reconnect: *reconnect},
 		}
-		conf = sniffer.Config{Ports: ports}
+		conf = sniffer.Config{Ports: ports, StreamOnly: true}
 		log.Printf("Starting duplex Modbus RTU sniffer on %s %s", ports[0].PrettyString(), ports[1].PrettyString())
 	} else {
 		ports := []*logger.Config{
-			&logger.Config{Port: *port1, Baud: int(*baud), FrameFormat: *frame, Debug: *debug},
+			&logger.Config{Port: *port1, Baud: int(*baud), FrameFormat: *frame, Debug: *debug, Reconnect: *reconnect},
 		}
-		conf = sniffer.Config{Ports: ports}
+		conf = sniffer.Config{Ports: ports, StreamOnly: true}
 		log.Printf("Starting half-duplex Modbus RTU sniffer on %s", ports[0].PrettyString())
 	}
 
@@ -63,69 +143,390 @@ func main() {
 			frameP = frame
 		}
 
-		//fmt.Printf("Scanning port %s...\n", *port)
-		c := sniffer.ScanPort(conf, baudP, frameP, *scanEachPortSeconds, *debug)
-		if c != nil {
-			fmt.Printf("Found! Received valid data with: %s\n", c.PrettyString())
+		// each comma separated port (pair, if duplex) is a candidate, scanned concurrently
+		port2s := strings.Split(*port2, ",")
+		var candidates []sniffer.Config
+		for i, p := range strings.Split(*port1, ",") {
+			c := sniffer.Config{Ports: []*logger.Config{&logger.Config{Port: p}}}
+			if *duplex {
+				if i >= len(port2s) {
+					log.Panicf("No d2 port for d1 port %s", p)
+				}
+				c.Ports = append(c.Ports, &logger.Config{Port: port2s[i]})
+			}
+			candidates = append(candidates, c)
+		}
+
+		ctx, cancel := signals.Context(context.Background())
+		defer cancel()
+		reports := sniffer.ScanPorts(ctx, candidates, sniffer.ScanOptions{
+			Speed: baudP, Frame: frameP, Seconds: *scanEachPortSeconds, MinMatches: *scanMinMatches, Estimate: *scanEstimate,
+			Debug: *debug})
+		ok := false
+		for _, r := range reports {
+			ok = ok || r.Best != nil
+		}
+		if *scanJSON {
+			b, err := json.MarshalIndent(reports, "", "  ")
+			if err != nil {
+				log.Panic(err)
+			}
+			fmt.Printf("%s\n", b)
+		} else {
+			for _, r := range reports {
+				fmt.Printf("Port %s:\n%s", strings.Join(r.Ports, ","), r.PrettyString())
+				if c := r.Config(); c != nil {
+					fmt.Printf("Found! Received valid data with: %s\n", c.PrettyString())
+				} else {
+					fmt.Print("No valid config found\n")
+				}
+			}
+		}
+		if ok {
 			os.Exit(0)
 		}
-		fmt.Print("No valid config found\n")
 		os.Exit(1)
 	}
 
+	// register map
+	if *regmapFile != "" {
+		conf.RegisterMap, err = regmap.Load(*regmapFile)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	// audit log
+	if *auditFile != "" {
+		f, err := os.OpenFile(*auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Panic(err)
+		}
+		defer f.Close()
+		if strings.HasSuffix(strings.ToLower(*auditFile), ".csv") {
+			info, err := f.Stat()
+			if err != nil {
+				log.Panic(err)
+			}
+			conf.AuditLog = audit.NewCSVWriter(f, info.Size() == 0)
+		} else {
+			conf.AuditLog = audit.NewJSONWriter(f)
+		}
+	}
+
 	// sniffer
 	s, err = sniffer.NewModbusRTUSniffer(conf)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	// Print results
+	// Metrics exporter
+	if *metricsListen != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", s.Metrics().Handler())
+			log.Printf("Serving metrics on %s/metrics", *metricsListen)
+			log.Panic(http.ListenAndServe(*metricsListen, mux))
+		}()
+	}
+
+	// Modbus TCP gateway
+	if *modbusTCPListen != "" {
+		server := modbustcp.NewServer(s.ProcessImage(), *debug)
+		defer server.Close()
+		go func() {
+			log.Printf("Serving Modbus TCP on %s", *modbusTCPListen)
+			if err := server.ListenAndServe(*modbusTCPListen); err != nil {
+				log.Panic(err)
+			}
+		}()
+	}
+
+	// gRPC service
+	if *grpcListen != "" {
+		l, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			log.Panic(err)
+		}
+		srv := rpc.NewServer(s)
+		g := grpc.NewServer()
+		srv.Register(g)
+		defer g.Stop()
+		defer srv.Close()
+		go func() {
+			log.Printf("Serving gRPC on %s", *grpcListen)
+			if err := g.Serve(l); err != nil {
+				log.Panic(err)
+			}
+		}()
+	}
+
+	// Live view
+	if *httpListen != "" {
+		// flags as configured, secrets hidden
+		config := make(map[string]string)
+		flag.VisitAll(func(f *flag.Flag) {
+			config[f.Name] = f.Value.String()
+			if (strings.Contains(f.Name, "password") || strings.Contains(f.Name, "token")) && config[f.Name] != "" {
+				config[f.Name] = "*"
+			}
+		})
+		view := web.New(s, web.Options{Config: config})
+		defer view.Close()
+		go func() {
+			log.Printf("Serving live view on %s", *httpListen)
+			log.Panic(http.ListenAndServe(*httpListen, view))
+		}()
+	}
+
+	// Capture store
+	var st *store.Store
+	if *storeFile != "" {
+		st, err = store.Open(*storeFile, store.Options{MaxAge: time.Duration(*storeDays) * 24 * time.Hour})
+		if err != nil {
+			log.Panic(err)
+		}
+		s.OnFrame(st.AddFrame)
+		s.OnResult(st.AddResult)
+		s.OnGarbage(st.AddGarbage)
+	}
+
+	// Collect inventory
+	var inv *inventory.Inventory
+	if *inventoryMode {
+		inv = inventory.New()
+		s.OnResult(inv.Add)
+		if *runFor == 0 {
+			*runFor = InventorySecondsDefault
+		}
+		log.Printf("Listening for %d seconds", *runFor)
+	}
+
+	// Intrusion detection
+	if *idsFile != "" {
+		rules, err := ids.Load(*idsFile)
+		if err != nil {
+			log.Panic(err)
+		}
+		engine := ids.New(rules)
+		s.OnRequest(func(r *dissector.Result) {
+			for _, a := range engine.Check(r) {
+				if st != nil {
+					st.AddAlert(store.NewIDSAlert(a))
+				}
+				printJSONOrPretty(a, *idsJSON)
+			}
+		})
+	}
+
+	// Anomaly detection
+	if *baselineFile != "" {
+		bl, err := baseline.Load(*baselineFile)
+		if err != nil && !os.IsNotExist(err) {
+			log.Panic(err)
+		}
+		if bl == nil {
+			log.Printf("Learning baseline for %d seconds", *baselineTrain)
+		}
+		det := baseline.New(bl, baseline.Options{
+			TrainSeconds: float64(*baselineTrain),
+			OnLearned: func(b *baseline.Baseline) {
+				if err := b.Save(*baselineFile); err != nil {
+					log.Panic(err)
+				}
+				log.Printf("Baseline saved to %s", *baselineFile)
+			},
+		})
+		s.OnResult(func(r *sniffer.Result) {
+			for _, a := range det.Add(r) {
+				if st != nil {
+					st.AddAlert(store.NewAnomalyAlert(a))
+				}
+				printJSONOrPretty(a, *baselineJSON)
+			}
+		})
+	}
+
+	// Print change events
+	if *eventsMode || *eventsJSON {
+		det := events.New(conf.RegisterMap, events.Deadband{Absolute: *eventsDeadband, Percent: *eventsDeadbandPercent})
+		s.OnResult(func(r *sniffer.Result) {
+			for _, e := range det.Add(r) {
+				printJSONOrPretty(e, *eventsJSON)
+			}
+		})
+	}
+
+	// Publish to MQTT
+	var publisher *mqtt.Publisher
+	if *mqttBroker != "" {
+		opts := mqtt.Options{Broker: *mqttBroker, ClientID: *mqttClientID, Username: *mqttUsername, Password: *mqttPassword,
+			Topic: *mqttTopic, ValueTopic: *mqttValueTopic, QoS: byte(*mqttQoS), Retained: *mqttRetained}
+		if *mqttCA != "" || *mqttCert != "" || *mqttInsecure {
+			opts.TLS, err = mqtt.TLSConfig(*mqttCA, *mqttCert, *mqttKey, *mqttInsecure)
+			if err != nil {
+				log.Panic(err)
+			}
+		}
+		publisher, err = mqtt.New(opts)
+		if err != nil {
+			log.Panic(err)
+		}
+		s.OnResult(publisher.Publish)
+	}
+
+	// Write InfluxDB line protocol
+	var influxWriter *influx.Writer
+	stopInfluxMetrics := make(chan struct{})
+	if *influxTarget != "" {
+		opts := influx.Options{Token: *influxToken, Measurement: *influxMeasurement, SpoolDir: *influxSpool}
+		var w io.Writer = os.Stdout
+		if strings.HasPrefix(*influxTarget, "http://") || strings.HasPrefix(*influxTarget, "https://") {
+			opts.URL = *influxTarget
+		} else if *influxTarget != "-" {
+			f, err := os.OpenFile(*influxTarget, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				log.Panic(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		influxWriter, err = influx.New(w, opts)
+		if err != nil {
+			log.Panic(err)
+		}
+		s.OnResult(influxWriter.Add)
+		if *influxMetrics > 0 {
+			go func() {
+				ticker := time.NewTicker(time.Duration(*influxMetrics) * time.Second)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						snap := s.Metrics().Snapshot()
+						influxWriter.AddMetrics(&snap)
+					case <-stopInfluxMetrics:
+						return
+					}
+				}
+			}()
+		}
+	}
+
+	// Print results as they come
+	printResults := inv == nil && !*eventsMode && !*eventsJSON
+	var resultWriter output.Writer
+	if *format == "csv" {
+		delimiter := []rune(strings.Replace(*csvDelimiter, "tab", "\t", 1))
+		if len(delimiter) != 1 {
+			log.Panicf("Invalid csv_delimiter %q, want a single character", *csvDelimiter)
+		}
+		resultWriter, err = output.NewCSVWriter(os.Stdout, output.CSVOptions{Columns: strings.Split(*csvColumns, ","),
+			Header: *csvHeader, Delimiter: delimiter[0], TimeFormat: *csvTime, Map: conf.RegisterMap})
+	} else {
+		resultWriter, err = output.New(*format, os.Stdout)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	var resultFilter *filter.Filter
+	if *filterExpr != "" {
+		resultFilter, err = filter.Compile(*filterExpr)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	printed := make(chan struct{})
 	go func() {
-		for {
-			ticker5s := time.NewTicker(5 * time.Second)
-			select {
-			case <-ticker5s.C:
-				results := s.GetResultsAndFlush()
-
-				// output
-				for _, r := range results.GetResults() {
-					fmt.Print(r.PrettyString(), "\n")
+		for r := range s.Results() {
+			if printResults && resultFilter.Match(r) {
+				if err := resultWriter.Write(r); err != nil {
+					log.Print(err)
 				}
 			}
 		}
+		close(printed)
 	}()
-	// Count results
+	// Count dropped results
 	if *debug {
 		go func() {
 			for {
 				ticker1s := time.NewTicker(1 * time.Second)
 				select {
 				case <-ticker1s.C:
-					fmt.Print("Results count: ", s.GetResultsCount(), "\n")
+					fmt.Print("Dropped results count: ", s.DroppedResults(), "\n")
 				}
 			}
 		}()
 	}
-	// Exit
-	if *runFor > 0 {
-		go func() {
-			for {
-				select {
-				case <-time.After(time.Duration(*runFor) * time.Second):
-					if *debug {
-						fmt.Print("Closing sniffer...\n")
-					}
-					s.Close()
 
-					os.Exit(0)
-				}
+	// Run until signal, timeout or port failure
+	ctx, cancel := signals.Context(context.Background())
+	defer cancel()
+	if *runFor > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(*runFor)*time.Second)
+		defer cancel()
+	}
+	err = s.Run(ctx)
+	<-printed
+	if publisher != nil {
+		publisher.Close()
+	}
+	if influxWriter != nil {
+		close(stopInfluxMetrics)
+		if *influxMetrics > 0 {
+			snap := s.Metrics().Snapshot()
+			influxWriter.AddMetrics(&snap)
+		}
+		influxWriter.Close()
+	}
+	if st != nil {
+		if err := st.Close(); err != nil {
+			log.Print(err)
+		}
+	}
+	if *debug {
+		fmt.Print("Sniffer closed\n")
+	}
+	if *cycleReport {
+		r := s.Cycle().Report()
+		fmt.Print(r.PrettyString())
+	}
+	if *imageReport {
+		for _, p := range s.ProcessImage().ChangedSince(time.Time{}) {
+			fmt.Print(p.PrettyString(), "\n")
+		}
+	}
+	if inv != nil {
+		snap := s.Metrics().Snapshot()
+		report := inv.Report(&snap)
+		if *inventoryJSON {
+			b, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				log.Panic(err)
 			}
-		}()
+			fmt.Printf("%s\n", b)
+		} else {
+			report.WriteTable(os.Stdout)
+		}
 	}
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+}
 
-	for {
-		select {}
+// printJSONOrPretty prints v as a line of JSON if asJSON, with its PrettyString otherwise
+func printJSONOrPretty(v interface{ PrettyString() string }, asJSON bool) {
+	if !asJSON {
+		fmt.Print(v.PrettyString(), "\n")
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Panic(err)
 	}
+	fmt.Printf("%s\n", b)
 }
 
 func isFlagPassed(name string) bool {
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/filter"
+	"github.com/andreaaizza/sniffer/output"
+	"github.com/andreaaizza/sniffer/store"
+)
+
+// query prints rows of a database written with -store, e.g. all exceptions of slave 7 yesterday from 14:00 to 15:00:
+// query -db capture.db -slave 7 -exceptions -from "yesterday 14:00" -to "yesterday 15:00"
+func query(args []string) {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	dbFile := flags.String("db", "", "SQLite database written with -store")
+	table := flags.String("table", "results", "rows to print: "+strings.Join(store.Tables, ", "))
+	from := flags.String("from", "", "prints rows from this time: 2006-01-02 15:04:05, 2006-01-02 15:04, 2006-01-02, RFC3339, now, today or yesterday optionally followed by 15:04[:05], 15:04[:05] of today, or -1h30m from now (default any)")
+	to := flags.String("to", "", "prints rows before this time, as from (default any)")
+	slaves := flags.String("slave", "", "comma separated slaves (default any)")
+	fcs := flags.String("fc", "", "comma separated function codes, exceptions included (default any)")
+	exceptions := flags.Bool("exceptions", false, "prints only exceptions, of results and frames")
+	filterExpr := flags.String("filter", "", "prints only results and frames matching this display filter, e.g. \"reg in {100..120} && latency > 50ms\"")
+	limit := flags.Int("limit", 0, "prints at most this many rows (default 0==all)")
+	format := flags.String("format", "text", "format of rows printed: text, jsonl for a JSON object per line, or csv (results only)")
+	flags.Parse(args)
+
+	if *dbFile == "" {
+		log.Panic("No database, use -db")
+	}
+	// do not create an empty database
+	if _, err := os.Stat(*dbFile); err != nil {
+		log.Panic(err)
+	}
+	var q store.Query
+	var err error
+	now := time.Now()
+	if *from != "" {
+		if q.From, err = store.ParseTime(*from, now); err != nil {
+			log.Panic(err)
+		}
+	}
+	if *to != "" {
+		if q.To, err = store.ParseTime(*to, now); err != nil {
+			log.Panic(err)
+		}
+	}
+	if q.Slaves, err = parseUints(*slaves); err != nil {
+		log.Panic(err)
+	}
+	if q.FunctionCodes, err = parseUints(*fcs); err != nil {
+		log.Panic(err)
+	}
+	q.Exceptions = *exceptions
+	var f *filter.Filter
+	if *filterExpr != "" {
+		if f, err = filter.Compile(*filterExpr); err != nil {
+			log.Panic(err)
+		}
+		if *table != "results" && *table != "frames" {
+			log.Panicf("Display filters apply to results and frames, not %s", *table)
+		}
+	}
+	// limit applies after the filter
+	q.Limit = *limit
+	if f != nil {
+		q.Limit = 0
+	}
+	if *format != "text" && *format != "jsonl" && (*format != "csv" || *table != "results") {
+		log.Panicf("Invalid format %s of %s", *format, *table)
+	}
+
+	st, err := store.Open(*dbFile, store.Options{})
+	if err != nil {
+		log.Panic(err)
+	}
+	defer st.Close()
+
+	// print writes rows as text or JSON, up to limit
+	printed := 0
+	print := func(text func() string, v interface{}) error {
+		if *limit > 0 && printed >= *limit {
+			return errLimit
+		}
+		printed++
+		if *format == "jsonl" {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Printf("%s\n", b)
+			return err
+		}
+		_, err := fmt.Print(text(), "\n")
+		return err
+	}
+
+	switch *table {
+	case "results":
+		w, err := output.New(*format, os.Stdout)
+		if err != nil {
+			log.Panic(err)
+		}
+		err = st.Results(q, func(r *sniffer.Result) error {
+			if !f.Match(r) {
+				return nil
+			}
+			if *limit > 0 && printed >= *limit {
+				return errLimit
+			}
+			printed++
+			return w.Write(r)
+		})
+	case "frames":
+		err = st.Frames(q, func(r *dissector.Result) error {
+			if f != nil && !f.Validate(r) {
+				return nil
+			}
+			return print(r.PrettyString, output.NewResult(r))
+		})
+	case "garbage":
+		err = st.Garbage(q, func(g *dissector.Garbage) error {
+			return print(g.PrettyString, output.NewGarbage(g))
+		})
+	case "alerts":
+		err = st.Alerts(q, func(a *store.Alert) error {
+			return print(a.PrettyString, a)
+		})
+	default:
+		log.Panicf("Unknown table %s, want one of %s", *table, strings.Join(store.Tables, ", "))
+	}
+	if err != nil && err != errLimit {
+		log.Panic(err)
+	}
+}
+
+// errLimit stops printing rows
+var errLimit = fmt.Errorf("limit reached")
+
+// parseUints parses a comma separated list, nil if s is empty
+func parseUints(s string) (values []uint32, err error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, x := range strings.Split(s, ",") {
+		v, err := strconv.ParseUint(strings.TrimSpace(x), 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", x)
+		}
+		values = append(values, uint32(v))
+	}
+	return
+}
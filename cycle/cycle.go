@@ -0,0 +1,218 @@
+package cycle
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// HistorySize requests kept to learn the schedule: it is found if it repeats within this many requests
+	HistorySize = 512
+
+	// minRepeats times the schedule must repeat to be learned
+	minRepeats = 2
+	// learnMinRequests requests needed to learn the schedule, so that a slave polled a few times in a row is not
+	// taken for the whole schedule
+	learnMinRequests = 8
+)
+
+// Entry a request of the polling cycle
+type Entry struct {
+	Address      uint32 `json:"address"`
+	FunctionCode uint32 `json:"functionCode"`
+	Start        uint32 `json:"start"`
+	Quantity     uint32 `json:"quantity"`
+}
+
+// Cycle learns the polling cycle of a master, the sequence of requests it repeats, and tracks cycle time,
+// jitter, entries skipped and requests out of schedule. When requests keep deviating, the schedule is learned
+// again. All methods are safe for concurrent use and can be called on a nil *Cycle, which is a no-op.
+type Cycle struct {
+	mux sync.Mutex
+
+	history []request
+
+	// learned schedule, empty while learning
+	schedule []*entry
+	pos      int
+	// start time of the current cycle, zero if its first entry was skipped
+	start time.Time
+	// consecutive requests other than expected
+	outOfSchedule int
+
+	cycleTime  stats
+	skipped    uint64
+	deviations uint64
+	relearned  uint64
+}
+
+type request struct {
+	entry   Entry
+	time    time.Time
+	latency time.Duration
+}
+
+type entry struct {
+	Entry
+	offset  stats
+	latency stats
+	skipped uint64
+}
+
+// New builds a Cycle
+func New() *Cycle {
+	return &Cycle{}
+}
+
+// Add records a request answered after latency, at time t
+func (c *Cycle) Add(e Entry, t time.Time, latency time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	r := request{entry: e, time: t, latency: latency}
+	c.history = append(c.history, r)
+	if len(c.history) > HistorySize {
+		c.history = c.history[len(c.history)-HistorySize:]
+	}
+
+	if len(c.schedule) == 0 {
+		c.learn()
+		return
+	}
+	c.track(r)
+}
+
+// learn finds the shortest sequence repeated at the end of history, at least minRepeats times and over the
+// last learnMinRequests requests
+func (c *Cycle) learn() {
+	n := len(c.history)
+	for p := 1; p*minRepeats <= n; p++ {
+		m := p * minRepeats
+		if m < learnMinRequests {
+			m = learnMinRequests
+		}
+		if m > n {
+			return
+		}
+		repeated := true
+		for i := n - m; i < n-p && repeated; i++ {
+			repeated = c.history[i].entry == c.history[i+p].entry
+		}
+		if !repeated {
+			continue
+		}
+
+		// masters usually wait before starting a new cycle: it starts after the longest gap between requests
+		first, gap := 0, time.Duration(-1)
+		for i := 0; i < p; i++ {
+			if g := c.history[n-p+i].time.Sub(c.history[n-p+i-1].time); g > gap {
+				first, gap = i, g
+			}
+		}
+		c.schedule = make([]*entry, p)
+		for i := range c.schedule {
+			r := c.history[n-p+(first+i)%p]
+			c.schedule[i] = &entry{Entry: r.entry}
+			c.schedule[i].latency.add(r.latency.Seconds())
+		}
+		// the last request was the entry before the first one of the last cycle
+		c.pos = (p - first) % p
+		c.start = time.Time{}
+		c.outOfSchedule = 0
+		return
+	}
+}
+
+// track matches r against the schedule
+func (c *Cycle) track(r request) {
+	// find r in the schedule from the expected position, entries in between were skipped
+	p := len(c.schedule)
+	found := -1
+	for i := 0; i < p; i++ {
+		if c.schedule[(c.pos+i)%p].Entry == r.entry {
+			found = i
+			break
+		}
+	}
+	if found != 0 {
+		// requests keep deviating: the schedule changed
+		c.outOfSchedule++
+		if c.outOfSchedule > p {
+			c.relearn()
+			return
+		}
+	} else {
+		c.outOfSchedule = 0
+	}
+	if found < 0 {
+		c.deviations++
+		return
+	}
+
+	for i := 0; i < found; i++ {
+		j := (c.pos + i) % p
+		c.schedule[j].skipped++
+		c.skipped++
+		if j == 0 {
+			c.start = time.Time{}
+		}
+	}
+	c.pos = (c.pos + found) % p
+
+	// a new cycle starts
+	if c.pos == 0 {
+		if !c.start.IsZero() {
+			c.cycleTime.add(r.time.Sub(c.start).Seconds())
+		}
+		c.start = r.time
+	}
+
+	e := c.schedule[c.pos]
+	e.latency.add(r.latency.Seconds())
+	if !c.start.IsZero() {
+		e.offset.add(r.time.Sub(c.start).Seconds())
+	}
+	c.pos = (c.pos + 1) % p
+}
+
+// relearn forgets the schedule, and learns it again
+func (c *Cycle) relearn() {
+	c.relearned++
+	c.schedule = nil
+	c.learn()
+}
+
+// stats running mean and standard deviation, with min and max
+type stats struct {
+	n    uint64
+	mean float64
+	m2   float64
+	min  float64
+	max  float64
+	last float64
+}
+
+func (s *stats) add(v float64) {
+	s.n++
+	d := v - s.mean
+	s.mean += d / float64(s.n)
+	s.m2 += d * (v - s.mean)
+	if s.n == 1 || v < s.min {
+		s.min = v
+	}
+	if s.n == 1 || v > s.max {
+		s.max = v
+	}
+	s.last = v
+}
+
+func (s *stats) stddev() float64 {
+	if s.n < 2 {
+		return 0
+	}
+	return math.Sqrt(s.m2 / float64(s.n-1))
+}
@@ -0,0 +1,54 @@
+package cycle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCycle(t *testing.T) {
+	a := Entry{Address: 1, FunctionCode: 3, Start: 0, Quantity: 10}
+	b := Entry{Address: 2, FunctionCode: 4, Start: 100, Quantity: 2}
+	x := Entry{Address: 9, FunctionCode: 3}
+
+	c := New()
+	t0 := time.Date(2020, 9, 14, 8, 45, 54, 0, time.UTC)
+	at := t0
+	poll := func(entries ...Entry) {
+		for _, e := range entries {
+			c.Add(e, at, 10*time.Millisecond)
+			at = at.Add(50 * time.Millisecond)
+		}
+		// cycle time 200ms
+		at = at.Add(200*time.Millisecond - time.Duration(len(entries))*50*time.Millisecond)
+	}
+
+	// a polled twice per cycle
+	for i := 0; i < 4; i++ {
+		poll(a, a, b)
+	}
+	r := c.Report()
+	if !r.Learned || len(r.Schedule) != 3 {
+		t.Fatalf("got %s, want 3 entries learned", r.PrettyString())
+	}
+
+	poll(a, a, b)
+	poll(a, b)
+	poll(a, a, x, b)
+	poll(a, a, b)
+	r = c.Report()
+	if r.Skipped != 1 || r.Deviations != 1 || r.Relearned != 0 {
+		t.Errorf("got %s, want 1 skipped, 1 deviation", r.PrettyString())
+	}
+	if r.CycleTime.Min != 0.2 || r.CycleTime.Max != 0.2 {
+		t.Errorf("got cycle time %v, want 200ms", r.CycleTime)
+	}
+
+	// new schedule
+	for i := 0; i < 8; i++ {
+		poll(b, x)
+	}
+	r = c.Report()
+	if r.Relearned != 1 || len(r.Schedule) != 2 {
+		t.Errorf("got %s, want relearned with 2 entries", r.PrettyString())
+	}
+}
@@ -0,0 +1,96 @@
+package cycle
+
+import (
+	"fmt"
+
+	"github.com/andreaaizza/sniffer/util"
+)
+
+// Report the learned schedule and how the master keeps to it
+type Report struct {
+	// Learned false while the schedule is being learned
+	Learned  bool            `json:"learned"`
+	Schedule []ScheduleEntry `json:"schedule"`
+
+	// CycleTime time between the starts of consecutive cycles [seconds]
+	CycleTime Stats `json:"cycleTime"`
+	// Skipped entries of the schedule not requested in a cycle
+	Skipped uint64 `json:"skipped"`
+	// Deviations requests out of schedule
+	Deviations uint64 `json:"deviations"`
+	// Relearned times the schedule was learned again, as requests kept deviating
+	Relearned uint64 `json:"relearned"`
+
+	// ResponseShare share of the cycle time waiting for responses. Close to 1 slaves limit the cycle time,
+	// otherwise the master does.
+	ResponseShare float64 `json:"responseShare"`
+}
+
+// ScheduleEntry an entry of the schedule
+type ScheduleEntry struct {
+	Entry
+	// Offset time since the start of the cycle [seconds]
+	Offset Stats `json:"offset"`
+	// Latency of responses and exceptions [seconds]
+	Latency Stats  `json:"latency"`
+	Skipped uint64 `json:"skipped"`
+}
+
+// Stats of a duration [seconds]
+type Stats struct {
+	Count uint64  `json:"count"`
+	Last  float64 `json:"last"`
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	// Jitter standard deviation
+	Jitter float64 `json:"jitter"`
+}
+
+func (s *stats) snapshot() Stats {
+	return Stats{Count: s.n, Last: s.last, Mean: s.mean, Min: s.min, Max: s.max, Jitter: s.stddev()}
+}
+
+// Report returns the schedule learned so far, with statistics
+func (c *Cycle) Report() (r Report) {
+	if c == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	r.Learned = len(c.schedule) > 0
+	r.CycleTime = c.cycleTime.snapshot()
+	r.Skipped = c.skipped
+	r.Deviations = c.deviations
+	r.Relearned = c.relearned
+
+	waiting := 0.0
+	for _, e := range c.schedule {
+		r.Schedule = append(r.Schedule, ScheduleEntry{
+			Entry:   e.Entry,
+			Offset:  e.offset.snapshot(),
+			Latency: e.latency.snapshot(),
+			Skipped: e.skipped,
+		})
+		waiting += e.latency.mean
+	}
+	if r.CycleTime.Mean > 0 {
+		r.ResponseShare = waiting / r.CycleTime.Mean
+	}
+	return
+}
+
+func (r *Report) PrettyString() (s string) {
+	if !r.Learned {
+		return "cycle: learning\n"
+	}
+	s = fmt.Sprintf("cycle: %d entries, %d cycles, time: %v (min %v, max %v, jitter %v), skipped: %d, deviations: %d, relearned: %d, waiting responses: %.0f%%\n",
+		len(r.Schedule), r.CycleTime.Count, util.Seconds(r.CycleTime.Mean), util.Seconds(r.CycleTime.Min), util.Seconds(r.CycleTime.Max),
+		util.Seconds(r.CycleTime.Jitter), r.Skipped, r.Deviations, r.Relearned, 100*r.ResponseShare)
+	for _, e := range r.Schedule {
+		s += fmt.Sprintf("  +%v slave: %d, FC: %d, start: %d, quantity: %d, latency: %v, skipped: %d\n",
+			util.Seconds(e.Offset.Mean), e.Address, e.FunctionCode, e.Start, e.Quantity, util.Seconds(e.Latency.Mean), e.Skipped)
+	}
+	return
+}
@@ -2,10 +2,12 @@ package dissector
 
 import (
 	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/metrics"
 	"github.com/andreaaizza/sniffer/util"
 
 	"fmt"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -15,42 +17,75 @@ const (
 
 	// DissectorFlushAfterSecondsModbusRTU flush data if older than this [seconds]
 	DissectorFlushAfterSecondsModbusRTU = 5
+
+	// ReplyTimeoutModbusRTU a copy of a write request is its echoed response only if read within this time from it
+	ReplyTimeoutModbusRTU = time.Second
 )
 
+// ResultFilter tells which ADUs found a dissector returns: those for which Validate returns true
 type ResultFilter interface {
-	validate(r *Result) bool
+	Validate(r *Result) bool
 }
 
+// FilterOnlyModbusRequest passes requests
 type FilterOnlyModbusRequest struct{}
 
-func (f FilterOnlyModbusRequest) validate(r *Result) bool {
+func (f FilterOnlyModbusRequest) Validate(r *Result) bool {
 	return r.GetAdu().IsRequest()
 }
 
+// FilterOnlyModbusResponseOrException passes responses and exceptions
 type FilterOnlyModbusResponseOrException struct{}
 
-func (f FilterOnlyModbusResponseOrException) validate(r *Result) bool {
+func (f FilterOnlyModbusResponseOrException) Validate(r *Result) bool {
 	return r.GetAdu().IsResponse() || r.GetAdu().IsException()
 }
 
+// FilterAnyModbus passes any ADU
 type FilterAnyModbus struct{}
 
-func (f FilterAnyModbus) validate(r *Result) bool {
+func (f FilterAnyModbus) Validate(r *Result) bool {
 	return true
 }
 
+// Garbage a run of bytes which did not build any ADU: CRC errors, truncated or out of sync data
+type Garbage struct {
+	Port string
+	// Time of the first byte
+	Time time.Time
+	Data []byte
+}
+
+func (g *Garbage) PrettyString() string {
+	return fmt.Sprintf("GARBAGE [%s] %s %d bytes: %02X", g.Time.Format(time.RFC3339Nano), g.Port, len(g.Data), g.Data)
+}
+
 type Dissector struct {
 	DissectorBuffer
 	logger   *logger.Logger
-	Consumer chan logger.DataUnit
+	Consumer chan *logger.DataUnit
 
-	Producer chan Result
+	Producer chan *Result
 
 	stop chan struct{}
+	wg   sync.WaitGroup
 
 	flushDissectorAfterSeconds int
 
 	filter ResultFilter
+	// responsesOnly if the port only carries responses/exceptions, as filtered
+	responsesOnly bool
+	// requestsOnly if the port only carries requests, as filtered
+	requestsOnly bool
+	// lastRequest last request found, to tell its echo, and lastRequestIndex where it was in the buffer
+	lastRequest      *ADU
+	lastRequestIndex int
+
+	port    string
+	metrics *metrics.Metrics
+
+	garbageMux sync.Mutex
+	onGarbage  func(*Garbage)
 }
 
 // New builds new dissector and starts waiting for data.
@@ -64,32 +99,40 @@ func New(c *logger.Config, filter ResultFilter) (d *Dissector, err error) {
 
 	d = &Dissector{
 		DissectorBuffer: DissectorBuffer{},
-		Consumer:        make(chan logger.DataUnit),
+		Consumer:        make(chan *logger.DataUnit),
 		logger:          l,
 
-		Producer: make(chan Result),
+		Producer: make(chan *Result),
 
 		stop: make(chan struct{}, 0),
 
 		flushDissectorAfterSeconds: DissectorFlushAfterSecondsModbusRTU,
+
+		port:    c.Port,
+		metrics: c.Metrics,
 	}
 
 	// connect to logger
 	d.logger.Subscribe(d.GetConsumer())
 
 	// assign filter
-	d.filter = filter
+	d.setFilter(filter)
 
+	d.wg.Add(1)
 	go func() {
+		defer d.wg.Done()
 		for {
 			select {
 			case <-d.stop:
 				return
 			case du := <-d.Consumer:
-				d.loadDataUnit(&du)
+				d.loadDataUnit(du)
 
 				// dissect after each packet recevied
 				d.dissect()
+
+				// flush old data from DissectorBuffer
+				d.flushOldData()
 			}
 		}
 	}()
@@ -101,13 +144,54 @@ func New(c *logger.Config, filter ResultFilter) (d *Dissector, err error) {
 func (d *Dissector) Close() {
 	// close dissector
 	close(d.stop)
+	d.wg.Wait()
 
 	// close logger
 	d.logger.Close()
 }
 
+// Err returns the channel a failure of the underlying port is sent to
+func (d *Dissector) Err() <-chan error {
+	return d.logger.Err()
+}
+
+// OnGarbage sets f to be called with each run of bytes which did not build any ADU, on the dissector go routine, so
+// it should not block
+func (d *Dissector) OnGarbage(f func(*Garbage)) {
+	d.garbageMux.Lock()
+	defer d.garbageMux.Unlock()
+	d.onGarbage = f
+}
+
+// addInvalid accounts a run of bytes which did not build any ADU
+func (d *Dissector) addInvalid(run []*TimedByte) {
+	if len(run) == 0 {
+		return
+	}
+	d.metrics.AddInvalid(d.port, len(run))
+
+	d.garbageMux.Lock()
+	f := d.onGarbage
+	d.garbageMux.Unlock()
+	if f == nil {
+		return
+	}
+	g := &Garbage{Port: d.port, Time: util.TimeBuilder(run[0].GetTime()), Data: make([]byte, len(run))}
+	for i, tb := range run {
+		g.Data[i] = byte(tb.GetByte())
+	}
+	f(g)
+}
+
+// setFilter sets the filter of ADUs returned, and what the port carries
+func (d *Dissector) setFilter(filter ResultFilter) {
+	d.filter = filter
+	_, d.responsesOnly = filter.(FilterOnlyModbusResponseOrException)
+	_, d.requestsOnly = filter.(FilterOnlyModbusRequest)
+}
+
 // GetConsumer return the channel to send DataUnits to
-func (d *Dissector) GetConsumer() chan logger.DataUnit {
+func (d *Dissector) GetConsumer() chan *logger.DataUnit {
 	return d.Consumer
 }
 
@@ -122,63 +206,158 @@ func (d *Dissector) FlushResults() {
 
 // loadDataUnit pushes DataUnit to dissector
 func (d *Dissector) loadDataUnit(du *logger.DataUnit) {
+	// data before a gap cannot be part of an ADU with data after it
+	if du.GetGap() {
+		d.addInvalid(d.TimedBytes)
+		d.TimedBytes = d.TimedBytes[:0]
+	}
 	for _, dByte := range du.Data {
 		d.TimedBytes = append(d.TimedBytes, &TimedByte{Time: du.Time, Byte: uint32(dByte)})
 	}
 }
 
-// flushOldData flushes data if too old
+// flushOldData flushes data if too old. Flushed data never built a valid ADU, so it is accounted as invalid.
 func (d *Dissector) flushOldData() {
 	t := time.Now().UTC()
+	maxAge := time.Duration(d.flushDissectorAfterSeconds) * time.Second
 
 	// TimedBytes
-	for i := len(d.TimedBytes) - 1; i > 0; i-- {
-		td := util.TimeBuilder(d.TimedBytes[i].GetTime())
-		if t.After(td.Add(time.Duration(d.flushDissectorAfterSeconds) * time.Second)) {
-			d.removeTimedBytes(i, 1)
+	kept := d.TimedBytes[:0]
+	var run []*TimedByte
+	for _, tb := range d.TimedBytes {
+		if t.After(util.TimeBuilder(tb.GetTime()).Add(maxAge)) {
+			run = append(run, tb)
+			continue
 		}
+		d.addInvalid(run)
+		run = nil
+		kept = append(kept, tb)
 	}
+	d.addInvalid(run)
+	d.TimedBytes = kept
 }
 
-// dissect repeats single dissectRound
+// dissect pushes each ADU found to Producer
 func (d *Dissector) dissect() {
 	// needs to cycle because data is removed from buffer and buffer changes indexing order
 	for {
-		foundMatch := d.dissectRound()
-		if !foundMatch {
+		res := d.next()
+		if res == nil {
 			break
 		}
+		d.metrics.AddFrame(d.port, res.GetAdu().GetTimeTime())
 
-		// flush old data from DissectorBuffer and Results
-		d.flushOldData()
+		// push to output
+		select {
+		case d.Producer <- res:
+		case <-d.stop:
+		}
 
 		if d.Size() > DBMaxSizeWithoutNotify {
 			log.Printf("DissectorBuffer too big. Size=%d. Content: %s", d.Size(), d.PrettyString())
 		}
 	}
+	d.prune()
 }
 
-// tries finding req->resp couple, returns true if success
-func (d *Dissector) dissectRound() bool {
+// next finds the first valid ADU in buffer, removes it from buffer and returns it. Returns nil if none is found.
+func (d *Dissector) next() *Result {
 	// cycle thru each byte and search for a valid Request
 	for reqIndex, _ := range d.TimedBytes {
 		// try building ADU
 		if adu, err := NewADU(&d.DissectorBuffer, reqIndex); err == nil {
-			res := &Result{Adu: adu}
+			// the response to some writes is a copy of the request
+			if d.isEcho(adu, reqIndex) {
+				adu.toResponse()
+			}
+			res := &Result{Adu: adu, Port: d.port}
 			// validate
-			if d.filter.validate(res) {
-				// push to output
-				result := Result{Adu: res.GetAdu()}
-				d.Producer <- result
-
+			if d.filter.Validate(res) {
 				// remove relevant data from input
 				d.removeTimedBytes(reqIndex, res.GetAdu().Size())
 
-				return true
+				d.lastRequest = nil
+				if adu.IsRequest() {
+					d.lastRequest = adu
+					d.lastRequestIndex = reqIndex
+				}
+				return res
 			}
 		}
 	}
-	return false
+	return nil
+}
+
+// isEcho returns true if adu, built as a request at index of the buffer, is the response echoing a write request: on
+// a port carrying responses only, any echoed write; on a port carrying both, a copy of the last request read after
+// it, within ReplyTimeoutModbusRTU, or read together with it, right after it. Broadcasts are never answered, and a
+// master repeating a write is not answered by itself.
+func (d *Dissector) isEcho(adu *ADU, index int) bool {
+	if !adu.IsRequest() || !adu.GetPduRequest().isEchoed() || adu.GetAddress() == 0 || d.requestsOnly {
+		return false
+	}
+	if d.responsesOnly {
+		return true
+	}
+	if !adu.echoOf(d.lastRequest) {
+		return false
+	}
+	elapsed := adu.GetTimeTime().Sub(d.lastRequest.GetTimeTime())
+	if elapsed == 0 {
+		// bytes read together share the same time: the request was removed, its copy is now where it was
+		return index == d.lastRequestIndex
+	}
+	return elapsed > 0 && elapsed <= ReplyTimeoutModbusRTU
+}
+
+// prune removes data which cannot be part of any future ADU: when no ADU is found, only the last ADUMaxSize bytes
+// can still start one
+func (d *Dissector) prune() {
+	if n := d.Size() - ADUMaxSize; n > 0 {
+		d.addInvalid(d.TimedBytes[:n])
+		d.removeTimedBytes(0, n)
+	}
+}
+
+// Offline dissects DataUnits offline, e.g. data captured from port while scanning, as they are added
+type Offline struct {
+	d            *Dissector
+	total, valid int
+}
+
+// NewOffline creates an offline dissector of data read from port, returning ADUs passing filter
+func NewOffline(port string, filter ResultFilter) *Offline {
+	d := &Dissector{port: port}
+	d.setFilter(filter)
+	return &Offline{d: d}
+}
+
+// Add dissects dus, following those added before, and returns ADUs passing filter. ADUs not complete yet are returned
+// by a following Add.
+func (o *Offline) Add(dus []*logger.DataUnit) (results []*Result) {
+	for _, du := range dus {
+		o.d.loadDataUnit(du)
+		o.total += len(du.GetData())
+		for res := o.d.next(); res != nil; res = o.d.next() {
+			results = append(results, res)
+			o.valid += res.GetAdu().Size()
+		}
+		o.d.prune()
+	}
+	return
+}
+
+// InvalidBytes returns the number of bytes added which did not build any ADU, including those of ADUs not complete yet
+func (o *Offline) InvalidBytes() int {
+	return o.total - o.valid
+}
+
+// Dissect dissects DataUnits offline and returns ADUs passing filter.
+// Also returns the number of bytes which did not build any ADU.
+func Dissect(dus []*logger.DataUnit, port string, filter ResultFilter) (results []*Result, invalidBytes int) {
+	o := NewOffline(port, filter)
+	results = o.Add(dus)
+	return results, o.InvalidBytes()
 }
 
 // removeTimedBytes removes `size` data from buffer at `start` position
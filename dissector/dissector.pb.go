@@ -558,7 +558,8 @@ type Result struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Adu *ADU `protobuf:"bytes,1,opt,name=adu,proto3" json:"adu,omitempty"`
+	Adu  *ADU   `protobuf:"bytes,1,opt,name=adu,proto3" json:"adu,omitempty"`
+	Port string `protobuf:"bytes,2,opt,name=port,proto3" json:"port,omitempty"` // serial port the ADU was read from
 }
 
 func (x *Result) Reset() {
@@ -600,6 +601,13 @@ func (x *Result) GetAdu() *ADU {
 	return nil
 }
 
+func (x *Result) GetPort() string {
+	if x != nil {
+		return x.Port
+	}
+	return ""
+}
+
 var File_dissector_dissector_proto protoreflect.FileDescriptor
 
 var file_dissector_dissector_proto_rawDesc = []byte{
@@ -652,54 +660,55 @@ var file_dissector_dissector_proto_rawDesc = []byte{
 	0x52, 0x15, 0x66, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74,
 	0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x24, 0x0a, 0x0d, 0x65, 0x78, 0x63, 0x65, 0x70,
 	0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0d,
-	0x65, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x22, 0x2a, 0x0a,
+	0x65, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x22, 0x3e, 0x0a,
 	0x06, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x20, 0x0a, 0x03, 0x61, 0x64, 0x75, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x64, 0x69, 0x73, 0x73, 0x65, 0x63, 0x74, 0x6f, 0x72,
-	0x2e, 0x41, 0x44, 0x55, 0x52, 0x03, 0x61, 0x64, 0x75, 0x2a, 0x8a, 0x02, 0x0a, 0x0c, 0x46, 0x75,
-	0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x11, 0x0a, 0x0d, 0x46, 0x75,
-	0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x4e, 0x6f, 0x75, 0x73, 0x65, 0x10, 0x00, 0x12, 0x1e, 0x0a,
-	0x1a, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x61, 0x64, 0x49, 0x6e, 0x70,
-	0x75, 0x74, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x73, 0x10, 0x04, 0x12, 0x20, 0x0a,
-	0x1c, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x61, 0x64, 0x48, 0x6f, 0x6c,
-	0x64, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x73, 0x10, 0x03, 0x12,
-	0x1f, 0x0a, 0x1b, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x57, 0x72, 0x69, 0x74, 0x65,
-	0x53, 0x69, 0x6e, 0x67, 0x6c, 0x65, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x10, 0x06,
-	0x12, 0x22, 0x0a, 0x1e, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x57, 0x72, 0x69, 0x74,
-	0x65, 0x4d, 0x75, 0x6c, 0x74, 0x69, 0x70, 0x6c, 0x65, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65,
-	0x72, 0x73, 0x10, 0x10, 0x12, 0x26, 0x0a, 0x22, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65,
-	0x52, 0x65, 0x61, 0x64, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4d, 0x75, 0x6c, 0x74, 0x69, 0x70, 0x6c,
-	0x65, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x73, 0x10, 0x17, 0x12, 0x1d, 0x0a, 0x19,
-	0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x4d, 0x61, 0x73, 0x6b, 0x57, 0x72, 0x69, 0x74,
-	0x65, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x10, 0x16, 0x12, 0x19, 0x0a, 0x15, 0x46,
-	0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x61, 0x64, 0x46, 0x49, 0x46, 0x4f, 0x51,
-	0x75, 0x65, 0x75, 0x65, 0x10, 0x18, 0x2a, 0xfa, 0x02, 0x0a, 0x0d, 0x45, 0x78, 0x63, 0x65, 0x70,
-	0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x16, 0x0a, 0x12, 0x45, 0x78, 0x63, 0x65,
-	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x4e, 0x6f, 0x75, 0x73, 0x65, 0x10, 0x00,
-	0x12, 0x20, 0x0a, 0x1c, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64,
-	0x65, 0x49, 0x6c, 0x6c, 0x65, 0x67, 0x61, 0x6c, 0x46, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e,
-	0x10, 0x01, 0x12, 0x23, 0x0a, 0x1f, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43,
-	0x6f, 0x64, 0x65, 0x49, 0x6c, 0x6c, 0x65, 0x67, 0x61, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x41, 0x64,
-	0x64, 0x72, 0x65, 0x73, 0x73, 0x10, 0x02, 0x12, 0x21, 0x0a, 0x1d, 0x45, 0x78, 0x63, 0x65, 0x70,
-	0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x49, 0x6c, 0x6c, 0x65, 0x67, 0x61, 0x6c, 0x44,
-	0x61, 0x74, 0x61, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x10, 0x03, 0x12, 0x24, 0x0a, 0x20, 0x45, 0x78,
-	0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x53, 0x65, 0x72, 0x76, 0x65,
-	0x72, 0x44, 0x65, 0x76, 0x69, 0x63, 0x65, 0x46, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x10, 0x04,
-	0x12, 0x1c, 0x0a, 0x18, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64,
-	0x65, 0x41, 0x63, 0x6b, 0x6e, 0x6f, 0x77, 0x6c, 0x65, 0x64, 0x67, 0x65, 0x10, 0x05, 0x12, 0x21,
-	0x0a, 0x1d, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x53,
-	0x65, 0x72, 0x76, 0x65, 0x72, 0x44, 0x65, 0x76, 0x69, 0x63, 0x65, 0x42, 0x75, 0x73, 0x79, 0x10,
-	0x06, 0x12, 0x22, 0x0a, 0x1e, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f,
-	0x64, 0x65, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x50, 0x61, 0x72, 0x69, 0x74, 0x79, 0x45, 0x72,
-	0x72, 0x6f, 0x72, 0x10, 0x08, 0x12, 0x27, 0x0a, 0x23, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69,
-	0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x47, 0x61, 0x74, 0x65, 0x77, 0x61, 0x79, 0x50, 0x61, 0x74,
-	0x68, 0x55, 0x6e, 0x61, 0x76, 0x61, 0x69, 0x6c, 0x61, 0x62, 0x6c, 0x65, 0x10, 0x0a, 0x12, 0x33,
-	0x0a, 0x2f, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x47,
-	0x61, 0x74, 0x65, 0x77, 0x61, 0x79, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x44, 0x65, 0x76, 0x69,
-	0x63, 0x65, 0x46, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x54, 0x6f, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
-	0x64, 0x10, 0x0b, 0x42, 0x2a, 0x5a, 0x28, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f,
-	0x6d, 0x2f, 0x61, 0x6e, 0x64, 0x72, 0x65, 0x61, 0x61, 0x69, 0x7a, 0x7a, 0x61, 0x2f, 0x73, 0x6e,
-	0x69, 0x66, 0x66, 0x65, 0x72, 0x2f, 0x64, 0x69, 0x73, 0x73, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x62,
-	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x2e, 0x41, 0x44, 0x55, 0x52, 0x03, 0x61, 0x64, 0x75, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72,
+	0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x2a, 0x8a, 0x02,
+	0x0a, 0x0c, 0x46, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x11,
+	0x0a, 0x0d, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x4e, 0x6f, 0x75, 0x73, 0x65, 0x10,
+	0x00, 0x12, 0x1e, 0x0a, 0x1a, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x61,
+	0x64, 0x49, 0x6e, 0x70, 0x75, 0x74, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x73, 0x10,
+	0x04, 0x12, 0x20, 0x0a, 0x1c, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x61,
+	0x64, 0x48, 0x6f, 0x6c, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72,
+	0x73, 0x10, 0x03, 0x12, 0x1f, 0x0a, 0x1b, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x57,
+	0x72, 0x69, 0x74, 0x65, 0x53, 0x69, 0x6e, 0x67, 0x6c, 0x65, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74,
+	0x65, 0x72, 0x10, 0x06, 0x12, 0x22, 0x0a, 0x1e, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65,
+	0x57, 0x72, 0x69, 0x74, 0x65, 0x4d, 0x75, 0x6c, 0x74, 0x69, 0x70, 0x6c, 0x65, 0x52, 0x65, 0x67,
+	0x69, 0x73, 0x74, 0x65, 0x72, 0x73, 0x10, 0x10, 0x12, 0x26, 0x0a, 0x22, 0x46, 0x75, 0x6e, 0x63,
+	0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x61, 0x64, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4d, 0x75, 0x6c,
+	0x74, 0x69, 0x70, 0x6c, 0x65, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x73, 0x10, 0x17,
+	0x12, 0x1d, 0x0a, 0x19, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x4d, 0x61, 0x73, 0x6b,
+	0x57, 0x72, 0x69, 0x74, 0x65, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x10, 0x16, 0x12,
+	0x19, 0x0a, 0x15, 0x46, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x61, 0x64, 0x46,
+	0x49, 0x46, 0x4f, 0x51, 0x75, 0x65, 0x75, 0x65, 0x10, 0x18, 0x2a, 0xfa, 0x02, 0x0a, 0x0d, 0x45,
+	0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x16, 0x0a, 0x12,
+	0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x4e, 0x6f, 0x75,
+	0x73, 0x65, 0x10, 0x00, 0x12, 0x20, 0x0a, 0x1c, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f,
+	0x6e, 0x43, 0x6f, 0x64, 0x65, 0x49, 0x6c, 0x6c, 0x65, 0x67, 0x61, 0x6c, 0x46, 0x75, 0x6e, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x10, 0x01, 0x12, 0x23, 0x0a, 0x1f, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x49, 0x6c, 0x6c, 0x65, 0x67, 0x61, 0x6c, 0x44, 0x61,
+	0x74, 0x61, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x10, 0x02, 0x12, 0x21, 0x0a, 0x1d, 0x45,
+	0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x49, 0x6c, 0x6c, 0x65,
+	0x67, 0x61, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x10, 0x03, 0x12, 0x24,
+	0x0a, 0x20, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x53,
+	0x65, 0x72, 0x76, 0x65, 0x72, 0x44, 0x65, 0x76, 0x69, 0x63, 0x65, 0x46, 0x61, 0x69, 0x6c, 0x75,
+	0x72, 0x65, 0x10, 0x04, 0x12, 0x1c, 0x0a, 0x18, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f,
+	0x6e, 0x43, 0x6f, 0x64, 0x65, 0x41, 0x63, 0x6b, 0x6e, 0x6f, 0x77, 0x6c, 0x65, 0x64, 0x67, 0x65,
+	0x10, 0x05, 0x12, 0x21, 0x0a, 0x1d, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43,
+	0x6f, 0x64, 0x65, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x44, 0x65, 0x76, 0x69, 0x63, 0x65, 0x42,
+	0x75, 0x73, 0x79, 0x10, 0x06, 0x12, 0x22, 0x0a, 0x1e, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69,
+	0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x50, 0x61, 0x72, 0x69,
+	0x74, 0x79, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x10, 0x08, 0x12, 0x27, 0x0a, 0x23, 0x45, 0x78, 0x63,
+	0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x47, 0x61, 0x74, 0x65, 0x77, 0x61,
+	0x79, 0x50, 0x61, 0x74, 0x68, 0x55, 0x6e, 0x61, 0x76, 0x61, 0x69, 0x6c, 0x61, 0x62, 0x6c, 0x65,
+	0x10, 0x0a, 0x12, 0x33, 0x0a, 0x2f, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x43,
+	0x6f, 0x64, 0x65, 0x47, 0x61, 0x74, 0x65, 0x77, 0x61, 0x79, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74,
+	0x44, 0x65, 0x76, 0x69, 0x63, 0x65, 0x46, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x54, 0x6f, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x64, 0x10, 0x0b, 0x42, 0x2a, 0x5a, 0x28, 0x67, 0x69, 0x74, 0x68, 0x75,
+	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x6e, 0x64, 0x72, 0x65, 0x61, 0x61, 0x69, 0x7a, 0x7a,
+	0x61, 0x2f, 0x73, 0x6e, 0x69, 0x66, 0x66, 0x65, 0x72, 0x2f, 0x64, 0x69, 0x73, 0x73, 0x65, 0x63,
+	0x74, 0x6f, 0x72, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -0,0 +1,168 @@
+package dissector
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/util"
+)
+
+func TestGarbage(t *testing.T) {
+	d := &Dissector{filter: FilterAnyModbus{}, port: "/dev/ttyUSB0", flushDissectorAfterSeconds: 5}
+	var garbage []*Garbage
+	d.OnGarbage(func(g *Garbage) { garbage = append(garbage, g) })
+
+	old := time.Now().Add(-10 * time.Second)
+	ts := util.TimestampBuilder(old)
+	// garbage, then a request
+	d.loadDataUnit(&logger.DataUnit{Time: &ts, Data: []byte{0xFF, 0xFE, 0x02, 0x03, 0x10, 0x00, 0x00, 0x02, 0xC0, 0xF8}})
+	if r := d.next(); !r.GetAdu().IsRequest() {
+		t.Fatalf("got %v, want request", r)
+	}
+	d.flushOldData()
+	if len(garbage) != 1 || !bytes.Equal(garbage[0].Data, []byte{0xFF, 0xFE}) || !garbage[0].Time.Equal(old) {
+		t.Errorf("got garbage %v", garbage)
+	}
+	if d.Size() != 0 {
+		t.Errorf("got %d bytes left", d.Size())
+	}
+}
+
+// withCRC returns b followed by its CRC
+func withCRC(b ...byte) []byte {
+	crc := calcCRC(b)
+	return append(b, byte(crc), byte(crc>>8))
+}
+
+func buffer(b []byte) *DissectorBuffer {
+	db := &DissectorBuffer{}
+	for _, c := range b {
+		db.TimedBytes = append(db.TimedBytes, &TimedByte{Byte: uint32(c)})
+	}
+	return db
+}
+
+func TestAduWriteRequestSize(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want int
+	}{
+		{"FC15", withCRC(0x02, 0x0F, 0x00, 0x10, 0x00, 0x03, 0x01, 0x05), 10},
+		{"FC16", withCRC(0x02, 0x10, 0x00, 0x00, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02), 13},
+		{"FC16 without byte count yet", []byte{0x02, 0x10, 0x00, 0x00, 0x00, 0x02}, 0},
+		{"FC22", withCRC(0x02, 0x16, 0x00, 0x00, 0x00, 0xF2, 0x00, 0x25), 10},
+		{"FC23", withCRC(0x02, 0x17, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x01, 0x02, 0x00, 0xAA), 15},
+		{"FC23 without byte count yet", []byte{0x02, 0x17, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x01}, 0},
+		{"FC3", withCRC(0x02, 0x03, 0x10, 0x00, 0x00, 0x02), 0},
+	}
+	for _, tt := range tests {
+		if got := aduWriteRequestSize(buffer(tt.b), 0); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+		if tt.want == 0 {
+			continue
+		}
+		if adu, err := NewADU(buffer(tt.b), 0); err != nil || !adu.IsRequest() || adu.Size() != tt.want {
+			t.Errorf("%s: got %v, %v, want a request of %d bytes", tt.name, adu, err, tt.want)
+		}
+	}
+}
+
+func TestEchoOf(t *testing.T) {
+	build := func(b []byte) *ADU {
+		adu, err := NewADU(buffer(b), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return adu
+	}
+	write := build(withCRC(0x02, 0x06, 0x00, 0x01, 0x12, 0x34))
+	for fc, want := range map[uint32]bool{5: true, 6: true, 22: true, 3: false, 15: false, 16: false, 23: false} {
+		if got := (&PDURequest{FunctionCode: fc}).isEchoed(); got != want {
+			t.Errorf("FC%d: got echoed %v, want %v", fc, got, want)
+		}
+	}
+
+	if !build(withCRC(0x02, 0x06, 0x00, 0x01, 0x12, 0x34)).echoOf(write) {
+		t.Error("got no echo of a copy")
+	}
+	if build(withCRC(0x02, 0x06, 0x00, 0x01, 0x12, 0x35)).echoOf(write) {
+		t.Error("got echo of another value")
+	}
+	if build(withCRC(0x03, 0x06, 0x00, 0x01, 0x12, 0x34)).echoOf(write) {
+		t.Error("got echo of another slave")
+	}
+	if write.echoOf(nil) {
+		t.Error("got echo of no request")
+	}
+
+	echo := build(withCRC(0x02, 0x06, 0x00, 0x01, 0x12, 0x34))
+	echo.toResponse()
+	if !echo.IsResponse() || echo.GetPduResponse().GetFunctionCode() != 6 || echo.Size() != write.Size() {
+		t.Errorf("got %s, want the response", echo.PrettyString())
+	}
+}
+
+func TestWriteMultipleResponse(t *testing.T) {
+	// 8 bytes FC15/16 are the response: address and quantity written
+	for _, b := range [][]byte{
+		withCRC(0x02, 0x10, 0x00, 0x00, 0x00, 0x02),
+		withCRC(0x02, 0x0F, 0x00, 0x10, 0x00, 0x03),
+	} {
+		adu, err := NewADU(buffer(b), 0)
+		if err != nil || !adu.IsResponse() || adu.Size() != ADUSizePDURequest {
+			t.Errorf("%02X: got %v, %v, want a response", b, adu, err)
+		}
+	}
+}
+
+func TestEcho(t *testing.T) {
+	write := withCRC(0x02, 0x06, 0x00, 0x01, 0x12, 0x34)
+	broadcast := withCRC(0x00, 0x06, 0x00, 0x01, 0x12, 0x34)
+	t0 := time.Date(2020, 9, 14, 8, 45, 54, 0, time.UTC)
+	type frame struct {
+		after time.Duration
+		data  []byte
+	}
+	tests := []struct {
+		name   string
+		filter ResultFilter
+		frames []frame
+		// want R for requests, r for responses, and invalid bytes
+		want    string
+		invalid int
+	}{
+		{"echoed", FilterAnyModbus{}, []frame{{0, write}, {50 * time.Millisecond, write}}, "Rr", 0},
+		{"repeated, not answered", FilterAnyModbus{}, []frame{{0, write}, {2 * time.Second, write}}, "RR", 0},
+		{"repeated and echoed", FilterAnyModbus{}, []frame{{0, write}, {50 * time.Millisecond, write},
+			{100 * time.Millisecond, write}, {150 * time.Millisecond, write}}, "RrRr", 0},
+		{"read together", FilterAnyModbus{}, []frame{{0, append(append([]byte{}, write...), write...)}}, "Rr", 0},
+		{"read together, not following", FilterAnyModbus{},
+			[]frame{{0, append(append(append([]byte{}, write...), 0xFF), write...)}}, "RR", 1},
+		{"broadcast", FilterAnyModbus{}, []frame{{0, broadcast}, {50 * time.Millisecond, broadcast}}, "RR", 0},
+		{"requests only", FilterOnlyModbusRequest{}, []frame{{0, write}, {50 * time.Millisecond, write}}, "RR", 0},
+		{"responses only", FilterOnlyModbusResponseOrException{}, []frame{{0, write}}, "r", 0},
+	}
+	for _, tt := range tests {
+		var dus []*logger.DataUnit
+		for _, f := range tt.frames {
+			ts := util.TimestampBuilder(t0.Add(f.after))
+			dus = append(dus, &logger.DataUnit{Time: &ts, Data: f.data})
+		}
+		results, invalid := Dissect(dus, "/dev/ttyUSB0", tt.filter)
+		got := ""
+		for _, r := range results {
+			if r.GetAdu().IsRequest() {
+				got += "R"
+			} else if r.GetAdu().IsResponse() {
+				got += "r"
+			}
+		}
+		if got != tt.want || invalid != tt.invalid {
+			t.Errorf("%s: got %s, %d invalid bytes, want %s, %d", tt.name, got, invalid, tt.want, tt.invalid)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package dissector
 
 import (
+	"bytes"
 	fmt "fmt"
 	"time"
 
@@ -16,6 +17,9 @@ const (
 
 	// ADUSizePDUResponseException size in bytes of a PDU exception
 	ADUSizePDUResponseException int = 5
+
+	// ADUMaxSize maximum size of an ADU in bytes, as built by NewADU: response with 255 bytes of data
+	ADUMaxSize int = 5 + 255
 )
 
 // NewADU builds an ADU from DissectorBuffer at position index. Returns err==nil on success
@@ -50,9 +54,30 @@ func NewADU(db *DissectorBuffer, index int) (adu *ADU, err error) {
 	adu.Time = db.TimedBytes[index].GetTime()
 
 	if adu.IsRequest() {
+		if fc := pduRequest.GetFunctionCode(); fc == 15 || fc == 16 {
+			// write multiple requests are longer: 8 bytes are the response, with address and quantity written
+			adu.PDU = &ADU_PduResponse{PduResponse: &PDUResponse{FunctionCode: fc, Data: bytesData}}
+		}
 		return
 	}
 
+	// try building a write request with values
+	// 02 10 0000 0002 04 00010002 CRC
+	if size := aduWriteRequestSize(db, index); size > 0 && index+size <= db.Size() {
+		if bytesData, err = db.bytes(index+2, size-4); err != nil {
+			return
+		}
+		adu.PDU = &ADU_PduRequest{PduRequest: &PDURequest{
+			FunctionCode: db.TimedBytes[index+1].GetByte(),
+			Data:         bytesData}}
+		if err = adu.setCRC(db, index+size-2); err != nil {
+			return
+		}
+		if adu.IsRequest() {
+			return
+		}
+	}
+
 	// try building response
 	// 02040000000A703E 0204148003800380018001800180030037800380038003901F
 	// 02 04 14 8003800380018001800180030037800380038003 901F
@@ -124,6 +149,151 @@ func (adu *ADU) IsException() bool {
 		adu.GetPduResponseException().GetFunctionExceptionCode()&0x80 == 0x80
 }
 
+// StartAddress returns the first coil/input/register address requested, for function codes 1 to 6, 15, 16 and 22.
+// For read/write multiple registers (23) the first read.
+func (pdu *PDURequest) StartAddress() uint32 {
+	d := pdu.GetData()
+	if len(d) < 2 {
+		return 0
+	}
+	return uint32(d[0])<<8 | uint32(d[1])
+}
+
+// Quantity returns the number of coils/inputs/registers requested, for function codes 1 to 6, 15, 16 and 22.
+// For read/write multiple registers (23) the number read. 0 if unknown.
+func (pdu *PDURequest) Quantity() uint32 {
+	d := pdu.GetData()
+	switch pdu.GetFunctionCode() {
+	case 1, 2, 3, 4, 15, 16, 23:
+		if len(d) < 4 {
+			return 0
+		}
+		return uint32(d[2])<<8 | uint32(d[3])
+	case 5, 6, 22:
+		return 1
+	}
+	return 0
+}
+
+// IsWrite returns true for requests writing coils or registers: function codes 5, 6, 15, 16, 22 and 23
+func (pdu *PDURequest) IsWrite() bool {
+	switch pdu.GetFunctionCode() {
+	case 5, 6, 15, 16, 22, 23:
+		return true
+	}
+	return false
+}
+
+// WriteRange returns the first coil/register address written and how many, 0, 0 if not a write
+func (pdu *PDURequest) WriteRange() (start uint32, quantity uint32) {
+	d := pdu.GetData()
+	switch pdu.GetFunctionCode() {
+	case 5, 6, 15, 16, 22:
+		return pdu.StartAddress(), pdu.Quantity()
+	case 23:
+		if len(d) >= 8 {
+			return uint32(d[4])<<8 | uint32(d[5]), uint32(d[6])<<8 | uint32(d[7])
+		}
+	}
+	return 0, 0
+}
+
+// WriteValues returns the values written, 0 or 1 for coils. Nil if not a write, if invalid, and for mask write
+// register (22), see WriteMasks.
+func (pdu *PDURequest) WriteValues() (values []uint32) {
+	d := pdu.GetData()
+	_, quantity := pdu.WriteRange()
+	switch pdu.GetFunctionCode() {
+	case 5:
+		// address, 0xFF00 on or 0x0000 off
+		switch {
+		case len(d) < 4:
+		case d[2] == 0xFF && d[3] == 0x00:
+			return []uint32{1}
+		case d[2] == 0x00 && d[3] == 0x00:
+			return []uint32{0}
+		}
+	case 6:
+		// address, value
+		if len(d) >= 4 {
+			return []uint32{uint32(d[2])<<8 | uint32(d[3])}
+		}
+	case 15:
+		// start, quantity, byte count, bits LSB first
+		if len(d) < 5 || int(d[4]) != len(d)-5 || uint32(d[4]) != (quantity+7)/8 {
+			return nil
+		}
+		for i := uint32(0); i < quantity; i++ {
+			values = append(values, uint32(d[5+i/8]>>(i%8))&1)
+		}
+	case 16, 23:
+		// start, quantity, byte count, registers. FC23 starts with read start and quantity.
+		if pdu.GetFunctionCode() == 23 {
+			d = d[4:]
+		}
+		if len(d) < 5 || int(d[4]) != len(d)-5 || uint32(d[4]) != 2*quantity {
+			return nil
+		}
+		for i := 5; i+1 < len(d); i += 2 {
+			values = append(values, uint32(d[i])<<8|uint32(d[i+1]))
+		}
+	}
+	return
+}
+
+// WriteMasks returns the AND and OR masks of a mask write register (22): the register becomes
+// (value AND and) OR (or AND NOT and). ok is false if not one.
+func (pdu *PDURequest) WriteMasks() (and uint32, or uint32, ok bool) {
+	d := pdu.GetData()
+	if pdu.GetFunctionCode() != 22 || len(d) < 6 {
+		return 0, 0, false
+	}
+	return uint32(d[2])<<8 | uint32(d[3]), uint32(d[4])<<8 | uint32(d[5]), true
+}
+
+// isEchoed returns true for requests answered with a copy of the request: write single coil/register, mask
+// write register
+func (pdu *PDURequest) isEchoed() bool {
+	switch pdu.GetFunctionCode() {
+	case 5, 6, 22:
+		return true
+	}
+	return false
+}
+
+// echoOf returns true if adu is a copy of request req
+func (adu *ADU) echoOf(req *ADU) bool {
+	return req != nil && adu.GetAddress() == req.GetAddress() && adu.GetCrc16() == req.GetCrc16() &&
+		adu.GetPduRequest().GetFunctionCode() == req.GetPduRequest().GetFunctionCode() &&
+		bytes.Equal(adu.GetPduRequest().GetData(), req.GetPduRequest().GetData())
+}
+
+// toResponse turns a request into the response which echoes it
+func (adu *ADU) toResponse() {
+	pdu := adu.GetPduRequest()
+	adu.PDU = &ADU_PduResponse{PduResponse: &PDUResponse{FunctionCode: pdu.GetFunctionCode(), Data: pdu.GetData()}}
+}
+
+// aduWriteRequestSize size in bytes of a write request ADU with values at index, 0 if not one or not known yet
+func aduWriteRequestSize(db *DissectorBuffer, index int) int {
+	switch db.TimedBytes[index+1].GetByte() {
+	case 15, 16:
+		// address, function code, start, quantity, byte count, values, CRC
+		if index+6 < db.Size() {
+			return 9 + int(db.TimedBytes[index+6].GetByte())
+		}
+	case 22:
+		// address, function code, reference address, AND mask, OR mask, CRC
+		return 10
+	case 23:
+		// address, function code, read start, read quantity, write start, write quantity, byte count, values, CRC
+		if index+10 < db.Size() {
+			return 13 + int(db.TimedBytes[index+10].GetByte())
+		}
+	}
+	return 0
+}
+
 // aduPDUResponseSizeFromDataLen size in bytes of a Response ADU, calculated from Data Len size
 func aduPDUResponseSizeFromDataLen(l int) int {
 	// 02040000000A703E 0204148003800380018001800180030037800380038003901F
@@ -139,10 +309,10 @@ func aduPDUResponseSizeFromDataLen(l int) int {
 func (adu *ADU) Size() int {
 	if adu.GetPduResponseException() != nil {
 		return ADUSizePDUResponseException
-	} else if adu.GetPduRequest() != nil {
-		return ADUSizePDURequest
+	} else if pduRequest := adu.GetPduRequest(); pduRequest != nil {
+		return 4 + len(pduRequest.GetData())
 	} else if pduResponse := adu.GetPduResponse(); pduResponse != nil {
-		return 5 + int(pduResponse.Data[0])
+		return 4 + len(pduResponse.GetData())
 	}
 	return 0
 }
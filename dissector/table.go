@@ -0,0 +1,75 @@
+package dissector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table Modbus data table
+type Table int
+
+const (
+	TableNone Table = iota
+	TableCoils
+	TableDiscreteInputs
+	TableHoldingRegisters
+	TableInputRegisters
+)
+
+var tableNames = map[Table]string{
+	TableCoils:            "coils",
+	TableDiscreteInputs:   "discreteInputs",
+	TableHoldingRegisters: "holdingRegisters",
+	TableInputRegisters:   "inputRegisters",
+}
+
+func (t Table) String() string {
+	if s, ok := tableNames[t]; ok {
+		return s
+	}
+	return "none"
+}
+
+// IsRegister returns true for tables of 16 bit registers, false for tables of bits
+func (t Table) IsRegister() bool {
+	return t == TableHoldingRegisters || t == TableInputRegisters
+}
+
+// ParseTable parses a table name, as returned by Table.String(). Singular and short names are accepted too,
+// e.g. "coil", "discrete", "holding", "input", case insensitive.
+func ParseTable(s string) (Table, error) {
+	s = strings.ToLower(s)
+	for _, t := range []Table{TableCoils, TableDiscreteInputs, TableHoldingRegisters, TableInputRegisters} {
+		name := strings.ToLower(t.String())
+		if s == name || strings.HasPrefix(name, s) && len(s) >= 4 {
+			return t, nil
+		}
+	}
+	return TableNone, fmt.Errorf("unknown table %q", s)
+}
+
+// TableOf returns the table a function code reads or writes, TableNone if none
+func TableOf(functionCode uint32) Table {
+	switch functionCode {
+	case 1, 5, 15:
+		return TableCoils
+	case 2:
+		return TableDiscreteInputs
+	case 3, 6, 16, 22, 23:
+		return TableHoldingRegisters
+	case 4:
+		return TableInputRegisters
+	}
+	return TableNone
+}
+
+// MarshalText encodes the table as its name, e.g. in JSON
+func (t Table) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a table name, see ParseTable
+func (t *Table) UnmarshalText(b []byte) (err error) {
+	*t, err = ParseTable(string(b))
+	return
+}
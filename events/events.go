@@ -0,0 +1,155 @@
+package events
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/processimage"
+	"github.com/andreaaizza/sniffer/regmap"
+)
+
+// Event a value which changed: a register map point beyond its deadband, or a coil or discrete input which flipped
+type Event struct {
+	Time    time.Time       `json:"time"`
+	Slave   uint32          `json:"slave"`
+	Table   dissector.Table `json:"table"`
+	Address uint32          `json:"address"`
+	// Device and Name of the register map point, empty for coils and discrete inputs
+	Device string `json:"device,omitempty"`
+	Name   string `json:"name,omitempty"`
+
+	// Old value last reported, New value
+	Old float64 `json:"old"`
+	New float64 `json:"new"`
+	// OldText and NewText of strings and bitfields
+	OldText string `json:"oldText,omitempty"`
+	NewText string `json:"newText,omitempty"`
+	Unit    string `json:"unit,omitempty"`
+
+	// Initial first value of a register map point, Old is not known
+	Initial bool `json:"initial,omitempty"`
+}
+
+func (e *Event) PrettyString() string {
+	name := fmt.Sprintf("%02X %s %d", e.Slave, e.Table, e.Address)
+	if e.Device != "" {
+		name += " " + e.Device + "." + e.Name
+	} else if e.Name != "" {
+		name += " " + e.Name
+	}
+	ts := e.Time.Format(time.RFC3339Nano)
+	switch {
+	case e.Initial && (e.NewText != "" || e.OldText != ""):
+		return fmt.Sprintf("[%s] %s: %q", ts, name, e.NewText)
+	case e.Initial:
+		return fmt.Sprintf("[%s] %s: %g%s", ts, name, e.New, e.Unit)
+	case e.NewText != "" || e.OldText != "":
+		return fmt.Sprintf("[%s] %s: %q -> %q", ts, name, e.OldText, e.NewText)
+	}
+	return fmt.Sprintf("[%s] %s: %g -> %g%s", ts, name, e.Old, e.New, e.Unit)
+}
+
+// Deadband a change is reported if larger than Absolute and than Percent of the last value reported.
+// Zero reports any change.
+type Deadband struct {
+	Absolute float64 `json:"absolute"`
+	Percent  float64 `json:"percent"`
+}
+
+// exceeded returns true if the change from old to new is beyond the deadband
+func (d Deadband) exceeded(old, new float64) bool {
+	change := math.Abs(new - old)
+	return change > 0 && change > d.Absolute && change > d.Percent/100*math.Abs(old)
+}
+
+type pointKey struct {
+	slave uint32
+	name  string
+}
+
+// Detector turns results into change events. Deadbands of register map points are configured in the map,
+// points without any use the default one. All methods are safe for concurrent use.
+type Detector struct {
+	regmap   *regmap.Map
+	deadband Deadband
+
+	mux sync.Mutex
+	// image of coils and discrete inputs
+	image *processimage.ProcessImage
+	// last values reported of register map points
+	last map[pointKey]*regmap.Value
+}
+
+// New creates a detector of changes of the points of m, with deadband the default one. m can be nil, to detect
+// only coils and discrete inputs flipping.
+func New(m *regmap.Map, deadband Deadband) *Detector {
+	return &Detector{
+		regmap:   m,
+		deadband: deadband,
+		image:    processimage.New(),
+		last:     make(map[pointKey]*regmap.Value),
+	}
+}
+
+// Add returns events for the values of a result which changed, use as Sniffer.OnResult() callback
+func (d *Detector) Add(r *sniffer.Result) (events []*Event) {
+	req, rsp := r.GetRequest().GetAdu(), r.GetResponse().GetAdu()
+	t := rsp.GetTimeTime()
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	// coils and discrete inputs
+	if table := dissector.TableOf(req.GetPduRequest().GetFunctionCode()); table == dissector.TableCoils ||
+		table == dissector.TableDiscreteInputs {
+		for _, c := range d.image.Update(req, rsp) {
+			events = append(events, &Event{
+				Time:    t,
+				Slave:   c.Slave,
+				Table:   c.Table,
+				Address: c.Address,
+				Old:     float64(c.Old),
+				New:     float64(c.Value),
+			})
+		}
+	}
+
+	// register map points
+	for _, v := range r.GetValues() {
+		p := d.regmap.Point(v.GetSlave(), v.GetName())
+		if p == nil {
+			continue
+		}
+		k := pointKey{slave: v.GetSlave(), name: v.GetName()}
+		last, ok := d.last[k]
+		db := d.deadband
+		if p.Deadband != 0 || p.DeadbandPercent != 0 {
+			db = Deadband{Absolute: p.Deadband, Percent: p.DeadbandPercent}
+		}
+		if ok && last.GetText() == v.GetText() && !db.exceeded(last.GetNumber(), v.GetNumber()) {
+			continue
+		}
+		d.last[k] = v
+		e := &Event{
+			Time:    t,
+			Slave:   v.GetSlave(),
+			Table:   p.Table,
+			Address: v.GetAddress(),
+			Device:  v.GetDevice(),
+			Name:    v.GetName(),
+			New:     v.GetNumber(),
+			NewText: v.GetText(),
+			Unit:    v.GetUnit(),
+			Initial: !ok,
+		}
+		if ok {
+			e.Old, e.OldText = last.GetNumber(), last.GetText()
+		}
+		events = append(events, e)
+	}
+	return
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+	"github.com/andreaaizza/sniffer/regmap"
+	"github.com/andreaaizza/sniffer/util"
+)
+
+func TestDetector(t *testing.T) {
+	m, err := regmap.Parse([]byte(`
+devices:
+  - slave: 2
+    points:
+      - {name: voltage, table: input, address: 0, type: int16, deadband: 2}
+      - {name: current, table: input, address: 1, type: int16}
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(m, Deadband{Percent: 10})
+
+	// register map points
+	t0 := time.Date(2020, 9, 14, 8, 45, 54, 0, time.UTC)
+	at := func(i int) *dissector.Result {
+		ts := util.TimestampBuilder(t0.Add(time.Duration(i) * time.Second))
+		return &dissector.Result{Adu: &dissector.ADU{Time: &ts}}
+	}
+	var got []*Event
+	for i, v := range [][2]float64{{230, 10}, {231, 10.5}, {233, 11}, {233, 12.2}} {
+		got = append(got, d.Add(&sniffer.Result{Request: at(i), Response: at(i), Values: []*regmap.Value{
+			{Slave: 2, Name: "voltage", Address: 0, Number: v[0]},
+			{Slave: 2, Name: "current", Address: 1, Number: v[1]},
+		}})...)
+	}
+	want := []string{
+		"[2020-09-14T08:45:54Z] 02 inputRegisters 0 voltage: 230",
+		"[2020-09-14T08:45:54Z] 02 inputRegisters 1 current: 10",
+		"[2020-09-14T08:45:56Z] 02 inputRegisters 0 voltage: 230 -> 233",
+		"[2020-09-14T08:45:57Z] 02 inputRegisters 1 current: 10 -> 12.2",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d", len(got), len(want))
+	}
+	for i, e := range got {
+		if e.PrettyString() != want[i] {
+			t.Errorf("got %s, want %s", e.PrettyString(), want[i])
+		}
+	}
+
+	// coils
+	req1 := []byte{0x02, 0x01, 0x00, 0x10, 0x00, 0x0A, 0xBD, 0xFB}
+	rsp1 := []byte{0x02, 0x01, 0x02, 0x05, 0x02, 0x7F, 0x6D}
+	rsp1b := []byte{0x02, 0x01, 0x02, 0x04, 0x02, 0x7E, 0xFD}
+	results := sniffertest.Dissect(t, "port", sniffertest.Every(time.Second, req1, rsp1, req1, rsp1b, req1))
+	got = nil
+	for i := 0; i+1 < len(results); i += 2 {
+		got = append(got, d.Add(&sniffer.Result{Request: results[i], Response: results[i+1]})...)
+	}
+	if len(got) != 1 || got[0].Table != dissector.TableCoils || got[0].Address != 0x10 || got[0].Old != 1 || got[0].New != 0 {
+		t.Errorf("got %d events, want coil 16 flipped from 1 to 0", len(got))
+	}
+}
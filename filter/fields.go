@@ -0,0 +1,165 @@
+package filter
+
+import (
+	"github.com/andreaaizza/sniffer/dissector"
+)
+
+// kind of values of a field, and of the literals it can be compared to
+type kind int
+
+const (
+	kindNumber kind = iota
+	kindDuration
+	kindString
+	// kindBool fields can only be tested, e.g. "write" or "!write"
+	kindBool
+)
+
+// interval of numbers, a single number if lo == hi
+type interval struct {
+	lo, hi float64
+}
+
+// frame what a filter is evaluated on: a request and its response, or a single ADU
+type frame struct {
+	req, rsp   *dissector.ADU
+	port       string
+	latency    float64
+	hasLatency bool
+}
+
+// field a name filters can test. A field has any number of values, none if not known.
+type field struct {
+	kind    kind
+	help    string
+	numbers func(f *frame) []interval
+	strings func(f *frame) []string
+}
+
+// fields by name
+var fields = map[string]*field{
+	"slave": {kind: kindNumber, help: "slave address", numbers: func(f *frame) []interval {
+		if adu := f.adu(); adu != nil {
+			return one(float64(adu.GetAddress()))
+		}
+		return nil
+	}},
+	"fc": {kind: kindNumber, help: "function code, without the exception bit", numbers: func(f *frame) []interval {
+		switch {
+		case f.req != nil:
+			return one(float64(f.req.GetPduRequest().GetFunctionCode()))
+		case f.rsp.GetPduResponse() != nil:
+			return one(float64(f.rsp.GetPduResponse().GetFunctionCode()))
+		case f.rsp.GetPduResponseException() != nil:
+			return one(float64(f.rsp.GetPduResponseException().GetFunctionExceptionCode() &^ 0x80))
+		}
+		return nil
+	}},
+	"reg": {kind: kindNumber, help: "coil, input or register addresses read or written", numbers: func(f *frame) (v []interval) {
+		pdu := f.req.GetPduRequest()
+		if fc := pdu.GetFunctionCode(); fc >= 1 && fc <= 4 || fc == 23 {
+			if q := pdu.Quantity(); q > 0 {
+				v = append(v, interval{float64(pdu.StartAddress()), float64(pdu.StartAddress() + q - 1)})
+			}
+		}
+		if start, q := pdu.WriteRange(); q > 0 {
+			v = append(v, interval{float64(start), float64(start + q - 1)})
+		}
+		return
+	}},
+	"qty": {kind: kindNumber, help: "number of coils, inputs or registers requested", numbers: func(f *frame) []interval {
+		if q := f.req.GetPduRequest().Quantity(); q > 0 {
+			return one(float64(q))
+		}
+		return nil
+	}},
+	"value": {kind: kindNumber, help: "values read or written: registers, 0 or 1 for coils and inputs", numbers: values},
+	"latency": {kind: kindDuration, help: "time from the request to the response", numbers: func(f *frame) []interval {
+		if f.hasLatency {
+			return one(f.latency)
+		}
+		return nil
+	}},
+	"exception": {kind: kindNumber, help: "exception code, true if an exception", numbers: func(f *frame) []interval {
+		if f.rsp != nil && f.rsp.IsException() {
+			return one(float64(f.rsp.GetPduResponseException().GetExceptionCode()))
+		}
+		return nil
+	}},
+	"port": {kind: kindString, help: "serial port", strings: func(f *frame) []string {
+		if f.port != "" {
+			return []string{f.port}
+		}
+		return nil
+	}},
+	"write": {kind: kindBool, help: "true for writes", numbers: func(f *frame) []interval {
+		return flag(f.req.GetPduRequest().IsWrite())
+	}},
+	"request": {kind: kindBool, help: "true if there is a request", numbers: func(f *frame) []interval {
+		return flag(f.req != nil)
+	}},
+	"response": {kind: kindBool, help: "true if there is a response, not an exception", numbers: func(f *frame) []interval {
+		return flag(f.rsp != nil && f.rsp.IsResponse())
+	}},
+}
+
+// aliases of field names
+var aliases = map[string]string{
+	"address":       "reg",
+	"register":      "reg",
+	"quantity":      "qty",
+	"function":      "fc",
+	"function_code": "fc",
+}
+
+// adu returns the request, or the response if alone
+func (f *frame) adu() *dissector.ADU {
+	if f.req != nil {
+		return f.req
+	}
+	return f.rsp
+}
+
+// values returns the values read and written
+func values(f *frame) (v []interval) {
+	for _, x := range f.req.GetPduRequest().WriteValues() {
+		v = append(v, interval{float64(x), float64(x)})
+	}
+	if f.rsp == nil || !f.rsp.IsResponse() {
+		return
+	}
+	pdu := f.rsp.GetPduResponse()
+	d := pdu.GetData()
+	if len(d) < 1 || int(d[0]) != len(d)-1 {
+		return
+	}
+	d = d[1:]
+	switch pdu.GetFunctionCode() {
+	case 1, 2:
+		n := uint32(8 * len(d))
+		if q := f.req.GetPduRequest().Quantity(); q > 0 && q < n {
+			n = q
+		}
+		for i := uint32(0); i < n; i++ {
+			x := float64(d[i/8] >> (i % 8) & 1)
+			v = append(v, interval{x, x})
+		}
+	case 3, 4, 23:
+		for i := 0; i+1 < len(d); i += 2 {
+			x := float64(uint32(d[i])<<8 | uint32(d[i+1]))
+			v = append(v, interval{x, x})
+		}
+	}
+	return
+}
+
+func one(x float64) []interval {
+	return []interval{{x, x}}
+}
+
+func flag(b bool) []interval {
+	if b {
+		return one(1)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+// Package filter compiles display filter expressions, like Wireshark ones, matching results and ADUs, e.g.
+//
+//	slave == 2 && fc in {3,4} && reg >= 100 && latency > 50ms || exception
+//
+// Fields are compared with == != < <= > >=, or tested for membership with "in {1, 2, 10..20}". A field alone is
+// true if it has a value, e.g. "exception". Expressions are combined with && (and), || (or), ! (not) and
+// parentheses. Fields with many values, e.g. reg and value, match if any of their values does. See Help.
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+)
+
+// Filter a compiled expression. Filters are safe for concurrent use.
+type Filter struct {
+	expr string
+	root node
+}
+
+var _ dissector.ResultFilter = (*Filter)(nil)
+
+// Compile compiles expression expr
+func Compile(expr string) (*Filter, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = p.errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// MustCompile is like Compile but panics if expr cannot be compiled
+func MustCompile(expr string) *Filter {
+	f, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// String returns the expression
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match returns true if result r matches. A nil filter matches any result.
+func (f *Filter) Match(r *sniffer.Result) bool {
+	if f == nil {
+		return true
+	}
+	fr := &frame{req: r.GetRequest().GetAdu(), rsp: r.GetResponse().GetAdu(), port: r.GetRequest().GetPort()}
+	if fr.req != nil && fr.rsp != nil {
+		fr.latency = r.Latency().Seconds()
+		fr.hasLatency = true
+	}
+	return f.root.eval(fr)
+}
+
+// Validate returns true if a single ADU matches, as dissector.ResultFilter: fields of the other side of the
+// transaction, e.g. latency, have no value
+func (f *Filter) Validate(r *dissector.Result) bool {
+	if f == nil {
+		return true
+	}
+	fr := &frame{port: r.GetPort()}
+	if adu := r.GetAdu(); adu != nil && adu.IsRequest() {
+		fr.req = adu
+	} else if adu != nil {
+		fr.rsp = adu
+	}
+	return f.root.eval(fr)
+}
+
+// Help returns the fields filters can test, one per line
+func Help() string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%-10s %s\n", name, fields[name].help)
+	}
+	return b.String()
+}
+
+type node interface {
+	eval(f *frame) bool
+}
+
+type andNode struct{ x, y node }
+type orNode struct{ x, y node }
+type notNode struct{ x node }
+
+func (n *andNode) eval(f *frame) bool { return n.x.eval(f) && n.y.eval(f) }
+func (n *orNode) eval(f *frame) bool  { return n.x.eval(f) || n.y.eval(f) }
+func (n *notNode) eval(f *frame) bool { return !n.x.eval(f) }
+
+// testNode a field alone, true if it has a value
+type testNode struct {
+	field *field
+}
+
+func (n *testNode) eval(f *frame) bool {
+	if n.field.strings != nil {
+		return len(n.field.strings(f)) > 0
+	}
+	return len(n.field.numbers(f)) > 0
+}
+
+// compareNode a field compared to a literal, or tested for membership in a set ("in")
+type compareNode struct {
+	field   *field
+	op      string
+	numbers []interval
+	strings []string
+}
+
+func (n *compareNode) eval(f *frame) bool {
+	if n.field.strings != nil {
+		for _, s := range n.field.strings(f) {
+			for _, x := range n.strings {
+				if (s == x) == (n.op != "!=") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, v := range n.field.numbers(f) {
+		for _, x := range n.numbers {
+			if compare(v, n.op, x) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compare returns true if any value of v is op any value of x
+func compare(v interval, op string, x interval) bool {
+	switch op {
+	case "==", "in":
+		return v.lo <= x.hi && x.lo <= v.hi
+	case "!=":
+		return !(v.lo == v.hi && x.lo == x.hi && v.lo == x.lo)
+	case "<":
+		return v.lo < x.lo
+	case "<=":
+		return v.lo <= x.lo
+	case ">":
+		return v.hi > x.lo
+	case ">=":
+		return v.hi >= x.lo
+	}
+	return false
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of ops, operators or keywords
+func (p *parser) accept(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokenOp && t.kind != tokenIdent {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.i++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("at %d: %s", p.peek().pos, fmt.Sprintf(format, a...))
+}
+
+func (p *parser) or() (node, error) {
+	x, err := p.and()
+	for err == nil && p.accept("||", "or") {
+		var y node
+		if y, err = p.and(); err == nil {
+			x = &orNode{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *parser) and() (node, error) {
+	x, err := p.not()
+	for err == nil && p.accept("&&", "and") {
+		var y node
+		if y, err = p.not(); err == nil {
+			x = &andNode{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *parser) not() (node, error) {
+	if p.accept("!", "not") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	if p.accept("(") {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf("missing )")
+		}
+		return x, nil
+	}
+
+	t := p.next()
+	if t.kind != tokenIdent {
+		return nil, fmt.Errorf("at %d: expected a field, got %q", t.pos, t.text)
+	}
+	name := strings.ToLower(t.text)
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	f, ok := fields[name]
+	if !ok {
+		return nil, fmt.Errorf("at %d: unknown field %q", t.pos, t.text)
+	}
+
+	op := p.peek().text
+	switch {
+	case p.accept("==", "!=", "<", "<=", ">", ">="):
+	case p.accept("in"):
+		op = "in"
+	default:
+		return &testNode{f}, nil
+	}
+	if f.kind == kindBool {
+		return nil, fmt.Errorf("at %d: %s can only be tested, e.g. %s or !%s", t.pos, name, name, name)
+	}
+	if f.kind == kindString && op != "==" && op != "!=" && op != "in" {
+		return nil, fmt.Errorf("at %d: %s can only be compared with ==, != or in", t.pos, name)
+	}
+
+	n := &compareNode{field: f, op: op}
+	if op != "in" {
+		return n, p.literal(n, f, false)
+	}
+	if !p.accept("{") {
+		return nil, p.errorf("expected {")
+	}
+	for {
+		if err := p.literal(n, f, true); err != nil {
+			return nil, err
+		}
+		if p.accept("}") {
+			return n, nil
+		}
+		if !p.accept(",") {
+			return nil, p.errorf("expected , or }")
+		}
+	}
+}
+
+// literal adds the next literal, or range of literals if allowed, to n
+func (p *parser) literal(n *compareNode, f *field, ranges bool) error {
+	if f.kind == kindString {
+		t := p.next()
+		s, err := strconv.Unquote(t.text)
+		if t.kind != tokenString || err != nil {
+			return fmt.Errorf("at %d: expected a string, got %q", t.pos, t.text)
+		}
+		n.strings = append(n.strings, s)
+		return nil
+	}
+	lo, err := p.number(f)
+	if err != nil {
+		return err
+	}
+	hi := lo
+	if ranges && p.accept("..") {
+		if hi, err = p.number(f); err != nil {
+			return err
+		}
+		if hi < lo {
+			return p.errorf("empty range")
+		}
+	}
+	n.numbers = append(n.numbers, interval{lo, hi})
+	return nil
+}
+
+// number parses the next number: integers (100, 0x64), decimals, or durations ("50ms") for duration fields,
+// returned as seconds
+func (p *parser) number(f *field) (float64, error) {
+	t := p.next()
+	if t.kind != tokenNumber {
+		return 0, fmt.Errorf("at %d: expected a number, got %q", t.pos, t.text)
+	}
+	if f.kind == kindDuration {
+		d, err := time.ParseDuration(t.text)
+		if err != nil {
+			return 0, fmt.Errorf("at %d: expected a duration, e.g. 50ms, got %q", t.pos, t.text)
+		}
+		return d.Seconds(), nil
+	}
+	if i, err := strconv.ParseUint(t.text, 0, 64); err == nil {
+		return float64(i), nil
+	}
+	x, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("at %d: expected a number, got %q", t.pos, t.text)
+	}
+	return x, nil
+}
@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+)
+
+func TestFilter(t *testing.T) {
+	// read 2 holding registers from 0x1000 of slave 2, answered after 60ms; read 2 input registers of slave 2,
+	// answered with exception 02 after 20ms; write single register 1 of slave 2 with 0x1234, echoed
+	adus := sniffertest.Dissect(t, "/dev/ttyS0", []sniffertest.Frame{
+		{Data: sniffertest.ReadHolding},
+		{Data: sniffertest.ReadHoldingResponse, After: 60 * time.Millisecond},
+		{Data: sniffertest.ReadInput, After: 500 * time.Millisecond},
+		{Data: sniffertest.ReadInputException, After: 20 * time.Millisecond},
+		{Data: sniffertest.WriteRegister, After: 500 * time.Millisecond},
+		{Data: sniffertest.WriteRegister, After: 20 * time.Millisecond},
+		{Data: sniffertest.ReadHolding, After: 500 * time.Millisecond},
+	})
+	results := []*sniffer.Result{
+		{Request: adus[0], Response: adus[1]},
+		{Request: adus[2], Response: adus[3]},
+		{Request: adus[4], Response: adus[5]},
+	}
+
+	for _, tc := range []struct {
+		expr string
+		want []bool
+	}{
+		{"slave == 2 && fc in {3,4} && reg >= 100 && latency > 50ms || exception", []bool{true, true, false}},
+		{"fc == 3 and reg in {0x1000..0x1000}", []bool{true, false, false}},
+		{"reg == 0x1001 || reg < 1", []bool{true, true, false}},
+		{"exception == 2", []bool{false, true, false}},
+		{"!exception && latency <= 20ms", []bool{false, false, true}},
+		{"write && value == 0x1234", []bool{false, false, true}},
+		{"value in {1, 2}", []bool{true, false, false}},
+		{`port == "/dev/ttyS0" && (qty == 2 || !response)`, []bool{true, true, false}},
+		{"slave != 2", []bool{false, false, false}},
+	} {
+		f, err := Compile(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		for i, r := range results {
+			if got := f.Match(r); got != tc.want[i] {
+				t.Errorf("%s: result %d got %v, want %v", tc.expr, i, got, tc.want[i])
+			}
+		}
+	}
+
+	// single ADUs, as dissector.ResultFilter
+	f := MustCompile("fc == 3 && !latency")
+	for i, want := range []bool{true, true, false, false} {
+		if got := f.Validate(adus[i]); got != want {
+			t.Errorf("ADU %d: got %v, want %v", i, got, want)
+		}
+	}
+
+	for _, expr := range []string{"", "slave ==", "slave == 2 &&", "foo == 1", "latency > 50", "write == 1",
+		`port > "a"`, "fc in {3, 4", "(slave == 2", "reg in {10..1}", "slave = 2"} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("%q: got no error", expr)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators, longest first
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "..", "<", ">", "!", "(", ")", "{", "}", ","}
+
+// lex splits an expression into tokens
+func lex(expr string) (tokens []token, err error) {
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(expr) && (isIdent(rune(expr[j])) || expr[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, expr[i:j], i})
+			i = j
+		case unicode.IsDigit(c):
+			// numbers, hex numbers and durations: 100, 0x64, 2.5, 50ms, 1m30s. ".." ends them, for ranges.
+			j := i + 1
+			for j < len(expr) {
+				if expr[j] == '.' && (j+1 >= len(expr) || !unicode.IsDigit(rune(expr[j+1]))) {
+					break
+				}
+				if !isIdent(rune(expr[j])) && expr[j] != '.' {
+					break
+				}
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, expr[i:j], i})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(expr) && expr[j] != '"' {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, token{tokenString, expr[i : j+1], i})
+			i = j + 1
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(expr)}), nil
+}
+
+func isIdent(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
+}
@@ -3,7 +3,13 @@ module github.com/andreaaizza/sniffer
 go 1.15
 
 require (
-	github.com/golang/protobuf v1.4.1
+	github.com/eclipse/paho.mqtt.golang v1.3.5
+	github.com/golang/protobuf v1.4.3
+	github.com/gorilla/websocket v1.4.2
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+	golang.org/x/sys v0.0.0-20211007075335-d3039528d8ac
+	google.golang.org/grpc v1.44.0
 	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v3 v3.0.1
+	modernc.org/sqlite v1.14.1
 )
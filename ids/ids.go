@@ -0,0 +1,76 @@
+package ids
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andreaaizza/sniffer/dissector"
+)
+
+// Alert a request matching a rule
+type Alert struct {
+	Time         time.Time `json:"time"`
+	Port         string    `json:"port"`
+	Slave        uint32    `json:"slave"`
+	FunctionCode uint32    `json:"functionCode"`
+	Rule         string    `json:"rule"`
+	Severity     string    `json:"severity"`
+	Description  string    `json:"description,omitempty"`
+	// Request as PrettyString
+	Request string `json:"request"`
+}
+
+func (a *Alert) PrettyString() string {
+	return fmt.Sprintf("ALERT %s [%s] %s: %s", a.Severity, a.Time.Format(time.RFC3339Nano), a.Rule, a.Request)
+}
+
+// Engine evaluates requests against rules. All methods are safe for concurrent use.
+type Engine struct {
+	rules *Rules
+
+	mux sync.Mutex
+	// learnUntil end of learning, from the first request
+	learnUntil time.Time
+	slaves     map[uint32]bool
+}
+
+// New creates an engine evaluating rules
+func New(rules *Rules) *Engine {
+	return &Engine{rules: rules, slaves: make(map[uint32]bool)}
+}
+
+// Check evaluates request r against rules and returns an alert for each rule matched. Use as Sniffer.OnRequest()
+// callback, so that requests never answered are evaluated too.
+func (e *Engine) Check(r *dissector.Result) (alerts []*Alert) {
+	adu := r.GetAdu()
+	if !adu.IsRequest() {
+		return nil
+	}
+	t := adu.GetTimeTime()
+	slave := adu.GetAddress()
+
+	e.mux.Lock()
+	if e.learnUntil.IsZero() {
+		e.learnUntil = t.Add(time.Duration(e.rules.LearnSeconds * float64(time.Second)))
+	}
+	newSlave := !e.slaves[slave] && !t.Before(e.learnUntil)
+	e.slaves[slave] = true
+	e.mux.Unlock()
+
+	for _, rule := range e.rules.Rules {
+		if rule.match(slave, adu.GetPduRequest(), newSlave) {
+			alerts = append(alerts, &Alert{
+				Time:         t,
+				Port:         r.GetPort(),
+				Slave:        slave,
+				FunctionCode: adu.GetPduRequest().GetFunctionCode(),
+				Rule:         rule.Name,
+				Severity:     rule.Severity,
+				Description:  rule.Description,
+				Request:      adu.PrettyString(),
+			})
+		}
+	}
+	return
+}
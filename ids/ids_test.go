@@ -0,0 +1,53 @@
+package ids
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+)
+
+const testRules = `
+learnSeconds: 1
+rules:
+  - {name: write read-only, severity: high, writes: true, ranges: [{table: holding, start: 0, end: 9}]}
+  - {name: unusual read, severity: medium, functionCodes: [3], outsideRanges: [{start: 0, end: 99}]}
+  - {name: listen only, severity: critical, subFunctions: [1, 4]}
+  - {name: unknown function, severity: medium, unknownFunctionCode: true}
+  - {name: new slave, severity: low, newSlave: true}
+`
+
+func TestCheck(t *testing.T) {
+	rules, err := Parse([]byte(testRules), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := sniffertest.Dissect(t, "port", sniffertest.Every(500*time.Millisecond,
+		[]byte{0x02, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC4, 0x38},
+		sniffertest.ReadHolding,
+		sniffertest.WriteRegister,
+		[]byte{0x02, 0x08, 0x00, 0x04, 0x00, 0x00, 0xA1, 0xF9},
+		[]byte{0x02, 0x41, 0x00, 0x00, 0x00, 0x00, 0x3D, 0xF6},
+		[]byte{0x09, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC5, 0x43},
+		[]byte{0x09, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC5, 0x43},
+	))
+
+	e := New(rules)
+	want := [][]string{nil, {"unusual read"}, {"write read-only"}, {"listen only"}, {"unknown function"}, {"new slave"}, nil}
+	for i, r := range results {
+		alerts := e.Check(r)
+		if len(alerts) != len(want[i]) {
+			t.Errorf("request %d: got %d alerts, want %v", i, len(alerts), want[i])
+			continue
+		}
+		for j, a := range alerts {
+			if a.Rule != want[i][j] {
+				t.Errorf("request %d: got alert %s, want %s", i, a.Rule, want[i][j])
+			}
+		}
+	}
+
+	if _, err := Parse([]byte("rules: [{name: x, severity: urgent}]"), "yaml"); err == nil {
+		t.Error("got no error for an unknown severity")
+	}
+}
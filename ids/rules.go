@@ -0,0 +1,214 @@
+package ids
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/andreaaizza/sniffer/dissector"
+	"gopkg.in/yaml.v3"
+)
+
+// Severities of alerts, lowest first
+var Severities = []string{"info", "low", "medium", "high", "critical"}
+
+// publicFunctionCodes function codes defined by the Modbus application protocol
+var publicFunctionCodes = map[uint32]bool{
+	1: true, 2: true, 3: true, 4: true, 5: true, 6: true, 7: true, 8: true, 11: true, 12: true,
+	15: true, 16: true, 17: true, 20: true, 21: true, 22: true, 23: true, 24: true, 43: true,
+}
+
+// Rules rules an engine evaluates requests against
+type Rules struct {
+	// LearnSeconds slaves seen within this time from the first request are known, see Rule.NewSlave
+	LearnSeconds float64 `json:"learnSeconds,omitempty" yaml:"learnSeconds,omitempty"`
+	Rules        []*Rule `json:"rules" yaml:"rules"`
+}
+
+// Rule conditions a request must all meet to raise an alert. Conditions not set always match.
+type Rule struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Severity one of Severities
+	Severity string `json:"severity" yaml:"severity"`
+
+	// Slaves addressed
+	Slaves []uint32 `json:"slaves,omitempty" yaml:"slaves,omitempty"`
+	// FunctionCodes of the request
+	FunctionCodes []uint32 `json:"functionCodes,omitempty" yaml:"functionCodes,omitempty"`
+	// Writes requests writing coils or registers: FC5, 6, 15, 16, 22, 23
+	Writes bool `json:"writes,omitempty" yaml:"writes,omitempty"`
+	// UnknownFunctionCode function codes not defined by the Modbus application protocol
+	UnknownFunctionCode bool `json:"unknownFunctionCode,omitempty" yaml:"unknownFunctionCode,omitempty"`
+	// SubFunctions of diagnostics requests (FC8), e.g. 1 restart communications, 4 force listen only mode
+	SubFunctions []uint32 `json:"subFunctions,omitempty" yaml:"subFunctions,omitempty"`
+	// Ranges requests reading or writing any address within any of them
+	Ranges []Range `json:"ranges,omitempty" yaml:"ranges,omitempty"`
+	// OutsideRanges requests reading or writing any address outside all of them
+	OutsideRanges []Range `json:"outsideRanges,omitempty" yaml:"outsideRanges,omitempty"`
+	// NewSlave first request to a slave not seen within LearnSeconds
+	NewSlave bool `json:"newSlave,omitempty" yaml:"newSlave,omitempty"`
+}
+
+// Range addresses Start to End included, of Table (any if not set)
+type Range struct {
+	Table dissector.Table `json:"table,omitempty" yaml:"table,omitempty"`
+	Start uint32          `json:"start" yaml:"start"`
+	End   uint32          `json:"end" yaml:"end"`
+}
+
+// Load loads rules from a YAML (.yaml, .yml) or JSON (.json) file
+func Load(path string) (r *Rules, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if r, err = Parse(b, format); err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	return
+}
+
+// Parse parses rules in format yaml, yml or json
+func Parse(b []byte, format string) (r *Rules, err error) {
+	r = &Rules{}
+	switch format {
+	case "yaml", "yml":
+		err = yaml.Unmarshal(b, r)
+	case "json":
+		err = json.Unmarshal(b, r)
+	default:
+		err = fmt.Errorf("unknown rules format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range r.Rules {
+		if err = rule.validate(); err != nil {
+			return nil, fmt.Errorf("rule %d %q: %w", i+1, rule.Name, err)
+		}
+	}
+	return
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	r.Severity = strings.ToLower(r.Severity)
+	if severity(r.Severity) < 0 {
+		return fmt.Errorf("unknown severity %q, should be one of %s", r.Severity, strings.Join(Severities, ", "))
+	}
+	for _, rg := range append(append([]Range{}, r.Ranges...), r.OutsideRanges...) {
+		if rg.End < rg.Start {
+			return fmt.Errorf("range end %d before start %d", rg.End, rg.Start)
+		}
+	}
+	return nil
+}
+
+// severity returns the index of s in Severities, -1 if unknown
+func severity(s string) int {
+	for i, sv := range Severities {
+		if s == sv {
+			return i
+		}
+	}
+	return -1
+}
+
+// contains returns true if v is in vs
+func contains(vs []uint32, v uint32) bool {
+	for _, x := range vs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// span addresses read or written by a request
+type span struct {
+	table      dissector.Table
+	start, end uint32
+}
+
+// spans returns the addresses a request reads or writes
+func spans(pdu *dissector.PDURequest) (s []span) {
+	table := dissector.TableOf(pdu.GetFunctionCode())
+	if table == dissector.TableNone {
+		return
+	}
+	if pdu.GetFunctionCode() <= 4 || pdu.GetFunctionCode() == 23 {
+		if q := pdu.Quantity(); q > 0 {
+			s = append(s, span{table, pdu.StartAddress(), pdu.StartAddress() + q - 1})
+		}
+	}
+	if start, q := pdu.WriteRange(); q > 0 {
+		s = append(s, span{table, start, start + q - 1})
+	}
+	return
+}
+
+// overlaps returns true if sp has any address in rg
+func (rg Range) overlaps(sp span) bool {
+	return (rg.Table == dissector.TableNone || rg.Table == sp.table) && sp.start <= rg.End && sp.end >= rg.Start
+}
+
+// covers returns true if sp has all addresses in rg
+func (rg Range) covers(sp span) bool {
+	return (rg.Table == dissector.TableNone || rg.Table == sp.table) && sp.start >= rg.Start && sp.end <= rg.End
+}
+
+// match returns true if request pdu to slave meets all conditions. newSlave tells if slave was not seen before.
+func (r *Rule) match(slave uint32, pdu *dissector.PDURequest, newSlave bool) bool {
+	fc := pdu.GetFunctionCode()
+	switch {
+	case len(r.Slaves) > 0 && !contains(r.Slaves, slave):
+		return false
+	case len(r.FunctionCodes) > 0 && !contains(r.FunctionCodes, fc):
+		return false
+	case r.Writes && !pdu.IsWrite():
+		return false
+	case r.UnknownFunctionCode && publicFunctionCodes[fc]:
+		return false
+	case r.NewSlave && !newSlave:
+		return false
+	}
+	if len(r.SubFunctions) > 0 {
+		d := pdu.GetData()
+		if fc != 8 || len(d) < 2 || !contains(r.SubFunctions, uint32(d[0])<<8|uint32(d[1])) {
+			return false
+		}
+	}
+
+	s := spans(pdu)
+	if len(r.Ranges) > 0 {
+		found := false
+		for _, sp := range s {
+			for _, rg := range r.Ranges {
+				found = found || rg.overlaps(sp)
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.OutsideRanges) > 0 {
+		outside := false
+		for _, sp := range s {
+			covered := false
+			for _, rg := range r.OutsideRanges {
+				covered = covered || rg.covers(sp)
+			}
+			outside = outside || !covered
+		}
+		if !outside {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package influx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+	"github.com/andreaaizza/sniffer/regmap"
+)
+
+func TestPoint(t *testing.T) {
+	p := &Point{
+		Measurement: "modbus x",
+		Tags:        map[string]string{"name": "a,b=c", "unit": ""},
+		Fields:      map[string]interface{}{"value": 1.5, "text": `say "hi"`, "n": int64(3), "ok": true},
+		Time:        time.Unix(1, 5),
+	}
+	want := `modbus\ x,name=a\,b\=c n=3i,ok=true,text="say \"hi\"",value=1.5 1000000005`
+	if got := p.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// values at the time of the response
+	r := sniffertest.Results(t)[0]
+	r.Values = []*regmap.Value{{Device: "meter", Name: "energy", Slave: 2, Address: 0x1000, Number: 65538, Unit: "Wh"}}
+	var b bytes.Buffer
+	w, err := New(&b, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Add(r)
+	w.Close()
+	want = "modbus,device=meter,name=energy,port=ttyUSB0,slave=2,unit=Wh value=65538 1600073154020000000\n"
+	if b.String() != want {
+		t.Errorf("got %s, want %s", b.String(), want)
+	}
+}
+
+func TestWriterSpool(t *testing.T) {
+	var mux sync.Mutex
+	down := true
+	var written []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		if req.Header.Get("Authorization") != "Token secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if down {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		written = append(written, string(body))
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	spool := t.TempDir()
+	w, err := New(nil, Options{URL: server.URL + "/api/v2/write?bucket=modbus", Token: "secret", SpoolDir: spool,
+		Retries: 1, RetryInterval: time.Millisecond, FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := func(v float64) []*Point {
+		return []*Point{{Measurement: "m", Fields: map[string]interface{}{"value": v}, Time: time.Unix(0, 0)}}
+	}
+
+	// endpoint down: spooled
+	w.AddPoints(point(1))
+	for start := time.Now(); ; time.Sleep(5 * time.Millisecond) {
+		if files, _ := w.spooled(); len(files) == 1 {
+			break
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("got no batch spooled")
+		}
+	}
+
+	// endpoint back: spool first
+	mux.Lock()
+	down = false
+	mux.Unlock()
+	w.AddPoints(point(2))
+	w.Close()
+
+	if got := strings.Join(written, ""); got != "m value=1 0\nm value=2 0\n" {
+		t.Errorf("got written %q", got)
+	}
+	if files, _ := w.spooled(); len(files) != 0 || w.Dropped() != 0 {
+		t.Errorf("got %d batches left in the spool, %d dropped", len(files), w.Dropped())
+	}
+}
@@ -0,0 +1,157 @@
+// Package influx writes values decoded with the register map and bus metrics in InfluxDB line protocol, to a file
+// or an HTTP write endpoint
+package influx
+
+import (
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/metrics"
+)
+
+// Point a line of line protocol
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	// Fields values: float64, int64, uint64, bool or string
+	Fields map[string]interface{}
+	Time   time.Time
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// String returns p in line protocol, without newline, tags and fields sorted by key. Empty tags and fields not
+// representable (NaN, infinite) are left out; "" if no field is left.
+func (p *Point) String() string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(p.Measurement))
+	for _, k := range sortedKeys(p.Tags) {
+		if v := p.Tags[k]; v != "" {
+			b.WriteString("," + keyEscaper.Replace(k) + "=" + keyEscaper.Replace(v))
+		}
+	}
+	fields := 0
+	for _, k := range sortedKeys(p.Fields) {
+		var v string
+		switch x := p.Fields[k].(type) {
+		case float64:
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				continue
+			}
+			v = strconv.FormatFloat(x, 'g', -1, 64)
+		case int64:
+			v = strconv.FormatInt(x, 10) + "i"
+		case uint64:
+			v = strconv.FormatUint(x, 10) + "i"
+		case bool:
+			v = strconv.FormatBool(x)
+		case string:
+			v = `"` + stringEscaper.Replace(x) + `"`
+		default:
+			continue
+		}
+		if fields == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(keyEscaper.Replace(k) + "=" + v)
+		fields++
+	}
+	if fields == 0 {
+		return ""
+	}
+	b.WriteString(" " + strconv.FormatInt(p.Time.UnixNano(), 10))
+	return b.String()
+}
+
+func sortedKeys(m interface{}) (keys []string) {
+	switch x := m.(type) {
+	case map[string]string:
+		for k := range x {
+			keys = append(keys, k)
+		}
+	case map[string]interface{}:
+		for k := range x {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return
+}
+
+// ValuePoints returns a point of measurement for each value of r decoded with the register map, tagged with port,
+// slave, device, name and unit, at the time of the response ADU. Numbers are field value, text field text.
+func ValuePoints(measurement string, r *sniffer.Result) (points []*Point) {
+	t := r.GetResponse().GetAdu().GetTimeTime()
+	for _, v := range r.GetValues() {
+		p := &Point{
+			Measurement: measurement,
+			Tags: map[string]string{
+				"port":   filepath.Base(r.GetRequest().GetPort()),
+				"slave":  strconv.Itoa(int(v.GetSlave())),
+				"device": v.GetDevice(),
+				"name":   v.GetName(),
+				"unit":   v.GetUnit(),
+			},
+			Fields: map[string]interface{}{"value": v.GetNumber()},
+			Time:   t,
+		}
+		if v.GetText() != "" {
+			p.Fields["text"] = v.GetText()
+		}
+		points = append(points, p)
+	}
+	return
+}
+
+// MetricsPoints returns the points of bus metrics s: measurement_port of each port and measurement_slave of each
+// slave, at the time of the snapshot, since no ADU is behind them
+func MetricsPoints(measurement string, s *metrics.Snapshot) (points []*Point) {
+	for _, p := range s.Ports {
+		points = append(points, &Point{
+			Measurement: measurement + "_port",
+			Tags:        map[string]string{"port": filepath.Base(p.Port)},
+			Fields: map[string]interface{}{
+				"bytes":           p.Bytes,
+				"frames":          p.Frames,
+				"invalidFrames":   p.InvalidFrames,
+				"invalidBytes":    p.InvalidBytes,
+				"connected":       p.Connected,
+				"reconnects":      p.Reconnects,
+				"bytesPerSecond":  p.BytesPerSecond,
+				"framesPerSecond": p.FramesPerSecond,
+				"utilisation":     p.Utilisation,
+				"crcErrorRate":    p.CRCErrorRate,
+			},
+			Time: s.Time,
+		})
+	}
+	for _, sl := range s.Slaves {
+		points = append(points, &Point{
+			Measurement: measurement + "_slave",
+			Tags:        map[string]string{"port": filepath.Base(sl.Port), "slave": strconv.Itoa(int(sl.Address))},
+			Fields: map[string]interface{}{
+				"requests":      sl.Requests,
+				"responses":     sl.Responses,
+				"exceptions":    sl.Exceptions,
+				"timeouts":      sl.Timeouts,
+				"exceptionRate": sl.ExceptionRate,
+				"timeoutRate":   sl.TimeoutRate,
+				"latencyMean":   sl.Latency.Mean(),
+				"latencyCount":  sl.Latency.Count,
+			},
+			Time: s.Time,
+		})
+	}
+	return
+}
@@ -0,0 +1,364 @@
+package influx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/metrics"
+)
+
+const (
+	// MeasurementDefault measurement of values, prefix of the ones of metrics
+	MeasurementDefault = "modbus"
+	// BatchSizeDefault lines written at once
+	BatchSizeDefault = 5000
+	// FlushIntervalDefault lines are written at least this often
+	FlushIntervalDefault = time.Second
+	// RetriesDefault retries of a batch the endpoint failed to write, before spooling it
+	RetriesDefault = 3
+	// RetryIntervalDefault interval before the first retry, doubled at each one
+	RetryIntervalDefault = time.Second
+	// MaxPendingDefault lines waiting to be written, beyond which new ones are dropped
+	MaxPendingDefault = 100000
+	// SpoolMaxBytesDefault size of the spool, beyond which the oldest batches are dropped
+	SpoolMaxBytesDefault = 100 << 20
+	// TimeoutDefault of HTTP requests
+	TimeoutDefault = 10 * time.Second
+)
+
+// Options of a Writer. Zero values are replaced by defaults.
+type Options struct {
+	// URL of the HTTP write endpoint, e.g. http://localhost:8086/write?db=modbus (1.x) or
+	// http://localhost:8086/api/v2/write?org=plant&bucket=modbus (2.x). If empty, lines are written to the io.Writer.
+	URL string
+	// Token authorizes requests to 2.x endpoints, if not empty
+	Token string
+	// Measurement of values, MeasurementDefault if empty
+	Measurement string
+
+	// BatchSize, FlushInterval, Retries (negative for none), RetryInterval, MaxPending, Timeout see the defaults
+	BatchSize     int
+	FlushInterval time.Duration
+	Retries       int
+	RetryInterval time.Duration
+	MaxPending    int
+	Timeout       time.Duration
+
+	// SpoolDir keeps batches the endpoint failed to write, written again in order once it is back. If empty, they
+	// are dropped.
+	SpoolDir string
+	// SpoolMaxBytes see the default
+	SpoolMaxBytes int64
+}
+
+// Writer writes points in line protocol, in batches, in the background. All methods are safe for concurrent use.
+type Writer struct {
+	opts   Options
+	w      io.Writer
+	client *http.Client
+
+	mux     sync.Mutex
+	pending []string
+	closed  bool
+	dropped uint64
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+	// spoolSeq orders batches spooled at the same time
+	spoolSeq int
+}
+
+// New creates a writer to the HTTP endpoint of opts, or to w if there is none
+func New(w io.Writer, opts Options) (*Writer, error) {
+	if opts.Measurement == "" {
+		opts.Measurement = MeasurementDefault
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = BatchSizeDefault
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = FlushIntervalDefault
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries == 0 {
+		opts.Retries = RetriesDefault
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = RetryIntervalDefault
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = MaxPendingDefault
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = TimeoutDefault
+	}
+	if opts.SpoolMaxBytes <= 0 {
+		opts.SpoolMaxBytes = SpoolMaxBytesDefault
+	}
+	if opts.URL == "" && w == nil {
+		return nil, fmt.Errorf("no InfluxDB URL nor writer")
+	}
+	if opts.URL != "" && !strings.HasPrefix(opts.URL, "http://") && !strings.HasPrefix(opts.URL, "https://") {
+		return nil, fmt.Errorf("invalid InfluxDB URL %q", opts.URL)
+	}
+	if opts.SpoolDir != "" {
+		if err := os.MkdirAll(opts.SpoolDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	iw := &Writer{
+		opts:   opts,
+		w:      w,
+		client: &http.Client{Timeout: opts.Timeout},
+		flush:  make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go iw.run()
+	return iw, nil
+}
+
+// Add queues the values of r decoded with the register map. Use as Sniffer.OnResult() callback.
+func (w *Writer) Add(r *sniffer.Result) {
+	w.AddPoints(ValuePoints(w.opts.Measurement, r))
+}
+
+// AddMetrics queues bus metrics s
+func (w *Writer) AddMetrics(s *metrics.Snapshot) {
+	w.AddPoints(MetricsPoints(w.opts.Measurement, s))
+}
+
+// AddPoints queues points
+func (w *Writer) AddPoints(points []*Point) {
+	if len(points) == 0 {
+		return
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return
+	}
+	for _, p := range points {
+		if len(w.pending) >= w.opts.MaxPending {
+			atomic.AddUint64(&w.dropped, 1)
+			continue
+		}
+		if line := p.String(); line != "" {
+			w.pending = append(w.pending, line)
+		}
+	}
+	if len(w.pending) >= w.opts.BatchSize {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Dropped returns the number of points dropped: queued beyond MaxPending, or not written without a spool
+func (w *Writer) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Close writes the points queued, then stops
+func (w *Writer) Close() {
+	w.mux.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.stop)
+	}
+	w.mux.Unlock()
+	<-w.done
+}
+
+// run writes batches every FlushInterval, or when one is full
+func (w *Writer) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.flush:
+		case <-w.stop:
+			w.writePending()
+			return
+		}
+		w.writePending()
+	}
+}
+
+// writePending writes the lines queued, in batches
+func (w *Writer) writePending() {
+	w.mux.Lock()
+	lines := w.pending
+	w.pending = nil
+	w.mux.Unlock()
+
+	for len(lines) > 0 {
+		n := len(lines)
+		if n > w.opts.BatchSize {
+			n = w.opts.BatchSize
+		}
+		batch := []byte(strings.Join(lines[:n], "\n") + "\n")
+		if err := w.write(batch); err != nil {
+			log.Print(err)
+			atomic.AddUint64(&w.dropped, uint64(n))
+		}
+		lines = lines[n:]
+	}
+}
+
+// write writes a batch to the io.Writer, or to the endpoint, after the spool. It returns an error if the batch is
+// lost.
+func (w *Writer) write(batch []byte) error {
+	if w.opts.URL == "" {
+		_, err := w.w.Write(batch)
+		return err
+	}
+
+	if err := w.writeSpool(); err != nil {
+		// endpoint still down: keep the order
+		return w.spool(batch, err)
+	}
+	err := w.post(batch)
+	wait := w.opts.RetryInterval
+	for i := 0; err != nil && retryable(err) && i < w.opts.Retries && w.sleep(wait); i++ {
+		wait *= 2
+		err = w.post(batch)
+	}
+	if err != nil && retryable(err) {
+		return w.spool(batch, err)
+	}
+	return err
+}
+
+// sleep waits for d, returns false if the writer is closed meanwhile
+func (w *Writer) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-w.stop:
+		return false
+	}
+}
+
+// statusError an endpoint answer other than success
+type statusError struct {
+	status int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("InfluxDB write: %d %s", e.status, e.body)
+}
+
+// retryable returns false for errors writing again will not fix, e.g. invalid lines
+func retryable(err error) bool {
+	if se, ok := err.(*statusError); ok {
+		return se.status >= 500 || se.status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// post writes batch to the endpoint
+func (w *Writer) post(batch []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.opts.URL, bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+w.opts.Token)
+	}
+	rsp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 512))
+	if rsp.StatusCode/100 != 2 {
+		return &statusError{rsp.StatusCode, strings.TrimSpace(string(body))}
+	}
+	return nil
+}
+
+// spool saves a batch the endpoint failed to write, dropping the oldest ones beyond SpoolMaxBytes
+func (w *Writer) spool(batch []byte, cause error) error {
+	if w.opts.SpoolDir == "" {
+		return cause
+	}
+	files, size := w.spooled()
+	for len(files) > 0 && size+int64(len(batch)) > w.opts.SpoolMaxBytes {
+		log.Printf("InfluxDB spool full, dropping %s", files[0].Name())
+		os.Remove(filepath.Join(w.opts.SpoolDir, files[0].Name()))
+		size -= files[0].Size()
+		files = files[1:]
+	}
+	w.spoolSeq++
+	name := filepath.Join(w.opts.SpoolDir, fmt.Sprintf("%020d-%06d.lp", time.Now().UnixNano(), w.spoolSeq%1000000))
+	if err := ioutil.WriteFile(name+".tmp", batch, 0644); err != nil {
+		return fmt.Errorf("%v, spooling: %w", cause, err)
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return fmt.Errorf("%v, spooling: %w", cause, err)
+	}
+	log.Printf("%v, spooled to %s", cause, name)
+	return nil
+}
+
+// spooled returns the batches spooled, oldest first, and their size
+func (w *Writer) spooled() (files []os.FileInfo, size int64) {
+	all, err := ioutil.ReadDir(w.opts.SpoolDir)
+	if err != nil {
+		return nil, 0
+	}
+	for _, f := range all {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".lp") {
+			files = append(files, f)
+			size += f.Size()
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return
+}
+
+// writeSpool writes the batches spooled to the endpoint, oldest first, removing them once written. It stops at the
+// first failure.
+func (w *Writer) writeSpool() error {
+	if w.opts.SpoolDir == "" {
+		return nil
+	}
+	files, _ := w.spooled()
+	for _, f := range files {
+		name := filepath.Join(w.opts.SpoolDir, f.Name())
+		batch, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := w.post(batch); err != nil {
+			if !retryable(err) {
+				log.Printf("%v, dropping %s", err, name)
+				os.Remove(name)
+				continue
+			}
+			return err
+		}
+		os.Remove(name)
+	}
+	return nil
+}
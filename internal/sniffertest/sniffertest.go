@@ -0,0 +1,114 @@
+// Package sniffertest provides a fake sniffer.Source and sniffed traffic for tests
+package sniffertest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/metrics"
+	"github.com/andreaaizza/sniffer/processimage"
+	"github.com/andreaaizza/sniffer/util"
+)
+
+// Port the port of Source, and of Results
+const Port = "/dev/ttyUSB0"
+
+// Source a fake sniffer.Source of Port, half-duplex at 9600 8N1 and connected
+type Source struct {
+	onResult func(*sniffer.Result)
+	metrics  *metrics.Metrics
+	image    *processimage.ProcessImage
+}
+
+// NewSource creates a source
+func NewSource() *Source {
+	s := &Source{metrics: metrics.New(), image: processimage.New()}
+	s.metrics.AddPort(Port, 9600, 10)
+	s.metrics.SetConnected(Port, true)
+	return s
+}
+
+// OnResult registers f, only the last one registered is called
+func (s *Source) OnResult(f func(*sniffer.Result)) func() {
+	s.onResult = f
+	return func() {}
+}
+
+func (s *Source) Metrics() *metrics.Metrics                { return s.metrics }
+func (s *Source) ProcessImage() *processimage.ProcessImage { return s.image }
+func (s *Source) Ports() []*logger.Config {
+	return []*logger.Config{{Port: Port, Baud: 9600, FrameFormat: "8N1"}}
+}
+
+// Publish updates the process image with r and calls OnResult callback, as a sniffer does
+func (s *Source) Publish(r *sniffer.Result) {
+	s.image.Update(r.GetRequest().GetAdu(), r.GetResponse().GetAdu())
+	if s.onResult != nil {
+		s.onResult(r)
+	}
+}
+
+// T0 time of the first frame of Dissect and Results
+var T0 = time.Date(2020, 9, 14, 8, 45, 54, 0, time.UTC)
+
+// Frames of slave 2
+var (
+	// ReadHolding reads 2 holding registers from 0x1000
+	ReadHolding = []byte{0x02, 0x03, 0x10, 0x00, 0x00, 0x02, 0xC0, 0xF8}
+	// ReadHoldingResponse answers ReadHolding with 1, 2
+	ReadHoldingResponse = []byte{0x02, 0x03, 0x04, 0x00, 0x01, 0x00, 0x02, 0x19, 0x32}
+	// ReadInput reads 2 input registers from 0
+	ReadInput = []byte{0x02, 0x04, 0x00, 0x00, 0x00, 0x02, 0x71, 0xF8}
+	// ReadInputException answers ReadInput with exception 02
+	ReadInputException = []byte{0x02, 0x84, 0x02, 0x32, 0xC1}
+	// WriteRegister writes 0x1234 to holding register 1, echoed by the slave
+	WriteRegister = []byte{0x02, 0x06, 0x00, 0x01, 0x12, 0x34, 0xD5, 0x4E}
+)
+
+// Frame a frame read After the previous one, or after T0 if first
+type Frame struct {
+	Data  []byte
+	After time.Duration
+}
+
+// Every returns frames read every apart, the first at T0
+func Every(every time.Duration, frames ...[]byte) []Frame {
+	var fs []Frame
+	for i, f := range frames {
+		fs = append(fs, Frame{Data: f, After: every})
+		if i == 0 {
+			fs[i].After = 0
+		}
+	}
+	return fs
+}
+
+// Dissect dissects frames read from port, and fails t unless each of them is an ADU. Answers to the last request are
+// only dissected when another frame follows them.
+func Dissect(t testing.TB, port string, frames []Frame) []*dissector.Result {
+	t.Helper()
+	at := T0
+	var dus []*logger.DataUnit
+	for _, f := range frames {
+		at = at.Add(f.After)
+		ts := util.TimestampBuilder(at)
+		dus = append(dus, &logger.DataUnit{Time: &ts, Data: f.Data})
+	}
+	adus, _ := dissector.Dissect(dus, port, dissector.FilterAnyModbus{})
+	if len(adus) != len(frames) {
+		t.Fatalf("got %d ADUs, want %d", len(adus), len(frames))
+	}
+	return adus
+}
+
+// Results returns a read of slave 2 answered after 20ms, and a read of slave 2 answered with an exception, read on
+// Port every 20ms from T0
+func Results(t testing.TB) []*sniffer.Result {
+	t.Helper()
+	adus := Dissect(t, Port, Every(20*time.Millisecond,
+		ReadHolding, ReadHoldingResponse, ReadInput, ReadInputException, ReadInput))
+	return []*sniffer.Result{{Request: adus[0], Response: adus[1]}, {Request: adus[2], Response: adus[3]}}
+}
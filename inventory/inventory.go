@@ -0,0 +1,209 @@
+package inventory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/metrics"
+)
+
+// Inventory collects which slaves exist on the bus and what they are polled for, from matched Results.
+// Feed it with Sniffer.OnResult(inv.Add). It is safe for concurrent use.
+type Inventory struct {
+	mux sync.Mutex
+
+	start  time.Time
+	slaves map[slaveKey]*slave
+}
+
+type slaveKey struct {
+	port    string
+	address uint32
+}
+
+type slave struct {
+	responses  uint64
+	exceptions map[uint32]uint64
+	latency    latency
+	functions  map[uint32]*function
+}
+
+type function struct {
+	polls      uint64
+	ranges     map[rangeKey]*register
+	exceptions map[uint32]uint64
+}
+
+type rangeKey struct {
+	start    uint32
+	quantity uint32
+}
+
+type register struct {
+	polls      uint64
+	exceptions uint64
+	first      time.Time
+	last       time.Time
+}
+
+type latency struct {
+	min time.Duration
+	max time.Duration
+	sum time.Duration
+	n   uint64
+}
+
+// New builds empty Inventory
+func New() *Inventory {
+	return &Inventory{
+		start:  time.Now(),
+		slaves: make(map[slaveKey]*slave),
+	}
+}
+
+// Add records a matched request->response/exception
+func (inv *Inventory) Add(r *sniffer.Result) {
+	req := r.GetRequest().GetAdu()
+	rsp := r.GetResponse().GetAdu()
+	pdu := req.GetPduRequest()
+	reqTime := req.GetTimeTime()
+
+	inv.mux.Lock()
+	defer inv.mux.Unlock()
+
+	k := slaveKey{port: r.GetRequest().GetPort(), address: req.GetAddress()}
+	s, ok := inv.slaves[k]
+	if !ok {
+		s = &slave{exceptions: make(map[uint32]uint64), functions: make(map[uint32]*function)}
+		inv.slaves[k] = s
+	}
+	f, ok := s.functions[pdu.GetFunctionCode()]
+	if !ok {
+		f = &function{ranges: make(map[rangeKey]*register), exceptions: make(map[uint32]uint64)}
+		s.functions[pdu.GetFunctionCode()] = f
+	}
+	f.polls++
+
+	// ranges only of function codes reading or writing a table, e.g. not diagnostics
+	var reg *register
+	if dissector.TableOf(pdu.GetFunctionCode()) != dissector.TableNone {
+		rk := rangeKey{start: pdu.StartAddress(), quantity: pdu.Quantity()}
+		if reg, ok = f.ranges[rk]; !ok {
+			reg = &register{first: reqTime}
+			f.ranges[rk] = reg
+		}
+		reg.polls++
+		reg.last = reqTime
+	}
+
+	if rsp.IsException() {
+		code := rsp.GetPduResponseException().GetExceptionCode()
+		if reg != nil {
+			reg.exceptions++
+		}
+		f.exceptions[code]++
+		s.exceptions[code]++
+	} else {
+		s.responses++
+	}
+	s.latency.observe(r.Latency())
+}
+
+func (l *latency) observe(d time.Duration) {
+	if l.n == 0 || d < l.min {
+		l.min = d
+	}
+	if d > l.max {
+		l.max = d
+	}
+	l.sum += d
+	l.n++
+}
+
+// Report returns what was collected so far. If snap, the sniffer statistics, is not nil, requests and timeouts
+// are reported too, and slaves which never answered.
+func (inv *Inventory) Report(snap *metrics.Snapshot) (r Report) {
+	inv.mux.Lock()
+	defer inv.mux.Unlock()
+
+	r.Seconds = time.Since(inv.start).Seconds()
+	for k, s := range inv.slaves {
+		sl := Slave{
+			Port:       k.port,
+			Address:    k.address,
+			Responses:  s.responses,
+			Exceptions: copyCounts(s.exceptions),
+		}
+		if s.latency.n > 0 {
+			sl.Latency = Latency{
+				Min:  s.latency.min.Seconds(),
+				Mean: (s.latency.sum / time.Duration(s.latency.n)).Seconds(),
+				Max:  s.latency.max.Seconds(),
+			}
+		}
+		for fc, f := range s.functions {
+			fn := Function{FunctionCode: fc, Polls: f.polls, Exceptions: copyCounts(f.exceptions)}
+			for rk, reg := range f.ranges {
+				rg := Range{
+					Start:      rk.start,
+					Quantity:   rk.quantity,
+					Polls:      reg.polls,
+					Exceptions: reg.exceptions,
+				}
+				if reg.polls > 1 {
+					rg.PeriodSeconds = reg.last.Sub(reg.first).Seconds() / float64(reg.polls-1)
+				}
+				fn.Ranges = append(fn.Ranges, rg)
+			}
+			sort.Slice(fn.Ranges, func(i, j int) bool {
+				if fn.Ranges[i].Start != fn.Ranges[j].Start {
+					return fn.Ranges[i].Start < fn.Ranges[j].Start
+				}
+				return fn.Ranges[i].Quantity < fn.Ranges[j].Quantity
+			})
+			sl.Functions = append(sl.Functions, fn)
+		}
+		sort.Slice(sl.Functions, func(i, j int) bool { return sl.Functions[i].FunctionCode < sl.Functions[j].FunctionCode })
+		r.Slaves = append(r.Slaves, sl)
+	}
+
+	if snap != nil {
+		r.addRequests(snap)
+	}
+	sort.Slice(r.Slaves, func(i, j int) bool {
+		if r.Slaves[i].Port != r.Slaves[j].Port {
+			return r.Slaves[i].Port < r.Slaves[j].Port
+		}
+		return r.Slaves[i].Address < r.Slaves[j].Address
+	})
+	return
+}
+
+// addRequests adds requests and timeouts from sniffer statistics, including slaves which never answered
+func (r *Report) addRequests(snap *metrics.Snapshot) {
+	for _, ss := range snap.Slaves {
+		found := false
+		for i := range r.Slaves {
+			if r.Slaves[i].Port == ss.Port && r.Slaves[i].Address == ss.Address {
+				r.Slaves[i].Requests = ss.Requests
+				r.Slaves[i].Timeouts = ss.Timeouts
+				found = true
+			}
+		}
+		if !found && ss.Requests > 0 {
+			r.Slaves = append(r.Slaves, Slave{Port: ss.Port, Address: ss.Address, Requests: ss.Requests,
+				Timeouts: ss.Timeouts, Exceptions: map[uint32]uint64{}})
+		}
+	}
+}
+
+func copyCounts(m map[uint32]uint64) map[uint32]uint64 {
+	c := make(map[uint32]uint64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,66 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+)
+
+func TestReport(t *testing.T) {
+	req3 := []byte{0x02, 0x03, 0x00, 0x00, 0x00, 0x0A, 0xC5, 0xFE}
+	exc3 := []byte{0x02, 0x83, 0x02, 0x30, 0xF1}
+	req4 := []byte{0x02, 0x04, 0x00, 0x00, 0x00, 0x0A, 0x70, 0x3E}
+	rsp4 := []byte{0x02, 0x04, 0x14, 0x80, 0x03, 0x80, 0x03, 0x80, 0x01, 0x80, 0x01, 0x80, 0x01, 0x80, 0x03, 0x00, 0x37, 0x80, 0x03, 0x80, 0x03, 0x80, 0x03, 0x90, 0x1F}
+
+	// 3 cycles, every 2s
+	var frames []sniffertest.Frame
+	for i := 0; i < 3; i++ {
+		frames = append(frames,
+			sniffertest.Frame{Data: req4, After: time.Second - 10*time.Millisecond},
+			sniffertest.Frame{Data: rsp4, After: 20 * time.Millisecond},
+			sniffertest.Frame{Data: req3, After: time.Second - 20*time.Millisecond},
+			sniffertest.Frame{Data: exc3, After: 10 * time.Millisecond})
+	}
+	frames[0].After = 0
+	// diagnostics, echoed: a function code without ranges
+	diag := []byte{0x02, 0x08, 0x00, 0x00, 0x12, 0x34, 0xED, 0x4F}
+	frames = append(frames, sniffertest.Frame{Data: diag, After: time.Second - 10*time.Millisecond},
+		sniffertest.Frame{Data: diag, After: 10 * time.Millisecond})
+	// an exception is dissected only when followed by enough bytes
+	frames = append(frames, sniffertest.Frame{Data: req4, After: time.Second})
+	results := sniffertest.Dissect(t, "port", frames)
+
+	inv := New()
+	for i := 0; i+1 < len(results); i += 2 {
+		inv.Add(&sniffer.Result{Request: results[i], Response: results[i+1]})
+	}
+
+	r := inv.Report(nil)
+	if len(r.Slaves) != 1 {
+		t.Fatalf("got %d slaves, want 1", len(r.Slaves))
+	}
+	s := r.Slaves[0]
+	if s.Address != 2 || s.Responses != 4 || s.Exceptions[2] != 3 {
+		t.Errorf("got slave %d with %d responses, %v exceptions, want 2 with 4 responses, 3 exceptions code 2",
+			s.Address, s.Responses, s.Exceptions)
+	}
+	if s.Latency.Min != 0.01 || s.Latency.Max != 0.02 {
+		t.Errorf("got latency %v, want min 0.01 max 0.02", s.Latency)
+	}
+	if len(s.Functions) != 3 || s.Functions[0].FunctionCode != 3 || s.Functions[1].FunctionCode != 4 ||
+		s.Functions[2].FunctionCode != 8 {
+		t.Fatalf("got functions %v, want 3, 4 and 8", s.Functions)
+	}
+	if rg := s.Functions[0].Ranges; len(rg) != 1 || rg[0].Exceptions != 3 {
+		t.Errorf("got FC3 ranges %v, want 1 with 3 exceptions", rg)
+	}
+	if rg := s.Functions[1].Ranges; len(rg) != 1 || rg[0].Start != 0 || rg[0].Quantity != 10 || rg[0].Polls != 3 ||
+		rg[0].PeriodSeconds != 2 {
+		t.Errorf("got FC4 ranges %v, want 0+10 polled 3 times every 2s", rg)
+	}
+	if f := s.Functions[2]; f.Polls != 1 || len(f.Ranges) != 0 {
+		t.Errorf("got FC8 polled %d times with ranges %v, want once without ranges", f.Polls, f.Ranges)
+	}
+}
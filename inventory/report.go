@@ -0,0 +1,108 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/andreaaizza/sniffer/util"
+)
+
+// Report slaves seen on the bus
+type Report struct {
+	// Seconds the bus was listened to
+	Seconds float64 `json:"seconds"`
+	Slaves  []Slave `json:"slaves"`
+}
+
+// Slave a slave address, as seen on the port requests are sent on
+type Slave struct {
+	Port    string `json:"port"`
+	Address uint32 `json:"address"`
+
+	// Requests seen, only if reported with sniffer statistics
+	Requests  uint64 `json:"requests"`
+	Responses uint64 `json:"responses"`
+	// Exceptions count by exception code
+	Exceptions map[uint32]uint64 `json:"exceptions"`
+	// Timeouts requests never answered
+	Timeouts uint64 `json:"timeouts"`
+
+	Latency   Latency    `json:"latency"`
+	Functions []Function `json:"functions"`
+}
+
+// Latency of responses and exceptions [seconds]
+type Latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	Max  float64 `json:"max"`
+}
+
+// Function a function code requested to a slave
+type Function struct {
+	FunctionCode uint32 `json:"functionCode"`
+	// Polls requests answered, of any range
+	Polls uint64 `json:"polls"`
+	// Ranges of coils/inputs/registers, none if the function code does not read or write them, e.g. diagnostics
+	Ranges []Range `json:"ranges"`
+	// Exceptions count by exception code
+	Exceptions map[uint32]uint64 `json:"exceptions"`
+}
+
+// Range coils/inputs/registers requested together
+type Range struct {
+	Start    uint32 `json:"start"`
+	Quantity uint32 `json:"quantity"`
+
+	Polls      uint64 `json:"polls"`
+	Exceptions uint64 `json:"exceptions"`
+	// PeriodSeconds mean time between polls, 0 if polled once
+	PeriodSeconds float64 `json:"periodSeconds"`
+}
+
+// WriteTable writes the report as a table, a row for each range, or for each function code without ranges
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "PORT\tSLAVE\tFC\tSTART\tQUANTITY\tPOLLS\tPERIOD\tREQUESTS\tEXCEPTIONS\tTIMEOUTS\tLATENCY (MIN/MEAN/MAX)\n")
+	for _, s := range r.Slaves {
+		fmt.Fprintf(tw, "%s\t%d\t\t\t\t\t\t%d\t%s\t%d\t%v/%v/%v\n", s.Port, s.Address, s.Requests,
+			exceptionsString(s.Exceptions), s.Timeouts,
+			util.Seconds(s.Latency.Min), util.Seconds(s.Latency.Mean), util.Seconds(s.Latency.Max))
+		for _, f := range s.Functions {
+			if len(f.Ranges) == 0 {
+				fmt.Fprintf(tw, "\t\t%d\t\t\t%d\t\t\t%s\t\t\n", f.FunctionCode, f.Polls, exceptionsString(f.Exceptions))
+			}
+			for _, rg := range f.Ranges {
+				fmt.Fprintf(tw, "\t\t%d\t%d\t%d\t%d\t%v\t\t%d\t\t\n", f.FunctionCode, rg.Start, rg.Quantity, rg.Polls,
+					util.Seconds(rg.PeriodSeconds), rg.Exceptions)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+func (r *Report) PrettyString() string {
+	var b strings.Builder
+	r.WriteTable(&b)
+	return b.String()
+}
+
+// exceptionsString returns exceptions as code:count, by code
+func exceptionsString(exceptions map[uint32]uint64) string {
+	codes := make([]int, 0, len(exceptions))
+	for code := range exceptions {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	s := []string{}
+	for _, code := range codes {
+		s = append(s, fmt.Sprintf("%02X:%d", code, exceptions[uint32(code)]))
+	}
+	if len(s) == 0 {
+		return "-"
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,45 @@
+package logger
+
+const (
+	// markEscape starts a PARMRK sequence: \377 \0 <byte> is a byte received with framing or parity error,
+	// \377 \377 is a literal \377
+	markEscape = 0xFF
+)
+
+// markDecoder decodes PARMRK sequences, keeping state across reads as sequences can be split
+type markDecoder struct {
+	pending []byte
+}
+
+// decode returns data without PARMRK sequences, and the offsets in data of bytes received with errors
+func (m *markDecoder) decode(in []byte) (data []byte, errs []uint32) {
+	b := append(m.pending, in...)
+	m.pending = nil
+
+	data = make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != markEscape {
+			data = append(data, b[i])
+			continue
+		}
+		// incomplete sequence, wait for next read
+		if i+1 >= len(b) || (b[i+1] == 0 && i+2 >= len(b)) {
+			m.pending = append([]byte{}, b[i:]...)
+			return
+		}
+		if b[i+1] == markEscape {
+			data = append(data, markEscape)
+			i++
+			continue
+		}
+		if b[i+1] == 0 {
+			errs = append(errs, uint32(len(data)))
+			data = append(data, b[i+2])
+			i += 2
+			continue
+		}
+		// not a sequence
+		data = append(data, b[i])
+	}
+	return
+}
@@ -0,0 +1,28 @@
+package logger
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// enableErrorMarking configures the tty so that bytes received with framing or parity errors are delivered
+// after a \377 \0 mark (PARMRK), instead of as they are
+func enableErrorMarking(name string) (err error) {
+	fd, err := unix.Open(name, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return
+	}
+	defer unix.Close(fd)
+
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return
+	}
+	t.Iflag |= unix.INPCK | unix.PARMRK
+	t.Iflag &^= unix.IGNPAR | unix.ISTRIP
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(unix.TCSETS), uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return
+}
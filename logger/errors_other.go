@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package logger
+
+import "fmt"
+
+// enableErrorMarking is only supported on linux
+func enableErrorMarking(name string) error {
+	return fmt.Errorf("marking bytes received with errors is not supported on this OS")
+}
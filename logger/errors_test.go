@@ -0,0 +1,37 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestMarkDecoder(t *testing.T) {
+	tests := []struct {
+		name string
+		// reads decoded in turn
+		reads [][]byte
+		// want data and errors of each read
+		data [][]byte
+		errs [][]uint32
+	}{
+		{"escape", [][]byte{{0x01, 0xFF, 0xFF, 0x02}}, [][]byte{{0x01, 0xFF, 0x02}}, [][]uint32{nil}},
+		{"marked", [][]byte{{0x01, 0xFF, 0x00, 0x55, 0x02, 0xFF, 0x00, 0xFF}},
+			[][]byte{{0x01, 0x55, 0x02, 0xFF}}, [][]uint32{{1, 3}}},
+		{"not a sequence", [][]byte{{0xFF, 0x01}}, [][]byte{{0xFF, 0x01}}, [][]uint32{nil}},
+		{"mark split", [][]byte{{0x01, 0xFF}, {0x00, 0x55, 0x02}},
+			[][]byte{{0x01}, {0x55, 0x02}}, [][]uint32{nil, {0}}},
+		{"mark split twice", [][]byte{{0xFF}, {0x00}, {0x55}},
+			[][]byte{{}, {}, {0x55}}, [][]uint32{nil, nil, {0}}},
+		{"escape split", [][]byte{{0x01, 0xFF}, {0xFF}}, [][]byte{{0x01}, {0xFF}}, [][]uint32{nil, nil}},
+	}
+	for _, tt := range tests {
+		var m markDecoder
+		for i, read := range tt.reads {
+			data, errs := m.decode(read)
+			if !bytes.Equal(data, tt.data[i]) || fmt.Sprint(errs) != fmt.Sprint(tt.errs[i]) {
+				t.Errorf("%s: read %d: got %02X %v, want %02X %v", tt.name, i, data, errs, tt.data[i], tt.errs[i])
+			}
+		}
+	}
+}
@@ -2,10 +2,14 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/andreaaizza/sniffer/metrics"
 	"github.com/andreaaizza/sniffer/util"
 	"github.com/tarm/serial"
 )
@@ -13,6 +17,12 @@ import (
 const (
 	// bufSize read buffer size
 	bufSize = 256
+
+	// readTimeout serial reads return after this time without data, so that the logger can be stopped
+	readTimeout = 100 * time.Millisecond
+
+	// maxFastEOFs a port returning this many EOFs in a row well before readTimeout is hung up
+	maxFastEOFs = 10
 )
 
 const (
@@ -30,14 +40,44 @@ type Config struct {
 	FlushAfterSeconds int
 
 	Debug bool
+
+	// MarkErrors reports bytes received with framing or parity errors in DataUnit.FramingErrors (linux only).
+	// Reading a line with parity at no parity, such errors tell the parity bit of each byte.
+	MarkErrors bool
+
+	// Reconnect reopens the port when it fails, e.g. USB adapter unplugged, instead of reporting the failure to Err()
+	Reconnect bool
+
+	// Metrics optional, collects bus statistics
+	Metrics *metrics.Metrics
+}
+
+// port a serial port, or a fake one in tests
+type port interface {
+	Read(b []byte) (int, error)
+	Flush() error
+	Close() error
+}
+
+// openSerial opens a serial port
+func openSerial(c *serial.Config) (port, error) {
+	return serial.OpenPort(c)
 }
 
 type Logger struct {
 	LoggerBuffer
-	consumers []chan DataUnit
-
-	serialPort interface{}
-	stop       chan struct{}
+	consumers []chan *DataUnit
+
+	serialPort port
+	openPort   func(c *serial.Config) (port, error)
+	// byID by-id link of the port, re-resolved at each open
+	byID                   string
+	byIDDir                string
+	backoffMin, backoffMax time.Duration
+	marks                  markDecoder
+	stop                   chan struct{}
+	wg                     sync.WaitGroup
+	errs                   chan error
 
 	config Config
 }
@@ -46,23 +86,59 @@ func (c *Config) PrettyString() string {
 	return fmt.Sprintf("port: %s, baud: %d, frame format: %s", c.Port, c.Baud, c.FrameFormat)
 }
 
+// BitsPerChar returns the number of bits on the line for each byte: start, data, parity and stop bits
+func (c *Config) BitsPerChar() float64 {
+	if len(c.FrameFormat) < 3 {
+		return 0
+	}
+	bits := 1.0
+	if size, err := strconv.Atoi(c.FrameFormat[:1]); err == nil {
+		bits += float64(size)
+	}
+	if c.FrameFormat[1:2] != "N" {
+		bits++
+	}
+	switch c.FrameFormat[2:] {
+	case "2":
+		bits += 2
+	case "15":
+		bits += 1.5
+	default:
+		bits++
+	}
+	return bits
+}
+
 // New builds new logger with specified Config
 func New(c *Config) (l *Logger, err error) {
+	l = newLogger(c, openSerial)
+	err = l.initLoggerBuffer()
+	return
+}
+
+// newLogger builds a logger opening ports with open, not started
+func newLogger(c *Config, open func(c *serial.Config) (port, error)) *Logger {
 	// set FlushAfterSeconds
 	if c.FlushAfterSeconds > LoggerFlushAfterSecondsMax {
 		log.Printf("Limiting FlushAfterSeconds to %d", LoggerFlushAfterSecondsMax)
 		c.FlushAfterSeconds = LoggerFlushAfterSecondsMax
 	}
 
-	consumers := make([]chan DataUnit, 0)
-	l = &Logger{
+	consumers := make([]chan *DataUnit, 0)
+	l := &Logger{
 		consumers: consumers,
 		config:    *c,
 
+		openPort:   open,
+		byIDDir:    serialByIDDir,
+		backoffMin: reconnectBackoffMin,
+		backoffMax: reconnectBackoffMax,
+
 		stop: make(chan struct{}, 0),
+		errs: make(chan error, 1),
 	}
-	err = l.initLoggerBuffer()
-	return
+	c.Metrics.AddPort(c.Port, c.Baud, c.BitsPerChar())
+	return l
 }
 
 // getSerialConfig returns config built from specific logger config string
@@ -101,7 +177,7 @@ func (l *Logger) getSerialConfig() (c *serial.Config, err error) {
 	}
 
 	c = &serial.Config{Name: l.config.Port, Baud: l.config.Baud,
-		Size: byte(size), Parity: par, StopBits: stp}
+		Size: byte(size), Parity: par, StopBits: stp, ReadTimeout: readTimeout}
 	return
 }
 
@@ -111,10 +187,20 @@ func (l *Logger) Unsubscribe() {
 }
 
 // Subscribe sends each new DataUnit to specified channel
-func (l *Logger) Subscribe(c chan DataUnit) {
+func (l *Logger) Subscribe(c chan *DataUnit) {
 	l.consumers = append(l.consumers, c)
 }
 
+// MarkingErrors returns true if bytes received with errors are reported, see Config.MarkErrors
+func (l *Logger) MarkingErrors() bool {
+	return l.config.MarkErrors
+}
+
+// Err returns the channel a port failure is sent to. The logger stops reading after a failure.
+func (l *Logger) Err() <-chan error {
+	return l.errs
+}
+
 // Close closes
 func (l *Logger) Close() {
 	// unsubscribe
@@ -122,14 +208,12 @@ func (l *Logger) Close() {
 
 	// terminate go routing
 	close(l.stop)
+	l.wg.Wait()
 
 	// close port
-	port, ok := l.serialPort.(serial.Port)
-	if ok {
-		port.Flush()
-		port.Close()
-	} else {
-		log.Print("serialPort type not handled")
+	if l.serialPort != nil {
+		l.serialPort.Flush()
+		l.serialPort.Close()
 	}
 
 	// Reset
@@ -149,6 +233,9 @@ func (lb *LoggerBuffer) PrettyString() (s string) {
 }
 
 func (du *DataUnit) PrettyString() string {
+	if du.GetGap() {
+		return fmt.Sprintf("[%v]GAP", util.TimeBuilder(du.GetTime()).UnixNano())
+	}
 	return fmt.Sprintf("[%v]%02X[%03d]", util.TimeBuilder(du.GetTime()).UnixNano(), du.GetData(), len(du.GetData()))
 }
 
@@ -163,54 +250,161 @@ func (l *Logger) initLoggerBuffer() (err error) {
 		return
 	}
 
-	port, err := serial.OpenPort(lConfig)
+	p, err := l.open(lConfig)
 	if err != nil {
 		return
 	}
-	l.serialPort = *port
+	l.serialPort = p
+	l.config.Metrics.SetConnected(l.config.Port, true)
 
+	l.wg.Add(1)
 	go func() {
+		defer l.wg.Done()
+
 		for {
-			select {
-			case <-l.stop:
+			err := l.read(p)
+			if err == nil {
+				// stopped
 				return
-			default:
-				// get data
-				buf := make([]byte, bufSize)
-
-				n, err := port.Read(buf)
-				time := time.Now().UTC()
-				if err != nil {
-					log.Print(err)
-					continue
-				}
-				//log.Printf("NEW DATA [%03d]: %02X %03d", n, buf[:n], buf[:n]) // LOG
+			}
+			if !l.config.Reconnect {
+				l.fail(err)
+				return
+			}
 
-				// push to LoggerBuffer
-				t := util.TimestampBuilder(time)
-				du := DataUnit{
-					Data: buf[:n],
-					Time: &t,
-				}
+			// reconnect
+			log.Printf("Reading %s: %v. Reconnecting...", l.config.Port, err)
+			l.config.Metrics.SetConnected(l.config.Port, false)
+			p.Close()
+			l.serialPort = nil
+			if p = l.reopen(); p == nil {
+				// stopped
+				return
+			}
+			l.serialPort = p
+			l.config.Metrics.SetConnected(l.config.Port, true)
+			l.config.Metrics.AddReconnect(l.config.Port)
+
+			// data was lost while disconnected
+			t := util.TimestampBuilder(time.Now().UTC())
+			if !l.feed(&DataUnit{Time: &t, Gap: true}) {
+				return
+			}
+		}
+	}()
 
-				l.DataUnit = append(l.DataUnit, &du)
+	return
+}
 
-				// feed consumers
-				for _, c := range l.consumers {
-					c <- du
+// open opens port, enabling error marking if configured. If reconnecting, resolves the by-id link of the port, as it
+// may not exist yet when first opened.
+func (l *Logger) open(c *serial.Config) (p port, err error) {
+	p, err = l.openPort(c)
+	if err != nil {
+		return
+	}
+	if l.config.Reconnect {
+		if link := byIDLink(c.Name, l.byIDDir); link != "" {
+			l.byID = link
+		}
+	}
+	if l.config.MarkErrors {
+		if err := enableErrorMarking(c.Name); err != nil {
+			log.Printf("Cannot mark errors on %s: %v", c.Name, err)
+			l.config.MarkErrors = false
+		}
+	}
+	l.marks = markDecoder{}
+	return
+}
 
-					if l.config.Debug {
-						log.Print("Data received: ", du.PrettyString())
-					}
+// read reads data from port and feeds consumers until stopped (returns nil) or port fails (returns error)
+func (l *Logger) read(p port) (err error) {
+	fastEOFs := 0
+	for {
+		select {
+		case <-l.stop:
+			return nil
+		default:
+			// get data
+			buf := make([]byte, bufSize)
+
+			start := time.Now()
+			n, err := p.Read(buf)
+			time := time.Now().UTC()
+			if err == io.EOF && n == 0 {
+				// read timeout, or port hung up if it returns immediately
+				if time.Sub(start) > readTimeout/2 {
+					fastEOFs = 0
+					continue
 				}
+				fastEOFs++
+				if _, statErr := os.Stat(l.config.Port); statErr == nil && fastEOFs < maxFastEOFs {
+					continue
+				}
+				err = fmt.Errorf("port hung up")
+			}
+			if err != nil {
+				return err
+			}
+			fastEOFs = 0
+			//log.Printf("NEW DATA [%03d]: %02X %03d", n, buf[:n], buf[:n]) // LOG
+
+			// push to LoggerBuffer
+			t := util.TimestampBuilder(time)
+			du := &DataUnit{
+				Data: buf[:n],
+				Time: &t,
+			}
+			l.config.Metrics.AddBytes(l.config.Port, n, time)
+			if l.config.MarkErrors {
+				if du.Data, du.FramingErrors = l.marks.decode(du.Data); len(du.Data) == 0 {
+					continue
+				}
+			}
 
-				// Flush every time new data is received
-				l.flush()
+			l.DataUnit = append(l.DataUnit, du)
+
+			// feed consumers
+			if !l.feed(du) {
+				return nil
 			}
+
+			// Flush every time new data is received
+			l.flush()
 		}
-	}()
+	}
+}
 
-	return
+// feed sends du to consumers, returns false if stopped
+func (l *Logger) feed(du *DataUnit) bool {
+	for _, c := range l.consumers {
+		select {
+		case c <- du:
+		case <-l.stop:
+			return false
+		}
+
+		if l.config.Debug {
+			log.Print("Data received: ", du.PrettyString())
+		}
+	}
+	return true
+}
+
+// fail reports a port failure, unless the logger is being closed
+func (l *Logger) fail(err error) {
+	select {
+	case <-l.stop:
+		return
+	default:
+	}
+	err = fmt.Errorf("reading %s: %w", l.config.Port, err)
+	log.Print(err)
+	select {
+	case l.errs <- err:
+	default:
+	}
 }
 
 // flush flushes
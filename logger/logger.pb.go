@@ -79,8 +79,10 @@ type DataUnit struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Time *timestamp.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
-	Data []byte               `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	Time          *timestamp.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Data          []byte               `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	Gap           bool                 `protobuf:"varint,3,opt,name=gap,proto3" json:"gap,omitempty"`                            // data was lost before this DataUnit, e.g. the port was reconnected
+	FramingErrors []uint32             `protobuf:"varint,4,rep,packed,name=framingErrors,proto3" json:"framingErrors,omitempty"` // offsets in data of bytes received with framing or parity errors, see Config.MarkErrors
 }
 
 func (x *DataUnit) Reset() {
@@ -129,6 +131,20 @@ func (x *DataUnit) GetData() []byte {
 	return nil
 }
 
+func (x *DataUnit) GetGap() bool {
+	if x != nil {
+		return x.Gap
+	}
+	return false
+}
+
+func (x *DataUnit) GetFramingErrors() []uint32 {
+	if x != nil {
+		return x.FramingErrors
+	}
+	return nil
+}
+
 var File_logger_logger_proto protoreflect.FileDescriptor
 
 var file_logger_logger_proto_rawDesc = []byte{
@@ -139,15 +155,19 @@ var file_logger_logger_proto_rawDesc = []byte{
 	0x0a, 0x0c, 0x4c, 0x6f, 0x67, 0x67, 0x65, 0x72, 0x42, 0x75, 0x66, 0x66, 0x65, 0x72, 0x12, 0x2c,
 	0x0a, 0x08, 0x64, 0x61, 0x74, 0x61, 0x55, 0x6e, 0x69, 0x74, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b,
 	0x32, 0x10, 0x2e, 0x6c, 0x6f, 0x67, 0x67, 0x65, 0x72, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x55, 0x6e,
-	0x69, 0x74, 0x52, 0x08, 0x64, 0x61, 0x74, 0x61, 0x55, 0x6e, 0x69, 0x74, 0x22, 0x4e, 0x0a, 0x08,
-	0x44, 0x61, 0x74, 0x61, 0x55, 0x6e, 0x69, 0x74, 0x12, 0x2e, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
-	0x6d, 0x70, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x42, 0x27, 0x5a, 0x25,
-	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x6e, 0x64, 0x72, 0x65,
-	0x61, 0x61, 0x69, 0x7a, 0x7a, 0x61, 0x2f, 0x73, 0x6e, 0x69, 0x66, 0x66, 0x65, 0x72, 0x2f, 0x6c,
-	0x6f, 0x67, 0x67, 0x65, 0x72, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x69, 0x74, 0x52, 0x08, 0x64, 0x61, 0x74, 0x61, 0x55, 0x6e, 0x69, 0x74, 0x22, 0x86, 0x01, 0x0a,
+	0x08, 0x44, 0x61, 0x74, 0x61, 0x55, 0x6e, 0x69, 0x74, 0x12, 0x2e, 0x0a, 0x04, 0x74, 0x69, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74,
+	0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x10, 0x0a,
+	0x03, 0x67, 0x61, 0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x03, 0x67, 0x61, 0x70, 0x12,
+	0x24, 0x0a, 0x0d, 0x66, 0x72, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x73,
+	0x18, 0x04, 0x20, 0x03, 0x28, 0x0d, 0x52, 0x0d, 0x66, 0x72, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x45,
+	0x72, 0x72, 0x6f, 0x72, 0x73, 0x42, 0x27, 0x5a, 0x25, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x6e, 0x64, 0x72, 0x65, 0x61, 0x61, 0x69, 0x7a, 0x7a, 0x61, 0x2f,
+	0x73, 0x6e, 0x69, 0x66, 0x66, 0x65, 0x72, 0x2f, 0x6c, 0x6f, 0x67, 0x67, 0x65, 0x72, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
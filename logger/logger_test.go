@@ -0,0 +1,244 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/metrics"
+	"github.com/tarm/serial"
+)
+
+// fakePort returns data sent to reads, fails when reads is closed
+type fakePort struct {
+	reads  chan []byte
+	closed bool
+}
+
+func newFakePort() *fakePort {
+	return &fakePort{reads: make(chan []byte)}
+}
+
+func (f *fakePort) Read(b []byte) (int, error) {
+	select {
+	case data, ok := <-f.reads:
+		if !ok {
+			return 0, fmt.Errorf("unplugged")
+		}
+		return copy(b, data), nil
+	case <-time.After(readTimeout):
+		return 0, io.EOF
+	}
+}
+
+func (f *fakePort) Flush() error { return nil }
+func (f *fakePort) Close() error { f.closed = true; return nil }
+
+// fakeOpener opens ports returned by open for the name, recording attempts
+type fakeOpener struct {
+	mux   sync.Mutex
+	open  func(name string) *fakePort
+	names []string
+	times []time.Time
+}
+
+func (o *fakeOpener) openPort(c *serial.Config) (port, error) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	o.names = append(o.names, c.Name)
+	o.times = append(o.times, time.Now())
+	if p := o.open(c.Name); p != nil {
+		return p, nil
+	}
+	return nil, fmt.Errorf("no such device %s", c.Name)
+}
+
+func receive(t *testing.T, c chan *DataUnit) *DataUnit {
+	select {
+	case du := <-c:
+		return du
+	case <-time.After(5 * time.Second):
+		t.Fatal("got no data")
+		return nil
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	p1, p2 := newFakePort(), newFakePort()
+	attempt := 0
+	o := &fakeOpener{open: func(string) *fakePort {
+		attempt++
+		switch attempt {
+		case 1:
+			return p1
+		case 7:
+			return p2
+		}
+		return nil
+	}}
+	m := metrics.New()
+	l := newLogger(&Config{Port: "/dev/ttyFAKE0", Baud: 9600, FrameFormat: "8N1", Reconnect: true, Metrics: m},
+		o.openPort)
+	l.byIDDir = t.TempDir()
+	l.backoffMin, l.backoffMax = 20*time.Millisecond, 40*time.Millisecond
+	c := make(chan *DataUnit)
+	l.Subscribe(c)
+	if err := l.initLoggerBuffer(); err != nil {
+		t.Fatal(err)
+	}
+
+	p1.reads <- []byte{0x01, 0x02}
+	if du := receive(t, c); !bytes.Equal(du.GetData(), []byte{0x01, 0x02}) || du.GetGap() {
+		t.Errorf("got %s", du.PrettyString())
+	}
+
+	// unplugged, 5 failed attempts, reconnected
+	close(p1.reads)
+	if du := receive(t, c); !du.GetGap() || len(du.GetData()) != 0 {
+		t.Errorf("got %s, want a gap", du.PrettyString())
+	}
+	p2.reads <- []byte{0x03, 0x04}
+	if du := receive(t, c); !bytes.Equal(du.GetData(), []byte{0x03, 0x04}) || du.GetGap() {
+		t.Errorf("got %s", du.PrettyString())
+	}
+	l.Close()
+	if !p1.closed || !p2.closed {
+		t.Error("got ports not closed")
+	}
+
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if len(o.names) != 7 {
+		t.Fatalf("got %d attempts, want 7", len(o.names))
+	}
+	// waits double from 20ms up to 40ms
+	want := []time.Duration{40, 40, 40, 40, 40}
+	for i, w := range want {
+		if d := o.times[i+2].Sub(o.times[i+1]); d < w*time.Millisecond {
+			t.Errorf("got wait %v before attempt %d, want at least %dms", d, i+3, w)
+		}
+	}
+	if total := o.times[6].Sub(o.times[1]); total >= 600*time.Millisecond {
+		t.Errorf("got %v waiting, want waits capped", total)
+	}
+
+	snap := m.Snapshot()
+	if len(snap.Ports) != 1 || snap.Ports[0].Reconnects != 1 || !snap.Ports[0].Connected {
+		t.Errorf("got %+v, want 1 reconnect, connected", snap.Ports)
+	}
+}
+
+func TestReconnectByID(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "ttyUSB0")
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	byIDDir := filepath.Join(dir, "by-id")
+	if err := os.Mkdir(byIDDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(byIDDir, "usb-adapter-port0")
+
+	// the by-id link appears after the port is first opened, then the adapter comes back under another node
+	ports := []*fakePort{newFakePort(), newFakePort(), newFakePort()}
+	o := &fakeOpener{open: func(n string) *fakePort {
+		if len(ports) == 1 && n == name {
+			return nil
+		}
+		p := ports[0]
+		ports = ports[1:]
+		return p
+	}}
+	l := newLogger(&Config{Port: name, Baud: 9600, FrameFormat: "8N1", Reconnect: true}, o.openPort)
+	l.byIDDir = byIDDir
+	l.backoffMin, l.backoffMax = time.Millisecond, time.Millisecond
+	c := make(chan *DataUnit)
+	l.Subscribe(c)
+	first, second, third := ports[0], ports[1], ports[2]
+	if err := l.initLoggerBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../ttyUSB0", link); err != nil {
+		t.Fatal(err)
+	}
+
+	close(first.reads)
+	if du := receive(t, c); !du.GetGap() {
+		t.Errorf("got %s, want a gap", du.PrettyString())
+	}
+	close(second.reads)
+	if du := receive(t, c); !du.GetGap() {
+		t.Errorf("got %s, want a gap", du.PrettyString())
+	}
+	third.reads <- []byte{0x01}
+	receive(t, c)
+	l.Close()
+
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	want := []string{name, name, name, link}
+	if fmt.Sprint(o.names) != fmt.Sprint(want) {
+		t.Errorf("got attempts %v, want %v", o.names, want)
+	}
+}
+
+func TestFail(t *testing.T) {
+	p := newFakePort()
+	o := &fakeOpener{open: func(string) *fakePort { return p }}
+	l := newLogger(&Config{Port: "/dev/ttyFAKE0", Baud: 9600, FrameFormat: "8N1"}, o.openPort)
+	if err := l.initLoggerBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	close(p.reads)
+	select {
+	case err := <-l.Err():
+		if err == nil || err.Error() != "reading /dev/ttyFAKE0: unplugged" {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("got no failure")
+	}
+}
+
+func TestByIDLink(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{"ttyUSB0", "ttyUSB1"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, n), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	byIDDir := filepath.Join(dir, "by-id")
+	if err := os.Mkdir(byIDDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../ttyUSB1", filepath.Join(byIDDir, "usb-adapter-port0")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := byIDLink(filepath.Join(dir, "ttyUSB1"), byIDDir); got != filepath.Join(byIDDir, "usb-adapter-port0") {
+		t.Errorf("got %q", got)
+	}
+	if got := byIDLink(filepath.Join(dir, "ttyUSB0"), byIDDir); got != "" {
+		t.Errorf("got %q for a port without link", got)
+	}
+	if got := byIDLink(filepath.Join(dir, "ttyUSB2"), byIDDir); got != "" {
+		t.Errorf("got %q for a missing port", got)
+	}
+}
+
+func TestNearestSpeed(t *testing.T) {
+	for speed, want := range map[int]int{9600: 9600, 14400: 19200, 28800: 38400, 76800: 57600, 10: 50, 5000000: 4000000} {
+		if got := NearestSpeed(speed); got != want {
+			t.Errorf("%d: got %d, want %d", speed, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// reconnectBackoffMin first wait before reopening a failed port
+	reconnectBackoffMin = 500 * time.Millisecond
+
+	// reconnectBackoffMax wait between attempts doubles up to this
+	reconnectBackoffMax = 30 * time.Second
+
+	// serialByIDDir persistent names of serial devices on linux
+	serialByIDDir = "/dev/serial/by-id"
+)
+
+// reopen tries opening the port with backoff until success, returns nil if stopped.
+// Tries the configured port name first, then the by-id link it had when last opened,
+// as an USB adapter can come back with a different device node.
+func (l *Logger) reopen() port {
+	c, err := l.getSerialConfig()
+	if err != nil {
+		// config was valid when first opened
+		log.Print(err)
+		return nil
+	}
+	names := []string{l.config.Port}
+	if l.byID != "" && l.byID != l.config.Port {
+		names = append(names, l.byID)
+	}
+
+	backoff := l.backoffMin
+	for {
+		select {
+		case <-l.stop:
+			return nil
+		case <-time.After(backoff):
+		}
+
+		for _, name := range names {
+			c.Name = name
+			p, err := l.open(c)
+			if err == nil {
+				if real, err := filepath.EvalSymlinks(name); err == nil && real != name {
+					name += " (" + real + ")"
+				}
+				log.Printf("Reconnected %s as %s", l.config.Port, name)
+				return p
+			}
+			if l.config.Debug {
+				log.Printf("Reconnecting %s: %v", name, err)
+			}
+		}
+
+		backoff *= 2
+		if backoff > l.backoffMax {
+			backoff = l.backoffMax
+		}
+	}
+}
+
+// byIDLink returns the link in dir, e.g. serialByIDDir, pointing to the same device as port, or empty string
+func byIDLink(port string, dir string) string {
+	real, err := filepath.EvalSymlinks(port)
+	if err != nil {
+		return ""
+	}
+	links, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return ""
+	}
+	for _, link := range links {
+		if target, err := filepath.EvalSymlinks(link); err == nil && target == real {
+			return link
+		}
+	}
+	return ""
+}
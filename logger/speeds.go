@@ -0,0 +1,18 @@
+package logger
+
+import "math"
+
+// Speeds baud rates a port can be opened at: the serial driver has no custom rates on linux
+var Speeds = []int{50, 75, 110, 134, 150, 200, 300, 600, 1200, 1800, 2400, 4800, 9600, 19200, 38400, 57600, 115200,
+	230400, 460800, 500000, 576000, 921600, 1000000, 1152000, 1500000, 2000000, 2500000, 3000000, 3500000, 4000000}
+
+// NearestSpeed returns the speed of Speeds nearest to speed, by ratio: the width of their bits differs the least
+func NearestSpeed(speed int) int {
+	nearest := Speeds[0]
+	for _, s := range Speeds {
+		if math.Abs(math.Log(float64(s)/float64(speed))) < math.Abs(math.Log(float64(nearest)/float64(speed))) {
+			nearest = s
+		}
+	}
+	return nearest
+}
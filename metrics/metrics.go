@@ -0,0 +1,360 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// RateWindowSeconds rates (bytes/s, frames/s, utilisation) are averaged over this window [seconds]
+	RateWindowSeconds = 10
+)
+
+// LatencyBuckets upper bounds [seconds] of the response latency histograms
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Metrics collects bus health statistics. It is fed by Logger (bytes), Dissector (frames) and
+// Sniffer (transactions). All methods are safe for concurrent use and can be called on a nil *Metrics,
+// which is a no-op.
+type Metrics struct {
+	mux sync.Mutex
+
+	start  time.Time
+	ports  map[string]*port
+	slaves map[slaveKey]*slave
+}
+
+type port struct {
+	baud        int
+	bitsPerChar float64
+
+	bytes         uint64
+	frames        uint64
+	invalidFrames uint64
+	invalidBytes  uint64
+
+	connected  bool
+	reconnects uint64
+
+	byteRate  rate
+	frameRate rate
+}
+
+type slaveKey struct {
+	port    string
+	address uint32
+}
+
+type slave struct {
+	functions map[uint32]*function
+	latency   histogram
+}
+
+type function struct {
+	requests   uint64
+	responses  uint64
+	timeouts   uint64
+	exceptions map[uint32]uint64
+}
+
+// New builds empty Metrics
+func New() *Metrics {
+	return &Metrics{
+		start:  time.Now(),
+		ports:  make(map[string]*port),
+		slaves: make(map[slaveKey]*slave),
+	}
+}
+
+// AddPort registers a port with its line settings, needed to compute bus utilisation
+func (m *Metrics) AddPort(name string, baud int, bitsPerChar float64) {
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	p := m.port(name)
+	p.baud = baud
+	p.bitsPerChar = bitsPerChar
+}
+
+// SetConnected records whether port is open
+func (m *Metrics) SetConnected(name string, connected bool) {
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.port(name).connected = connected
+}
+
+// AddReconnect records port was reopened after a failure
+func (m *Metrics) AddReconnect(name string) {
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.port(name).reconnects++
+}
+
+// AddBytes records n bytes read from port at time t
+func (m *Metrics) AddBytes(name string, n int, t time.Time) {
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	p := m.port(name)
+	p.bytes += uint64(n)
+	p.byteRate.add(t, uint64(n))
+}
+
+// AddFrame records a valid (CRC checked) frame dissected on port at time t
+func (m *Metrics) AddFrame(name string, t time.Time) {
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	p := m.port(name)
+	p.frames++
+	p.frameRate.add(t, 1)
+}
+
+// AddInvalid records a run of n bytes discarded from port because they never built a valid frame
+// (CRC errors, truncated or out of sync data)
+func (m *Metrics) AddInvalid(name string, n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	p := m.port(name)
+	p.invalidFrames++
+	p.invalidBytes += uint64(n)
+}
+
+// AddRequest records a request sent to slave address
+func (m *Metrics) AddRequest(name string, address uint32, functionCode uint32) {
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.function(name, address, functionCode).requests++
+}
+
+// AddResponse records a response to a request, received after latency
+func (m *Metrics) AddResponse(name string, address uint32, functionCode uint32, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.function(name, address, functionCode).responses++
+	m.slave(name, address).latency.observe(latency.Seconds())
+}
+
+// AddException records an exception with exceptionCode to a request, received after latency
+func (m *Metrics) AddException(name string, address uint32, functionCode uint32, exceptionCode uint32, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.function(name, address, functionCode).exceptions[exceptionCode]++
+	m.slave(name, address).latency.observe(latency.Seconds())
+}
+
+// AddTimeout records a request which never got a response or an exception
+func (m *Metrics) AddTimeout(name string, address uint32, functionCode uint32) {
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.function(name, address, functionCode).timeouts++
+}
+
+// port returns the port, creating it if needed. Needs lock held.
+func (m *Metrics) port(name string) *port {
+	p, ok := m.ports[name]
+	if !ok {
+		p = &port{}
+		m.ports[name] = p
+	}
+	return p
+}
+
+// slave returns the slave, creating it if needed. Needs lock held.
+func (m *Metrics) slave(name string, address uint32) *slave {
+	k := slaveKey{port: name, address: address}
+	s, ok := m.slaves[k]
+	if !ok {
+		s = &slave{
+			functions: make(map[uint32]*function),
+			latency:   newHistogram(LatencyBuckets),
+		}
+		m.slaves[k] = s
+	}
+	return s
+}
+
+// function returns the function of a slave, creating it if needed. Needs lock held.
+func (m *Metrics) function(name string, address uint32, functionCode uint32) *function {
+	s := m.slave(name, address)
+	f, ok := s.functions[functionCode]
+	if !ok {
+		f = &function{exceptions: make(map[uint32]uint64)}
+		s.functions[functionCode] = f
+	}
+	return f
+}
+
+// Snapshot returns a consistent copy of all statistics, with rates calculated at current time
+func (m *Metrics) Snapshot() (s Snapshot) {
+	now := time.Now()
+	s.Time = now
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	s.UptimeSeconds = now.Sub(m.start).Seconds()
+
+	for name, p := range m.ports {
+		ps := PortSnapshot{
+			Port:            name,
+			Baud:            p.baud,
+			Bytes:           p.bytes,
+			Frames:          p.frames,
+			InvalidFrames:   p.invalidFrames,
+			InvalidBytes:    p.invalidBytes,
+			Connected:       p.connected,
+			Reconnects:      p.reconnects,
+			BytesPerSecond:  p.byteRate.perSecond(now),
+			FramesPerSecond: p.frameRate.perSecond(now),
+		}
+		if p.baud > 0 {
+			ps.Utilisation = 100 * ps.BytesPerSecond * p.bitsPerChar / float64(p.baud)
+		}
+		ps.CRCErrorRate = ratio(p.invalidFrames, p.frames+p.invalidFrames)
+		s.Ports = append(s.Ports, ps)
+	}
+	sort.Slice(s.Ports, func(i, j int) bool { return s.Ports[i].Port < s.Ports[j].Port })
+
+	for k, sl := range m.slaves {
+		ss := SlaveSnapshot{
+			Port:    k.port,
+			Address: k.address,
+			Latency: sl.latency.snapshot(),
+		}
+		for fc, f := range sl.functions {
+			fs := FunctionSnapshot{
+				FunctionCode: fc,
+				Requests:     f.requests,
+				Responses:    f.responses,
+				Timeouts:     f.timeouts,
+				Exceptions:   make(map[uint32]uint64),
+			}
+			for code, n := range f.exceptions {
+				fs.Exceptions[code] = n
+				ss.Exceptions += n
+			}
+			ss.Requests += f.requests
+			ss.Responses += f.responses
+			ss.Timeouts += f.timeouts
+			ss.Functions = append(ss.Functions, fs)
+		}
+		sort.Slice(ss.Functions, func(i, j int) bool { return ss.Functions[i].FunctionCode < ss.Functions[j].FunctionCode })
+		ss.ExceptionRate = ratio(ss.Exceptions, ss.Requests)
+		ss.TimeoutRate = ratio(ss.Timeouts, ss.Requests)
+		s.Slaves = append(s.Slaves, ss)
+	}
+	sort.Slice(s.Slaves, func(i, j int) bool {
+		if s.Slaves[i].Port != s.Slaves[j].Port {
+			return s.Slaves[i].Port < s.Slaves[j].Port
+		}
+		return s.Slaves[i].Address < s.Slaves[j].Address
+	})
+	return
+}
+
+func ratio(n uint64, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// rate counts events in one second buckets over RateWindowSeconds
+type rate struct {
+	buckets [RateWindowSeconds]uint64
+	seconds [RateWindowSeconds]int64
+}
+
+func (r *rate) add(t time.Time, n uint64) {
+	sec := t.Unix()
+	i := sec % RateWindowSeconds
+	if r.seconds[i] != sec {
+		r.seconds[i] = sec
+		r.buckets[i] = 0
+	}
+	r.buckets[i] += n
+}
+
+// perSecond average over the last RateWindowSeconds complete seconds before now
+func (r *rate) perSecond(now time.Time) float64 {
+	var sum uint64
+	last := now.Unix() - 1
+	for i := range r.buckets {
+		if r.seconds[i] <= last && r.seconds[i] > last-RateWindowSeconds {
+			sum += r.buckets[i]
+		}
+	}
+	return float64(sum) / RateWindowSeconds
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64 // not cumulative, last one is +Inf
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) snapshot() (s Histogram) {
+	s.Bounds = append([]float64{}, h.bounds...)
+	s.Counts = make([]uint64, len(h.bounds))
+	var c uint64
+	for i := range h.bounds {
+		c += h.counts[i]
+		s.Counts[i] = c
+	}
+	s.Count = h.count
+	s.Sum = h.sum
+	return
+}
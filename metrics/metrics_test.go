@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	m := New()
+	m.AddPort("/dev/ttyUSB0", 9600, 10)
+
+	// 960 bytes/s over the whole window is 100% of 9600 8N1
+	now := time.Now()
+	for i := 1; i <= RateWindowSeconds; i++ {
+		m.AddBytes("/dev/ttyUSB0", 960, now.Add(-time.Duration(i)*time.Second))
+	}
+	m.AddFrame("/dev/ttyUSB0", now)
+	m.AddFrame("/dev/ttyUSB0", now)
+	m.AddFrame("/dev/ttyUSB0", now)
+	m.AddInvalid("/dev/ttyUSB0", 3)
+
+	m.AddRequest("/dev/ttyUSB0", 2, 3)
+	m.AddRequest("/dev/ttyUSB0", 2, 3)
+	m.AddRequest("/dev/ttyUSB0", 2, 4)
+	m.AddRequest("/dev/ttyUSB0", 2, 4)
+	m.AddResponse("/dev/ttyUSB0", 2, 3, 20*time.Millisecond)
+	m.AddException("/dev/ttyUSB0", 2, 4, 2, 2*time.Millisecond)
+	m.AddTimeout("/dev/ttyUSB0", 2, 4)
+
+	s := m.Snapshot()
+	if len(s.Ports) != 1 || len(s.Slaves) != 1 {
+		t.Fatalf("want 1 port and 1 slave, got %+v", s)
+	}
+	p := s.Ports[0]
+	if math.Abs(p.Utilisation-100) > 1e-9 {
+		t.Errorf("utilisation=%v, want 100", p.Utilisation)
+	}
+	if p.CRCErrorRate != 0.25 {
+		t.Errorf("crc error rate=%v, want 0.25", p.CRCErrorRate)
+	}
+	sl := s.Slaves[0]
+	if sl.Requests != 4 || sl.Responses != 1 || sl.Exceptions != 1 || sl.Timeouts != 1 {
+		t.Errorf("unexpected slave counters %+v", sl)
+	}
+	if sl.ExceptionRate != 0.25 || sl.TimeoutRate != 0.25 {
+		t.Errorf("exception rate=%v timeout rate=%v, want 0.25", sl.ExceptionRate, sl.TimeoutRate)
+	}
+	if len(sl.Functions) != 2 || sl.Functions[1].Exceptions[2] != 1 {
+		t.Errorf("unexpected functions %+v", sl.Functions)
+	}
+	// 2ms falls in the 5ms bucket, 20ms in the 25ms one
+	if sl.Latency.Count != 2 || sl.Latency.Counts[0] != 1 || sl.Latency.Counts[1] != 1 || sl.Latency.Counts[2] != 2 {
+		t.Errorf("unexpected latency histogram %+v", sl.Latency)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	m := New()
+	m.AddPort("/dev/ttyUSB0", 9600, 10)
+	m.AddRequest("/dev/ttyUSB0", 2, 4)
+	m.AddException("/dev/ttyUSB0", 2, 4, 2, 30*time.Millisecond)
+
+	var b strings.Builder
+	if err := m.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`sniffer_port_baud{port="/dev/ttyUSB0"} 9600`,
+		`sniffer_requests_total{port="/dev/ttyUSB0",slave="2",function_code="4"} 1`,
+		`sniffer_exceptions_total{port="/dev/ttyUSB0",slave="2",function_code="4",exception_code="2"} 1`,
+		`sniffer_response_latency_seconds_bucket{port="/dev/ttyUSB0",slave="2",le="0.025"} 0`,
+		`sniffer_response_latency_seconds_bucket{port="/dev/ttyUSB0",slave="2",le="0.05"} 1`,
+		`sniffer_response_latency_seconds_count{port="/dev/ttyUSB0",slave="2"} 1`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType content type of the Prometheus text exposition format
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler returns an http.Handler serving metrics in Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		if err := m.WritePrometheus(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// WritePrometheus writes a snapshot of metrics in Prometheus text format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	s := m.Snapshot()
+	return s.WritePrometheus(w)
+}
+
+// WritePrometheus writes snapshot in Prometheus text format
+func (s *Snapshot) WritePrometheus(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	family(b, "sniffer_uptime_seconds", "gauge", "Seconds since the sniffer started.")
+	sample(b, "sniffer_uptime_seconds", nil, s.UptimeSeconds)
+
+	portGauge := func(name string, typ string, help string, v func(p *PortSnapshot) float64) {
+		family(b, name, typ, help)
+		for i := range s.Ports {
+			p := &s.Ports[i]
+			sample(b, name, []string{"port", p.Port}, v(p))
+		}
+	}
+	portGauge("sniffer_port_baud", "gauge", "Configured line speed.",
+		func(p *PortSnapshot) float64 { return float64(p.Baud) })
+	portGauge("sniffer_port_up", "gauge", "1 if the port is open, 0 while reconnecting.",
+		func(p *PortSnapshot) float64 {
+			if p.Connected {
+				return 1
+			}
+			return 0
+		})
+	portGauge("sniffer_port_reconnects_total", "counter", "Times the port was reopened after a failure.",
+		func(p *PortSnapshot) float64 { return float64(p.Reconnects) })
+	portGauge("sniffer_bytes_total", "counter", "Bytes read from the port.",
+		func(p *PortSnapshot) float64 { return float64(p.Bytes) })
+	portGauge("sniffer_frames_total", "counter", "Valid frames dissected.",
+		func(p *PortSnapshot) float64 { return float64(p.Frames) })
+	portGauge("sniffer_invalid_frames_total", "counter", "Runs of bytes discarded as invalid frames (CRC errors, truncated frames).",
+		func(p *PortSnapshot) float64 { return float64(p.InvalidFrames) })
+	portGauge("sniffer_invalid_bytes_total", "counter", "Bytes discarded as invalid.",
+		func(p *PortSnapshot) float64 { return float64(p.InvalidBytes) })
+	portGauge("sniffer_bytes_per_second", "gauge", "Bytes per second over the rate window.",
+		func(p *PortSnapshot) float64 { return p.BytesPerSecond })
+	portGauge("sniffer_frames_per_second", "gauge", "Frames per second over the rate window.",
+		func(p *PortSnapshot) float64 { return p.FramesPerSecond })
+	portGauge("sniffer_bus_utilisation_ratio", "gauge", "Share of line capacity in use, against configured baud.",
+		func(p *PortSnapshot) float64 { return p.Utilisation / 100 })
+
+	functionCounter := func(name string, help string, v func(f *FunctionSnapshot) uint64) {
+		family(b, name, "counter", help)
+		for i := range s.Slaves {
+			sl := &s.Slaves[i]
+			for j := range sl.Functions {
+				f := &sl.Functions[j]
+				sample(b, name, slaveLabels(sl, "function_code", strconv.Itoa(int(f.FunctionCode))), float64(v(f)))
+			}
+		}
+	}
+	functionCounter("sniffer_requests_total", "Requests sent by the master.",
+		func(f *FunctionSnapshot) uint64 { return f.Requests })
+	functionCounter("sniffer_responses_total", "Responses without exception.",
+		func(f *FunctionSnapshot) uint64 { return f.Responses })
+	functionCounter("sniffer_timeouts_total", "Requests never answered.",
+		func(f *FunctionSnapshot) uint64 { return f.Timeouts })
+
+	family(b, "sniffer_exceptions_total", "counter", "Exception responses.")
+	for i := range s.Slaves {
+		sl := &s.Slaves[i]
+		for j := range sl.Functions {
+			f := &sl.Functions[j]
+			codes := make([]int, 0, len(f.Exceptions))
+			for code := range f.Exceptions {
+				codes = append(codes, int(code))
+			}
+			sort.Ints(codes)
+			for _, code := range codes {
+				sample(b, "sniffer_exceptions_total", slaveLabels(sl,
+					"function_code", strconv.Itoa(int(f.FunctionCode)),
+					"exception_code", strconv.Itoa(code)), float64(f.Exceptions[uint32(code)]))
+			}
+		}
+	}
+
+	family(b, "sniffer_response_latency_seconds", "histogram", "Time between request and response or exception.")
+	for i := range s.Slaves {
+		sl := &s.Slaves[i]
+		h := &sl.Latency
+		for j, bound := range h.Bounds {
+			sample(b, "sniffer_response_latency_seconds_bucket",
+				slaveLabels(sl, "le", strconv.FormatFloat(bound, 'g', -1, 64)), float64(h.Counts[j]))
+		}
+		sample(b, "sniffer_response_latency_seconds_bucket", slaveLabels(sl, "le", "+Inf"), float64(h.Count))
+		sample(b, "sniffer_response_latency_seconds_sum", slaveLabels(sl), h.Sum)
+		sample(b, "sniffer_response_latency_seconds_count", slaveLabels(sl), float64(h.Count))
+	}
+
+	return b.Flush()
+}
+
+func slaveLabels(sl *SlaveSnapshot, extra ...string) []string {
+	return append([]string{"port", sl.Port, "slave", strconv.Itoa(int(sl.Address))}, extra...)
+}
+
+func family(w io.Writer, name string, typ string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample, labels are name/value pairs
+func sample(w io.Writer, name string, labels []string, v float64) {
+	fmt.Fprint(w, name)
+	if len(labels) > 0 {
+		fmt.Fprint(w, "{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		fmt.Fprint(w, "}")
+	}
+	fmt.Fprintf(w, " %s\n", strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// Snapshot statistics at a point in time
+type Snapshot struct {
+	Time          time.Time `json:"time"`
+	UptimeSeconds float64   `json:"uptimeSeconds"`
+
+	Ports  []PortSnapshot  `json:"ports"`
+	Slaves []SlaveSnapshot `json:"slaves"`
+}
+
+// PortSnapshot statistics of a serial port
+type PortSnapshot struct {
+	Port string `json:"port"`
+	Baud int    `json:"baud"`
+
+	Bytes         uint64 `json:"bytes"`
+	Frames        uint64 `json:"frames"`
+	InvalidFrames uint64 `json:"invalidFrames"`
+	InvalidBytes  uint64 `json:"invalidBytes"`
+
+	Connected  bool   `json:"connected"`
+	Reconnects uint64 `json:"reconnects"`
+
+	BytesPerSecond  float64 `json:"bytesPerSecond"`
+	FramesPerSecond float64 `json:"framesPerSecond"`
+	// Utilisation of the line [%], against configured baud
+	Utilisation float64 `json:"utilisation"`
+	// CRCErrorRate share of invalid frames over all frames
+	CRCErrorRate float64 `json:"crcErrorRate"`
+}
+
+// SlaveSnapshot statistics of a slave address, as seen on the port requests are sent on
+type SlaveSnapshot struct {
+	Port    string `json:"port"`
+	Address uint32 `json:"address"`
+
+	Requests   uint64 `json:"requests"`
+	Responses  uint64 `json:"responses"`
+	Exceptions uint64 `json:"exceptions"`
+	Timeouts   uint64 `json:"timeouts"`
+
+	ExceptionRate float64 `json:"exceptionRate"`
+	TimeoutRate   float64 `json:"timeoutRate"`
+
+	Functions []FunctionSnapshot `json:"functions"`
+	Latency   Histogram          `json:"latency"`
+}
+
+// FunctionSnapshot statistics of a function code of a slave
+type FunctionSnapshot struct {
+	FunctionCode uint32 `json:"functionCode"`
+
+	Requests  uint64 `json:"requests"`
+	Responses uint64 `json:"responses"`
+	Timeouts  uint64 `json:"timeouts"`
+	// Exceptions count by exception code
+	Exceptions map[uint32]uint64 `json:"exceptions"`
+}
+
+// Histogram with cumulative Counts for each upper bound in Bounds [seconds]
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+// Mean returns mean value, 0 if empty
+func (h *Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+func (s *Snapshot) PrettyString() (str string) {
+	for _, p := range s.Ports {
+		str += p.PrettyString() + "\n"
+	}
+	for _, sl := range s.Slaves {
+		str += sl.PrettyString() + "\n"
+	}
+	return
+}
+
+func (p *PortSnapshot) PrettyString() string {
+	return fmt.Sprintf("port: %s, %.0f B/s, %.1f frames/s, utilisation: %.1f%%, CRC errors: %.1f%%",
+		p.Port, p.BytesPerSecond, p.FramesPerSecond, p.Utilisation, 100*p.CRCErrorRate)
+}
+
+func (s *SlaveSnapshot) PrettyString() string {
+	return fmt.Sprintf("port: %s, slave: %02X, requests: %d, exceptions: %.1f%%, timeouts: %.1f%%, mean latency: %v",
+		s.Port, s.Address, s.Requests, 100*s.ExceptionRate, 100*s.TimeoutRate,
+		time.Duration(s.Latency.Mean()*float64(time.Second)).Round(time.Millisecond))
+}
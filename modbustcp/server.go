@@ -0,0 +1,218 @@
+package modbustcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/processimage"
+)
+
+const (
+	// mbapSize size of the MBAP header: transaction id, protocol id, length, unit id
+	mbapSize = 7
+	// maxPDUSize maximum size of a Modbus PDU
+	maxPDUSize = 253
+
+	maxReadBits      = 2000
+	maxReadRegisters = 125
+)
+
+// Modbus exception codes
+const (
+	ExceptionIllegalFunction     byte = 0x01
+	ExceptionIllegalDataAddress  byte = 0x02
+	ExceptionIllegalDataValue    byte = 0x03
+	ExceptionGatewayTargetFailed byte = 0x0B
+)
+
+// Server read-only Modbus TCP server answering reads (FC1-4) from a process image. The unit id is the RTU slave
+// address. Points never seen on the bus are answered with an illegal data address exception, slaves never seen
+// with gateway target device failed to respond, and any other function, writes included, with illegal function.
+type Server struct {
+	image *processimage.ProcessImage
+	debug bool
+
+	mux      sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a server for image
+func NewServer(image *processimage.ProcessImage, debug bool) *Server {
+	return &Server{image: image, debug: debug, conns: make(map[net.Conn]bool)}
+}
+
+// ListenAndServe listens on TCP address addr, e.g. :502, and serves until Close()
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves connections accepted on l until Close(). Returns nil once closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listener = l
+	s.mux.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mux.Lock()
+			closed := s.closed
+			s.mux.Unlock()
+			if closed {
+				s.wg.Wait()
+				return nil
+			}
+			return err
+		}
+		s.mux.Lock()
+		if s.closed {
+			s.mux.Unlock()
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mux.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			if err := s.serveConn(conn); err != nil && s.debug {
+				log.Printf("Modbus TCP %s: %v", conn.RemoteAddr(), err)
+			}
+			s.mux.Lock()
+			delete(s.conns, conn)
+			s.mux.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// Close stops listening and closes connections. It can be called more than once.
+func (s *Server) Close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// serveConn answers requests on conn until it is closed
+func (s *Server) serveConn(conn net.Conn) error {
+	header := make([]byte, mbapSize)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(header[4:6]))
+		if binary.BigEndian.Uint16(header[2:4]) != 0 || length < 2 || length-1 > maxPDUSize {
+			return fmt.Errorf("invalid MBAP header %02X", header)
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return err
+		}
+
+		rsp := s.handle(uint32(header[6]), pdu)
+		adu := make([]byte, mbapSize, mbapSize+len(rsp))
+		copy(adu, header[:4])
+		binary.BigEndian.PutUint16(adu[4:6], uint16(len(rsp)+1))
+		adu[6] = header[6]
+		if _, err := conn.Write(append(adu, rsp...)); err != nil {
+			return err
+		}
+	}
+}
+
+// handle returns the response PDU to a request PDU for slave
+func (s *Server) handle(slave uint32, pdu []byte) []byte {
+	fc := pdu[0]
+	exception := func(code byte) []byte {
+		if s.debug {
+			log.Printf("Modbus TCP unit %d: request %02X, exception %02X", slave, pdu, code)
+		}
+		return []byte{fc | 0x80, code}
+	}
+
+	table := dissector.TableOf(uint32(fc))
+	if fc < 1 || fc > 4 {
+		return exception(ExceptionIllegalFunction)
+	}
+	if len(pdu) != 5 {
+		return exception(ExceptionIllegalDataValue)
+	}
+	start := uint32(binary.BigEndian.Uint16(pdu[1:3]))
+	quantity := uint32(binary.BigEndian.Uint16(pdu[3:5]))
+	max := uint32(maxReadRegisters)
+	if !table.IsRegister() {
+		max = maxReadBits
+	}
+	if quantity < 1 || quantity > max {
+		return exception(ExceptionIllegalDataValue)
+	}
+	if start+quantity > 0x10000 {
+		return exception(ExceptionIllegalDataAddress)
+	}
+	if !s.knows(slave) {
+		return exception(ExceptionGatewayTargetFailed)
+	}
+
+	points := s.image.Get(slave, table, start, quantity)
+	for i := range points {
+		if !points[i].Known() {
+			return exception(ExceptionIllegalDataAddress)
+		}
+	}
+
+	if table.IsRegister() {
+		rsp := []byte{fc, byte(2 * quantity)}
+		for _, p := range points {
+			rsp = append(rsp, byte(p.Value>>8), byte(p.Value))
+		}
+		return rsp
+	}
+	rsp := make([]byte, 2+(quantity+7)/8)
+	rsp[0], rsp[1] = fc, byte((quantity+7)/8)
+	for i, p := range points {
+		if p.Value != 0 {
+			rsp[2+i/8] |= 1 << (i % 8)
+		}
+	}
+	return rsp
+}
+
+// knows returns true if any point of slave was seen
+func (s *Server) knows(slave uint32) bool {
+	for _, a := range s.image.Slaves() {
+		if a == slave {
+			return true
+		}
+	}
+	return false
+}
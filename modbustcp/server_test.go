@@ -0,0 +1,72 @@
+package modbustcp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+	"github.com/andreaaizza/sniffer/processimage"
+)
+
+func TestServer(t *testing.T) {
+	req1 := []byte{0x02, 0x01, 0x00, 0x10, 0x00, 0x0A, 0xBD, 0xFB}
+	rsp1 := []byte{0x02, 0x01, 0x02, 0x05, 0x02, 0x7F, 0x6D}
+	req4 := []byte{0x02, 0x04, 0x00, 0x00, 0x00, 0x0A, 0x70, 0x3E}
+	rsp4 := []byte{0x02, 0x04, 0x14, 0x80, 0x03, 0x80, 0x03, 0x80, 0x01, 0x80, 0x01, 0x80, 0x01, 0x80, 0x03, 0x00, 0x37, 0x80, 0x03, 0x80, 0x03, 0x80, 0x03, 0x90, 0x1F}
+
+	results := sniffertest.Dissect(t, "port", sniffertest.Every(time.Second, req1, rsp1, req4, rsp4, req1))
+	image := processimage.New()
+	for i := 0; i+1 < len(results); i += 2 {
+		image.Update(results[i].GetAdu(), results[i+1].GetAdu())
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(image, false)
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+	defer func() {
+		s.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, tc := range []struct {
+		name     string
+		unit     byte
+		pdu, rsp []byte
+	}{
+		{"registers", 2, []byte{0x04, 0x00, 0x08, 0x00, 0x02}, []byte{0x04, 0x04, 0x80, 0x03, 0x80, 0x03}},
+		{"coils", 2, []byte{0x01, 0x00, 0x10, 0x00, 0x0A}, []byte{0x01, 0x02, 0x05, 0x02}},
+		{"unknown register", 2, []byte{0x04, 0x00, 0x08, 0x00, 0x03}, []byte{0x84, ExceptionIllegalDataAddress}},
+		{"unknown slave", 3, []byte{0x04, 0x00, 0x00, 0x00, 0x01}, []byte{0x84, ExceptionGatewayTargetFailed}},
+		{"write", 2, []byte{0x06, 0x00, 0x00, 0x00, 0x01}, []byte{0x86, ExceptionIllegalFunction}},
+		{"quantity", 2, []byte{0x03, 0x00, 0x00, 0x00, 0x00}, []byte{0x83, ExceptionIllegalDataValue}},
+	} {
+		req := append([]byte{0x12, 0x34, 0x00, 0x00, 0x00, byte(len(tc.pdu) + 1), tc.unit}, tc.pdu...)
+		if _, err := conn.Write(req); err != nil {
+			t.Fatal(err)
+		}
+		want := append([]byte{0x12, 0x34, 0x00, 0x00, 0x00, byte(len(tc.rsp) + 1), tc.unit}, tc.rsp...)
+		got := make([]byte, len(want))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.ReadFull(conn, got); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %02X, want %02X", tc.name, got, want)
+		}
+	}
+}
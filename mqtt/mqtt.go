@@ -0,0 +1,268 @@
+// Package mqtt publishes results and values decoded with the register map to an MQTT broker
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/output"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// TopicDefault topic of results, as output.Record JSON
+	TopicDefault = "modbus/{port}/{slave}/{fc}/{register}"
+	// ValueTopicDefault topic of decoded values, as text
+	ValueTopicDefault = "modbus/{port}/{slave}/{fc}/{register}/{name}"
+	// QueueSizeDefault messages waiting to be published, beyond which new ones are dropped
+	QueueSizeDefault = 1000
+	// TimeoutDefault to connect and to publish a message
+	TimeoutDefault = 10 * time.Second
+)
+
+// Options of a Publisher. Topics are templates: {port} (base name, e.g. ttyUSB0), {slave}, {fc}, {table}, {register}
+// (first address requested; of the value for values), {device} and {name} (of the value, empty for results) are
+// replaced.
+type Options struct {
+	// Broker URL, e.g. tcp://localhost:1883, ssl://broker:8883 or ws://broker:80/mqtt
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// TLS of ssl://, tls:// and wss:// brokers, system roots if nil
+	TLS *tls.Config
+
+	// Topic of results, TopicDefault if empty
+	Topic string
+	// ValueTopic of decoded values, ValueTopicDefault if empty
+	ValueTopic string
+	// NoResults, NoValues do not publish results or decoded values
+	NoResults bool
+	NoValues  bool
+	// QoS 0, 1 or 2
+	QoS byte
+	// Retained asks the broker to keep the last message of each topic for new subscribers
+	Retained bool
+
+	// QueueSize, Timeout see the defaults
+	QueueSize int
+	Timeout   time.Duration
+}
+
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// Publisher publishes results to an MQTT broker, reconnecting when the connection is lost. Publish never blocks:
+// messages are queued and published in order.
+type Publisher struct {
+	opts    Options
+	client  paho.Client
+	connect paho.Token
+
+	mux     sync.Mutex
+	closed  bool
+	queue   chan message
+	done    chan struct{}
+	dropped uint64
+}
+
+// New creates a publisher to the broker of opts and starts connecting to it, in the background. It fails on invalid
+// options, not if the broker cannot be reached, since it keeps retrying.
+func New(opts Options) (*Publisher, error) {
+	if opts.Topic == "" {
+		opts.Topic = TopicDefault
+	}
+	if opts.ValueTopic == "" {
+		opts.ValueTopic = ValueTopicDefault
+	}
+	if opts.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d", opts.QoS)
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = QueueSizeDefault
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = TimeoutDefault
+	}
+	if opts.ClientID == "" {
+		host, _ := os.Hostname()
+		opts.ClientID = fmt.Sprintf("sniffer-%s-%d", host, os.Getpid())
+	}
+
+	co := paho.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetConnectTimeout(opts.Timeout).
+		SetWriteTimeout(opts.Timeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(paho.Client) {
+			log.Printf("MQTT connected to %s", opts.Broker)
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Printf("MQTT connection to %s lost: %v", opts.Broker, err)
+		})
+	if opts.TLS != nil {
+		co.SetTLSConfig(opts.TLS)
+	}
+	if len(co.Servers) == 0 {
+		return nil, fmt.Errorf("invalid MQTT broker %q", opts.Broker)
+	}
+
+	p := &Publisher{
+		opts:   opts,
+		client: paho.NewClient(co),
+		queue:  make(chan message, opts.QueueSize),
+		done:   make(chan struct{}),
+	}
+	p.connect = p.client.Connect()
+	go p.run()
+	return p, nil
+}
+
+// Publish queues r, and its decoded values, for publishing. Use as Sniffer.OnResult() callback.
+func (p *Publisher) Publish(r *sniffer.Result) {
+	var messages []message
+	if !p.opts.NoResults {
+		payload, err := json.Marshal(output.NewRecord(r))
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		start := r.GetRequest().GetAdu().GetPduRequest().StartAddress()
+		messages = append(messages, message{p.topic(p.opts.Topic, r, start, "", ""), payload})
+	}
+	if !p.opts.NoValues {
+		for _, v := range r.GetValues() {
+			messages = append(messages, message{p.topic(p.opts.ValueTopic, r, v.GetAddress(), v.GetDevice(), v.GetName()),
+				[]byte(v.ValueString())})
+		}
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.closed {
+		return
+	}
+	for _, m := range messages {
+		select {
+		case p.queue <- m:
+		default:
+			atomic.AddUint64(&p.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of messages dropped because the queue was full
+func (p *Publisher) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Close publishes the messages queued, waiting up to Timeout for each, then disconnects. If the broker is not
+// connected within Timeout, messages queued are dropped.
+func (p *Publisher) Close() {
+	p.mux.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mux.Unlock()
+	<-p.done
+	p.client.Disconnect(250)
+}
+
+// run publishes messages queued
+func (p *Publisher) run() {
+	defer close(p.done)
+	// waited for the broker to connect already, so that closing does not wait again
+	waited := false
+	for m := range p.queue {
+		if p.isClosed() && !p.client.IsConnectionOpen() {
+			// still connecting the first time, or reconnecting: wait once
+			if !waited {
+				p.connect.WaitTimeout(p.opts.Timeout)
+				waited = true
+			}
+			if !p.client.IsConnectionOpen() {
+				atomic.AddUint64(&p.dropped, 1)
+				continue
+			}
+		}
+		t := p.client.Publish(m.topic, p.opts.QoS, p.opts.Retained, m.payload)
+		if !t.WaitTimeout(p.opts.Timeout) {
+			log.Printf("MQTT publish to %s timed out", m.topic)
+			waited = waited || !p.client.IsConnectionOpen()
+		} else if t.Error() != nil {
+			log.Printf("MQTT publish to %s: %v", m.topic, t.Error())
+		}
+	}
+}
+
+func (p *Publisher) isClosed() bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.closed
+}
+
+// topic returns template filled with r, address, device and name
+func (p *Publisher) topic(template string, r *sniffer.Result, address uint32, device, name string) string {
+	req := r.GetRequest().GetAdu()
+	fc := req.GetPduRequest().GetFunctionCode()
+	table := dissector.TableOf(fc).String()
+	return strings.NewReplacer(
+		"{port}", topicLevel(filepath.Base(r.GetRequest().GetPort())),
+		"{slave}", strconv.Itoa(int(req.GetAddress())),
+		"{fc}", strconv.Itoa(int(fc)),
+		"{table}", table,
+		"{register}", strconv.Itoa(int(address)),
+		"{device}", topicLevel(device),
+		"{name}", topicLevel(name),
+	).Replace(template)
+}
+
+// topicLevel replaces characters not allowed within a topic level: separators and wildcards
+func topicLevel(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+// TLSConfig creates the TLS configuration of a broker: caFile verifies the broker (system roots if empty), certFile
+// and keyFile authenticate the client (none if empty), insecure skips verifying the broker
+func TLSConfig(caFile, certFile, keyFile string, insecure bool) (*tls.Config, error) {
+	c := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
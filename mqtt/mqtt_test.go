@@ -0,0 +1,216 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+	"github.com/andreaaizza/sniffer/regmap"
+)
+
+type published struct {
+	topic    string
+	payload  string
+	qos      byte
+	retained bool
+}
+
+// broker a minimal MQTT 3.1.1 broker, recording what is published to it
+type broker struct {
+	l        net.Listener
+	mux      sync.Mutex
+	messages []published
+}
+
+func newBroker(t *testing.T, config *tls.Config) *broker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config != nil {
+		l = tls.NewListener(l, config)
+	}
+	b := &broker{l: l}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(c)
+		}
+	}()
+	return b
+}
+
+func (b *broker) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		length, shift := 0, uint(0)
+		for {
+			x, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			length |= int(x&0x7F) << shift
+			shift += 7
+			if x&0x80 == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 1: // CONNECT
+			c.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 3: // PUBLISH
+			qos := header >> 1 & 3
+			n := int(body[0])<<8 | int(body[1])
+			p := published{topic: string(body[2 : 2+n]), qos: qos, retained: header&1 == 1}
+			body = body[2+n:]
+			if qos > 0 {
+				c.Write([]byte{0x40 + 0x10*(qos-1), 0x02, body[0], body[1]}) // PUBACK or PUBREC
+				body = body[2:]
+			}
+			p.payload = string(body)
+			b.mux.Lock()
+			b.messages = append(b.messages, p)
+			b.mux.Unlock()
+		case 6: // PUBREL
+			c.Write([]byte{0x70, 0x02, body[0], body[1]})
+		case 12: // PINGREQ
+			c.Write([]byte{0xD0, 0x00})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func (b *broker) published() []published {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return append([]published(nil), b.messages...)
+}
+
+func testResult(t *testing.T) *sniffer.Result {
+	r := sniffertest.Results(t)[0]
+	r.Values = []*regmap.Value{{Device: "meter", Name: "energy", Slave: 2, Address: 0x1000, Number: 65538, Unit: "Wh"}}
+	return r
+}
+
+// selfSigned writes a certificate of 127.0.0.1 and its key to dir
+func selfSigned(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "broker"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestPublisher(t *testing.T) {
+	certFile, keyFile := selfSigned(t, t.TempDir())
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTLS, err := TLSConfig(certFile, "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		scheme    string
+		brokerTLS *tls.Config
+		opts      Options
+	}{
+		{"tcp", nil, Options{QoS: 1, Retained: true}},
+		{"ssl", &tls.Config{Certificates: []tls.Certificate{cert}}, Options{QoS: 2, TLS: clientTLS,
+			Topic: "plant/{port}/{table}/{slave}/{register}", ValueTopic: "plant/{device}/{name}"}},
+	} {
+		b := newBroker(t, tc.brokerTLS)
+		opts := tc.opts
+		opts.Broker = tc.scheme + "://" + b.l.Addr().String()
+		opts.Timeout = 2 * time.Second
+		p, err := New(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Publish(testResult(t))
+		p.Close()
+		b.l.Close()
+
+		msgs := b.published()
+		if len(msgs) != 2 {
+			t.Fatalf("%s: got %d messages, want 2", tc.scheme, len(msgs))
+		}
+		wantTopics := []string{"modbus/ttyUSB0/2/3/4096", "modbus/ttyUSB0/2/3/4096/energy"}
+		if tc.opts.Topic != "" {
+			wantTopics = []string{"plant/ttyUSB0/holdingRegisters/2/4096", "plant/meter/energy"}
+		}
+		for i, m := range msgs {
+			if m.topic != wantTopics[i] || m.qos != opts.QoS || m.retained != opts.Retained {
+				t.Errorf("%s: got message %d %+v, want topic %s", tc.scheme, i, m, wantTopics[i])
+			}
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(msgs[0].payload), &record); err != nil || record["status"] != "response" {
+			t.Errorf("%s: got result %s, %v", tc.scheme, msgs[0].payload, err)
+		}
+		if msgs[1].payload != "65538" {
+			t.Errorf("%s: got value %s, want 65538", tc.scheme, msgs[1].payload)
+		}
+	}
+
+	if _, err := New(Options{Broker: "tcp://127.0.0.1:1", QoS: 3}); err == nil {
+		t.Error("got no error for QoS 3")
+	}
+}
@@ -0,0 +1,192 @@
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/regmap"
+)
+
+// CSVColumns columns of CSV rows:
+//   - time: of the request, in CSVOptions.TimeFormat
+//   - port, slave, functionCode, table, start, quantity, status, exceptionCode: as in Record
+//   - latency: seconds
+//   - request, response: whole ADUs, hex
+//   - values: all values decoded with the register map, as PrettyString, separated by spaces
+//
+// Any other column is a point of CSVOptions.Map, named device.name or name, with its value decoded: text, or number
+// without unit. Empty if not decoded from the result.
+var CSVColumns = []string{"time", "port", "slave", "functionCode", "table", "start", "quantity", "latency",
+	"status", "exceptionCode", "request", "response", "values"}
+
+// CSVColumnsDefault columns written if none are given
+var CSVColumnsDefault = []string{"time", "port", "slave", "functionCode", "start", "quantity", "latency", "status",
+	"exceptionCode", "values"}
+
+// Time formats of CSVOptions, besides Go layouts
+const (
+	// TimeFormatUnix seconds since the epoch, with decimals
+	TimeFormatUnix = "unix"
+	// TimeFormatUnixMilli milliseconds since the epoch
+	TimeFormatUnixMilli = "unixms"
+	// TimeFormatExcel local time Excel recognizes as such: 2006-01-02 15:04:05.000
+	TimeFormatExcel = "excel"
+)
+
+// CSVOptions of a CSVWriter
+type CSVOptions struct {
+	// Columns to write, CSVColumnsDefault if none
+	Columns []string
+	// Header writes the names of the columns first, e.g. when writing a new file
+	Header bool
+	// Delimiter of columns, ',' if 0
+	Delimiter rune
+	// TimeFormat TimeFormatUnix, TimeFormatUnixMilli, TimeFormatExcel, or Go layout in local time. RFC3339Nano UTC if
+	// empty.
+	TimeFormat string
+	// Map register map results are decoded with, columns other than CSVColumns must be its points
+	Map *regmap.Map
+}
+
+// CSVWriter writes results as CSV rows
+type CSVWriter struct {
+	mux    sync.Mutex
+	w      *csv.Writer
+	opts   CSVOptions
+	header bool
+}
+
+// NewCSVWriter creates a writer of CSV rows to w
+func NewCSVWriter(w io.Writer, opts CSVOptions) (*CSVWriter, error) {
+	if len(opts.Columns) == 0 {
+		opts.Columns = CSVColumnsDefault
+	}
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	if opts.Delimiter == '"' || opts.Delimiter == '\r' || opts.Delimiter == '\n' {
+		return nil, fmt.Errorf("invalid CSV delimiter %q", opts.Delimiter)
+	}
+	for _, c := range opts.Columns {
+		if c == "" {
+			return nil, fmt.Errorf("empty CSV column name")
+		}
+		if !isCSVColumn(c) && !isPoint(opts.Map, c) {
+			return nil, fmt.Errorf("unknown CSV column %q, neither one of %s nor a point of the register map", c,
+				strings.Join(CSVColumns, ","))
+		}
+	}
+	c := &CSVWriter{w: csv.NewWriter(w), opts: opts, header: opts.Header}
+	c.w.Comma = opts.Delimiter
+	return c, nil
+}
+
+// Write writes r as a row, flushed to the underlying writer
+func (c *CSVWriter) Write(r *sniffer.Result) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.header {
+		if err := c.w.Write(c.opts.Columns); err != nil {
+			return err
+		}
+		c.header = false
+	}
+	rec := NewRecord(r)
+	number := func(n uint32) string { return strconv.FormatUint(uint64(n), 10) }
+	row := make([]string, len(c.opts.Columns))
+	for i, column := range c.opts.Columns {
+		switch column {
+		case "time":
+			row[i] = c.formatTime(r.GetRequest().GetAdu().GetTimeTime())
+		case "port":
+			row[i] = r.GetRequest().GetPort()
+		case "slave":
+			row[i] = number(rec.Slave)
+		case "functionCode":
+			row[i] = number(rec.FunctionCode)
+		case "table":
+			row[i] = rec.Table
+		case "start":
+			row[i] = number(rec.Start)
+		case "quantity":
+			row[i] = number(rec.Quantity)
+		case "latency":
+			row[i] = strconv.FormatFloat(r.Latency().Seconds(), 'f', -1, 64)
+		case "status":
+			row[i] = rec.Status
+		case "exceptionCode":
+			if rec.Status == StatusException {
+				row[i] = number(rec.ExceptionCode)
+			}
+		case "request":
+			row[i] = rec.Request.GetPayload()
+		case "response":
+			row[i] = rec.Response.GetPayload()
+		case "values":
+			values := make([]string, len(rec.Values))
+			for j, v := range rec.Values {
+				values[j] = v.PrettyString()
+			}
+			row[i] = strings.Join(values, " ")
+		default:
+			row[i] = pointValue(rec.Values, column)
+		}
+	}
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func isCSVColumn(name string) bool {
+	for _, c := range CSVColumns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isPoint returns true if name is a point of m, named device.name or name
+func isPoint(m *regmap.Map, name string) bool {
+	if m == nil {
+		return false
+	}
+	for _, d := range m.Devices {
+		if m.Point(d.Slave, name) != nil || m.Point(d.Slave, strings.TrimPrefix(name, d.Name+".")) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CSVWriter) formatTime(t time.Time) string {
+	switch c.opts.TimeFormat {
+	case "":
+		return t.UTC().Format(time.RFC3339Nano)
+	case TimeFormatUnix:
+		return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64)
+	case TimeFormatUnixMilli:
+		return strconv.FormatInt(t.UnixNano()/1e6, 10)
+	case TimeFormatExcel:
+		return t.Local().Format("2006-01-02 15:04:05.000")
+	}
+	return t.Local().Format(c.opts.TimeFormat)
+}
+
+// pointValue returns the value of point name, device.name or name, among values
+func pointValue(values []*regmap.Value, name string) string {
+	for _, v := range values {
+		if v.GetName() == name || v.GetDevice()+"."+v.GetName() == name {
+			return v.ValueString()
+		}
+	}
+	return ""
+}
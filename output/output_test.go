@@ -0,0 +1,156 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+	"github.com/andreaaizza/sniffer/regmap"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// testResults a read answered after 20ms, decoded with a register map, and one answered with an exception
+func testResults(t *testing.T) []*sniffer.Result {
+	results := sniffertest.Results(t)
+	results[0].Values = []*regmap.Value{
+		{Device: "meter", Name: "energy", Slave: 2, Address: 0x1000, Number: 65538, Text: "-", Unit: "Wh"}}
+	return results
+}
+
+func TestJSONWriter(t *testing.T) {
+	var b bytes.Buffer
+	w, err := New("jsonl", &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := testResults(t)
+	for _, r := range results {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n"))
+	if len(lines) != len(results) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(results))
+	}
+	var read map[string]interface{}
+	if err := json.Unmarshal(lines[0], &read); err != nil {
+		t.Fatal(err)
+	}
+	req := read["request"].(map[string]interface{})["adu"].(map[string]interface{})
+	if req["time"] != "2020-09-14T08:45:54Z" || req["payload"] != "020310000002C0F8" ||
+		req["pduRequest"].(map[string]interface{})["data"] != "10000002" {
+		t.Errorf("got request %v", req)
+	}
+	if read["latency"] != "0.020s" || read["status"] != StatusResponse || read["table"] != "holdingRegisters" ||
+		read["start"] != float64(0x1000) {
+		t.Errorf("got %s", lines[0])
+	}
+	var exception map[string]interface{}
+	if err := json.Unmarshal(lines[1], &exception); err != nil {
+		t.Fatal(err)
+	}
+	if exception["status"] != StatusException || exception["exceptionCode"] != float64(2) {
+		t.Errorf("got %s", lines[1])
+	}
+
+	// field names of sniffer.proto, so that the schema stays in sync
+	extra := map[string]bool{"slave": true, "functionCode": true, "table": true, "start": true, "quantity": true,
+		"latency": true, "status": true, "exceptionCode": true, "payload": true}
+	for i, line := range lines {
+		var m map[string]interface{}
+		if err := json.Unmarshal(line, &m); err != nil {
+			t.Fatal(err)
+		}
+		checkNames(t, i, "", (&sniffer.Result{}).ProtoReflect().Descriptor(), m, extra)
+	}
+}
+
+// checkNames checks that JSON object m has the fields of message md, with their protojson names, and no others
+// but extra ones
+func checkNames(t *testing.T, line int, path string, md protoreflect.MessageDescriptor, m map[string]interface{},
+	extra map[string]bool) {
+	fields := md.Fields()
+	for name := range m {
+		if fields.ByJSONName(name) == nil && !extra[name] {
+			t.Errorf("line %d: %s%s is not a field of %s", line, path, name, md.FullName())
+		}
+	}
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		v, ok := m[fd.JSONName()]
+		if !ok {
+			// one of a oneof, or empty list
+			if fd.ContainingOneof() == nil && !fd.IsList() {
+				t.Errorf("line %d: missing %s%s", line, path, fd.JSONName())
+			}
+			continue
+		}
+		if fd.Message() == nil || fd.Message().FullName() == "google.protobuf.Timestamp" {
+			continue
+		}
+		if list, ok := v.([]interface{}); ok && len(list) > 0 {
+			v = list[0]
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			checkNames(t, line, path+fd.JSONName()+".", fd.Message(), sub, extra)
+		}
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	m, err := regmap.Parse([]byte(`devices:
+  - slave: 2
+    name: meter
+    points:
+      - {name: energy, table: holding, address: 4096, type: uint32, unit: Wh}
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	w, err := NewCSVWriter(&b, CSVOptions{
+		Columns:    []string{"time", "slave", "latency", "status", "exceptionCode", "request", "meter.energy", "values"},
+		Header:     true,
+		Delimiter:  ';',
+		TimeFormat: TimeFormatUnixMilli,
+		Map:        m,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := testResults(t)
+	results[0].Values = []*regmap.Value{{Device: "meter", Name: "energy", Slave: 2, Address: 0x1000, Number: 65538, Unit: "Wh"}}
+	for _, r := range results {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "time;slave;latency;status;exceptionCode;request;meter.energy;values\n" +
+		"1600073154000;2;0.02;response;;020310000002C0F8;65538;meter.energy=65538Wh\n" +
+		"1600073154040;2;0.02;exception;2;02040000000271F8;;\n"
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	if _, err := NewCSVWriter(&b, CSVOptions{Delimiter: '"'}); err == nil {
+		t.Error("got no error for an invalid delimiter")
+	}
+	for _, columns := range [][]string{{"time", "energy"}, {"time", "meter.energy"}} {
+		if _, err := NewCSVWriter(&b, CSVOptions{Columns: columns, Map: m}); err != nil {
+			t.Errorf("columns %v: %v", columns, err)
+		}
+	}
+	for _, columns := range [][]string{{"time", "slvae"}, {"time", "meter.power"}} {
+		if _, err := NewCSVWriter(&b, CSVOptions{Columns: columns, Map: m}); err == nil {
+			t.Errorf("columns %v: got no error for an unknown column", columns)
+		}
+	}
+	if _, err := NewCSVWriter(&b, CSVOptions{Columns: []string{"meter.energy"}}); err == nil {
+		t.Error("got no error for a point without register map")
+	}
+}
@@ -0,0 +1,154 @@
+// Package output writes results in formats other programs can parse: JSON lines, CSV and text.
+package output
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/regmap"
+)
+
+// Statuses of records
+const (
+	StatusResponse  = "response"
+	StatusException = "exception"
+)
+
+// Record a result as JSON. Field names are the protojson ones of sniffer.proto, payloads are hex instead of base64,
+// times are RFC3339Nano UTC. Fields not in sniffer.proto follow Values.
+type Record struct {
+	Request  *Result         `json:"request,omitempty"`
+	Response *Result         `json:"response,omitempty"`
+	Values   []*regmap.Value `json:"values,omitempty"`
+
+	// decoded from the request
+	Slave        uint32 `json:"slave"`
+	FunctionCode uint32 `json:"functionCode"`
+	Table        string `json:"table,omitempty"`
+	Start        uint32 `json:"start"`
+	Quantity     uint32 `json:"quantity"`
+	// Latency from the request to the response, as protojson google.protobuf.Duration, e.g. "0.020s"
+	Latency string `json:"latency"`
+	Status  string `json:"status"`
+	// ExceptionCode if an exception
+	ExceptionCode uint32 `json:"exceptionCode,omitempty"`
+}
+
+// Result a dissector.Result as JSON
+type Result struct {
+	Adu  *ADU   `json:"adu,omitempty"`
+	Port string `json:"port,omitempty"`
+}
+
+// ADU a dissector.ADU as JSON
+type ADU struct {
+	Address              uint32        `json:"address"`
+	PduRequest           *PDU          `json:"pduRequest,omitempty"`
+	PduResponse          *PDU          `json:"pduResponse,omitempty"`
+	PduResponseException *PDUException `json:"pduResponseException,omitempty"`
+	Crc16                uint32        `json:"crc16"`
+	Time                 string        `json:"time"`
+	// Payload the whole ADU, from address to CRC, hex
+	Payload string `json:"payload"`
+}
+
+// PDU a dissector.PDURequest or dissector.PDUResponse as JSON, data hex
+type PDU struct {
+	FunctionCode uint32 `json:"functionCode"`
+	Data         string `json:"data"`
+}
+
+// PDUException a dissector.PDUResponseException as JSON
+type PDUException struct {
+	FunctionExceptionCode uint32 `json:"functionExceptionCode"`
+	ExceptionCode         uint32 `json:"exceptionCode"`
+}
+
+// NewRecord creates the record of r
+func NewRecord(r *sniffer.Result) *Record {
+	req, rsp := r.GetRequest().GetAdu(), r.GetResponse().GetAdu()
+	pdu := req.GetPduRequest()
+	rec := &Record{
+		Request:      NewResult(r.GetRequest()),
+		Response:     NewResult(r.GetResponse()),
+		Values:       r.GetValues(),
+		Slave:        req.GetAddress(),
+		FunctionCode: pdu.GetFunctionCode(),
+		Start:        pdu.StartAddress(),
+		Quantity:     pdu.Quantity(),
+		Latency:      durationString(r.Latency()),
+		Status:       StatusResponse,
+	}
+	if t := dissector.TableOf(pdu.GetFunctionCode()); t != dissector.TableNone {
+		rec.Table = t.String()
+	}
+	if rsp.GetPduResponseException() != nil {
+		rec.Status = StatusException
+		rec.ExceptionCode = rsp.GetPduResponseException().GetExceptionCode()
+	}
+	return rec
+}
+
+// NewResult creates the JSON of r, nil if r has no ADU
+func NewResult(r *dissector.Result) *Result {
+	adu := r.GetAdu()
+	if adu == nil {
+		return nil
+	}
+	a := &ADU{
+		Address: adu.GetAddress(),
+		Crc16:   adu.GetCrc16(),
+		Time:    adu.GetTimeTime().UTC().Format(time.RFC3339Nano),
+	}
+	payload := []byte{byte(adu.GetAddress())}
+	switch {
+	case adu.GetPduRequest() != nil:
+		p := adu.GetPduRequest()
+		a.PduRequest = &PDU{FunctionCode: p.GetFunctionCode(), Data: fmt.Sprintf("%02X", p.GetData())}
+		payload = append(append(payload, byte(p.GetFunctionCode())), p.GetData()...)
+	case adu.GetPduResponse() != nil:
+		p := adu.GetPduResponse()
+		a.PduResponse = &PDU{FunctionCode: p.GetFunctionCode(), Data: fmt.Sprintf("%02X", p.GetData())}
+		payload = append(append(payload, byte(p.GetFunctionCode())), p.GetData()...)
+	case adu.GetPduResponseException() != nil:
+		p := adu.GetPduResponseException()
+		a.PduResponseException = &PDUException{FunctionExceptionCode: p.GetFunctionExceptionCode(), ExceptionCode: p.GetExceptionCode()}
+		payload = append(payload, byte(p.GetFunctionExceptionCode()), byte(p.GetExceptionCode()))
+	}
+	a.Payload = fmt.Sprintf("%02X", append(payload, byte(adu.GetCrc16()), byte(adu.GetCrc16()>>8)))
+	return &Result{Adu: a, Port: r.GetPort()}
+}
+
+// Garbage a dissector.Garbage as JSON
+type Garbage struct {
+	Port string `json:"port"`
+	// Time RFC3339, UTC
+	Time string `json:"time"`
+	// Data hex
+	Data string `json:"data"`
+}
+
+// NewGarbage creates the JSON of g
+func NewGarbage(g *dissector.Garbage) *Garbage {
+	return &Garbage{Port: g.Port, Time: g.Time.UTC().Format(time.RFC3339Nano), Data: fmt.Sprintf("%02X", g.Data)}
+}
+
+// GetPayload returns the payload of the ADU of r, "" if none
+func (r *Result) GetPayload() string {
+	if r == nil || r.Adu == nil {
+		return ""
+	}
+	return r.Adu.Payload
+}
+
+// durationString formats d as protojson google.protobuf.Duration: seconds with 0, 3, 6 or 9 decimals
+func durationString(d time.Duration) string {
+	s := fmt.Sprintf("%d.%09d", d/time.Second, d%time.Second)
+	for i := 0; i < 3 && strings.HasSuffix(s, "000"); i++ {
+		s = s[:len(s)-3]
+	}
+	return strings.TrimSuffix(s, ".") + "s"
+}
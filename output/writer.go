@@ -0,0 +1,73 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/andreaaizza/sniffer"
+)
+
+// Formats names of the formats New supports
+var Formats = []string{"text", "jsonl", "csv"}
+
+// Writer writes results
+type Writer interface {
+	Write(r *sniffer.Result) error
+}
+
+// New creates a writer of results to w in format, one of Formats. CSV has the default columns and a header.
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "text":
+		return NewTextWriter(w), nil
+	case "jsonl":
+		return NewJSONWriter(w), nil
+	case "csv":
+		return NewCSVWriter(w, CSVOptions{Header: true})
+	}
+	return nil, fmt.Errorf("unknown output format %q, want one of %v", format, Formats)
+}
+
+// TextWriter writes results as PrettyString lines
+type TextWriter struct {
+	mux sync.Mutex
+	w   io.Writer
+}
+
+// NewTextWriter creates a writer of PrettyString lines to w
+func NewTextWriter(w io.Writer) *TextWriter {
+	return &TextWriter{w: w}
+}
+
+// Write writes r as a line
+func (t *TextWriter) Write(r *sniffer.Result) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	_, err := io.WriteString(t.w, r.PrettyString()+"\n")
+	return err
+}
+
+// JSONWriter writes results as JSON lines of Records
+type JSONWriter struct {
+	mux sync.Mutex
+	w   io.Writer
+}
+
+// NewJSONWriter creates a writer of JSON lines to w
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{w: w}
+}
+
+// Write writes the record of r as a line, with a single write to the underlying writer
+func (j *JSONWriter) Write(r *sniffer.Result) error {
+	b, err := json.Marshal(NewRecord(r))
+	if err != nil {
+		return err
+	}
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
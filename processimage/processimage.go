@@ -0,0 +1,213 @@
+package processimage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andreaaizza/sniffer/dissector"
+)
+
+// Point a coil, discrete input or register of a slave, as last read or written on the bus
+type Point struct {
+	Slave   uint32          `json:"slave"`
+	Table   dissector.Table `json:"table"`
+	Address uint32          `json:"address"`
+	// Value of the register, 0 or 1 for coils and discrete inputs
+	Value uint32 `json:"value"`
+	// Updated last time the point was read or written, zero if never
+	Updated time.Time `json:"updated"`
+	// Changed last time the value changed, or was first seen
+	Changed time.Time `json:"changed"`
+}
+
+// Known returns true if the point was ever read or written
+func (p *Point) Known() bool {
+	return !p.Updated.IsZero()
+}
+
+func (p *Point) PrettyString() string {
+	return fmt.Sprintf("%02X %s %d: %d [%v]", p.Slave, p.Table, p.Address, p.Value, p.Updated.Format(time.RFC3339Nano))
+}
+
+// Change a known point whose value changed
+type Change struct {
+	Point
+	// Old value
+	Old uint32 `json:"old"`
+}
+
+type key struct {
+	slave   uint32
+	table   dissector.Table
+	address uint32
+}
+
+// ProcessImage shadows coils, discrete inputs, holding and input registers of every slave, from values read
+// and written on the bus. Writes are applied when acknowledged. All methods are safe for concurrent use and can
+// be called on a nil *ProcessImage, which is a no-op.
+type ProcessImage struct {
+	mux    sync.RWMutex
+	points map[key]*Point
+}
+
+// New creates an empty process image
+func New() *ProcessImage {
+	return &ProcessImage{points: make(map[key]*Point)}
+}
+
+// Update updates the image with the values read or written by a request and its response, and returns the known
+// points whose value changed. Requests answered by an exception are ignored.
+func (pi *ProcessImage) Update(req *dissector.ADU, rsp *dissector.ADU) (changes []Change) {
+	if pi == nil || !req.IsRequest() || !rsp.IsResponse() {
+		return nil
+	}
+	slave := req.GetAddress()
+	pdu := req.GetPduRequest()
+	fc := pdu.GetFunctionCode()
+	table := dissector.TableOf(fc)
+	start, quantity := pdu.StartAddress(), pdu.Quantity()
+	t := rsp.GetTimeTime()
+
+	switch fc {
+	case 1, 2:
+		// byte count, bits LSB first
+		r := rsp.GetPduResponse().GetData()
+		if len(r) < 1 || int(r[0]) != len(r)-1 || uint32(r[0]) != (quantity+7)/8 {
+			return nil
+		}
+		values := make([]uint32, quantity)
+		for i := range values {
+			values[i] = uint32(r[1+i/8]>>(i%8)) & 1
+		}
+		changes = pi.set(slave, table, start, values, t)
+	case 3, 4, 23:
+		// registers are written before being read
+		if fc == 23 {
+			ws, _ := pdu.WriteRange()
+			changes = pi.set(slave, table, ws, pdu.WriteValues(), t)
+		}
+		// byte count, registers
+		r := rsp.GetPduResponse().GetData()
+		if len(r) < 1 || int(r[0]) != len(r)-1 || uint32(r[0]) != 2*quantity {
+			return
+		}
+		changes = append(changes, pi.set(slave, table, start, registers(r[1:]), t)...)
+	case 5, 6, 15, 16:
+		changes = pi.set(slave, table, start, pdu.WriteValues(), t)
+	case 22:
+		// the register must be known to apply masks
+		and, or, _ := pdu.WriteMasks()
+		if p := pi.Get(slave, table, start, 1)[0]; p.Known() {
+			changes = pi.set(slave, table, start, []uint32{p.Value&and | or&^and}, t)
+		}
+	}
+	return
+}
+
+// registers returns big endian 16 bit registers of b
+func registers(b []byte) (values []uint32) {
+	for i := 0; i+1 < len(b); i += 2 {
+		values = append(values, uint32(b[i])<<8|uint32(b[i+1]))
+	}
+	return
+}
+
+// set stores values of consecutive points starting at address start, updated at t, and returns the known points
+// whose value changed
+func (pi *ProcessImage) set(slave uint32, table dissector.Table, start uint32, values []uint32, t time.Time) (changes []Change) {
+	pi.mux.Lock()
+	defer pi.mux.Unlock()
+	for i, v := range values {
+		k := key{slave: slave, table: table, address: start + uint32(i)}
+		p, ok := pi.points[k]
+		if !ok {
+			p = &Point{Slave: slave, Table: table, Address: k.address}
+			pi.points[k] = p
+		}
+		p.Updated = t
+		if !ok || p.Value != v {
+			old := p.Value
+			p.Value = v
+			p.Changed = t
+			if ok {
+				changes = append(changes, Change{Point: *p, Old: old})
+			}
+		}
+	}
+	return
+}
+
+// Get returns quantity points of a slave table starting at address start. Points never read or written are
+// returned as not Known.
+func (pi *ProcessImage) Get(slave uint32, table dissector.Table, start uint32, quantity uint32) (points []Point) {
+	if pi == nil {
+		return
+	}
+	pi.mux.RLock()
+	defer pi.mux.RUnlock()
+	points = make([]Point, quantity)
+	for i := range points {
+		k := key{slave: slave, table: table, address: start + uint32(i)}
+		if p, ok := pi.points[k]; ok {
+			points[i] = *p
+		} else {
+			points[i] = Point{Slave: slave, Table: table, Address: k.address}
+		}
+	}
+	return
+}
+
+// Points returns the known points of a slave table, by address
+func (pi *ProcessImage) Points(slave uint32, table dissector.Table) []Point {
+	return pi.filter(func(p *Point) bool { return p.Slave == slave && p.Table == table })
+}
+
+// ChangedSince returns the points whose value changed after t, by slave, table and address
+func (pi *ProcessImage) ChangedSince(t time.Time) []Point {
+	return pi.filter(func(p *Point) bool { return p.Changed.After(t) })
+}
+
+// Slaves returns the addresses of slaves with known points, sorted
+func (pi *ProcessImage) Slaves() (slaves []uint32) {
+	if pi == nil {
+		return
+	}
+	pi.mux.RLock()
+	defer pi.mux.RUnlock()
+	seen := make(map[uint32]bool)
+	for k := range pi.points {
+		if !seen[k.slave] {
+			seen[k.slave] = true
+			slaves = append(slaves, k.slave)
+		}
+	}
+	sort.Slice(slaves, func(i, j int) bool { return slaves[i] < slaves[j] })
+	return
+}
+
+// filter returns copies of the points matching, sorted by slave, table and address
+func (pi *ProcessImage) filter(match func(p *Point) bool) (points []Point) {
+	if pi == nil {
+		return
+	}
+	pi.mux.RLock()
+	for _, p := range pi.points {
+		if match(p) {
+			points = append(points, *p)
+		}
+	}
+	pi.mux.RUnlock()
+	sort.Slice(points, func(i, j int) bool {
+		a, b := &points[i], &points[j]
+		switch {
+		case a.Slave != b.Slave:
+			return a.Slave < b.Slave
+		case a.Table != b.Table:
+			return a.Table < b.Table
+		}
+		return a.Address < b.Address
+	})
+	return
+}
@@ -0,0 +1,61 @@
+package processimage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/util"
+)
+
+func TestUpdate(t *testing.T) {
+	req1 := []byte{0x02, 0x01, 0x00, 0x10, 0x00, 0x0A, 0xBD, 0xFB}
+	rsp1 := []byte{0x02, 0x01, 0x02, 0x05, 0x02, 0x7F, 0x6D}
+	req3 := []byte{0x02, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC4, 0x38}
+	rsp3a := []byte{0x02, 0x03, 0x04, 0x00, 0x01, 0x00, 0x02, 0x19, 0x32}
+	rsp3b := []byte{0x02, 0x03, 0x04, 0x00, 0x01, 0x00, 0x03, 0xD8, 0xF2}
+
+	var dus []*logger.DataUnit
+	t0 := time.Date(2020, 9, 14, 8, 45, 54, 0, time.UTC)
+	for i, f := range [][]byte{req1, rsp1, req3, rsp3a, req3, rsp3b, req1} {
+		ts := util.TimestampBuilder(t0.Add(time.Duration(i) * time.Second))
+		dus = append(dus, &logger.DataUnit{Time: &ts, Data: f})
+	}
+	results, _ := dissector.Dissect(dus, "port", dissector.FilterAnyModbus{})
+	if len(results) != 7 {
+		t.Fatalf("got %d ADUs, want 7", len(results))
+	}
+	pi := New()
+	var changes []Change
+	for i := 0; i+1 < len(results); i += 2 {
+		changes = append(changes, pi.Update(results[i].GetAdu(), results[i+1].GetAdu())...)
+	}
+	if len(changes) != 1 || changes[0].Address != 1 || changes[0].Old != 2 || changes[0].Value != 3 {
+		t.Errorf("got changes %v, want register 1 from 2 to 3", changes)
+	}
+
+	coils := pi.Get(2, dissector.TableCoils, 0x10, 11)
+	for i, want := range []uint32{1, 0, 1, 0, 0, 0, 0, 0, 0, 1} {
+		if p := coils[i]; !p.Known() || p.Value != want {
+			t.Errorf("coil %d: got %d known %v, want %d", p.Address, p.Value, p.Known(), want)
+		}
+	}
+	if coils[10].Known() {
+		t.Errorf("coil %d: got known, want unknown", coils[10].Address)
+	}
+
+	regs := pi.Points(2, dissector.TableHoldingRegisters)
+	if len(regs) != 2 || regs[0].Value != 1 || regs[1].Value != 3 {
+		t.Fatalf("got registers %v, want 1, 3", regs)
+	}
+	if !regs[0].Changed.Equal(t0.Add(3*time.Second)) || !regs[0].Updated.Equal(t0.Add(5*time.Second)) {
+		t.Errorf("got register 0 changed %v updated %v, want changed at 3s, updated at 5s", regs[0].Changed, regs[0].Updated)
+	}
+	if changed := pi.ChangedSince(t0.Add(4 * time.Second)); len(changed) != 1 || changed[0].Address != 1 {
+		t.Errorf("got changed %v, want register 1", changed)
+	}
+	if slaves := pi.Slaves(); len(slaves) != 1 || slaves[0] != 2 {
+		t.Errorf("got slaves %v, want 2", slaves)
+	}
+}
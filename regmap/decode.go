@@ -0,0 +1,138 @@
+package regmap
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/andreaaizza/sniffer/dissector"
+)
+
+// Decode decodes the points of slave stored in registers of table, starting at address start.
+// data holds the registers, 2 bytes each as sent on the bus. Points not entirely in data are skipped.
+func (m *Map) Decode(slave uint32, table dissector.Table, start uint32, data []byte) (values []*Value) {
+	if m == nil {
+		return
+	}
+	end := start + uint32(len(data)/2)
+	for _, p := range m.points[slave] {
+		if p.Table != table || p.Address < start || p.Address+p.Registers() > end {
+			continue
+		}
+		i := 2 * (p.Address - start)
+		values = append(values, p.decode(data[i:i+2*p.Registers()]))
+	}
+	return
+}
+
+// DecodeADUs decodes the points of registers read by a request and its response (FC3, FC4, FC23), or written by a
+// request (FC6, FC16, FC23): of FC23 values written first, then values read. Returns nil if none.
+func (m *Map) DecodeADUs(req *dissector.ADU, rsp *dissector.ADU) (values []*Value) {
+	if m == nil || !req.IsRequest() {
+		return nil
+	}
+	pdu := req.GetPduRequest()
+	fc := pdu.GetFunctionCode()
+	table := dissector.TableOf(fc)
+	switch fc {
+	case 6, 16, 23:
+		start, _ := pdu.WriteRange()
+		written := pdu.WriteValues()
+		data := make([]byte, 0, 2*len(written))
+		for _, v := range written {
+			data = append(data, byte(v>>8), byte(v))
+		}
+		values = m.Decode(req.GetAddress(), table, start, data)
+	}
+	switch fc {
+	case 3, 4, 23:
+		// byte count, registers
+		if !rsp.IsResponse() {
+			return
+		}
+		d := rsp.GetPduResponse().GetData()
+		if len(d) < 1 || int(d[0]) != len(d)-1 || uint32(d[0]) != 2*pdu.Quantity() {
+			return
+		}
+		values = append(values, m.Decode(req.GetAddress(), table, pdu.StartAddress(), d[1:])...)
+	}
+	return
+}
+
+// decode decodes registers of the point
+func (p *Point) decode(data []byte) *Value {
+	v := &Value{
+		Device:  p.device.Name,
+		Name:    p.Name,
+		Slave:   p.device.Slave,
+		Address: p.Address,
+		Unit:    p.Unit,
+	}
+
+	// order bytes: big endian, high word first
+	b := make([]byte, 0, len(data))
+	for w := 0; w < len(data)/2; w++ {
+		i := 2 * w
+		if p.WordOrder == OrderLittle && p.Type != TypeString {
+			i = len(data) - 2 - 2*w
+		}
+		if p.ByteOrder == OrderLittle {
+			b = append(b, data[i+1], data[i])
+		} else {
+			b = append(b, data[i], data[i+1])
+		}
+	}
+	var u uint64
+	for _, x := range b {
+		u = u<<8 | uint64(x)
+	}
+
+	switch p.Type {
+	case TypeInt16:
+		v.Number = float64(int16(u)) * p.Scale
+	case TypeUint16:
+		v.Number = float64(uint16(u)) * p.Scale
+	case TypeInt32:
+		v.Number = float64(int32(u)) * p.Scale
+	case TypeUint32:
+		v.Number = float64(uint32(u)) * p.Scale
+	case TypeFloat32:
+		// shortest decimal of the float32, not of its float64 conversion: 230.1, not 230.10000610351562
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(math.Float32frombits(uint32(u))), 'g', -1, 32), 64)
+		v.Number = f * p.Scale
+	case TypeFloat64:
+		v.Number = math.Float64frombits(u) * p.Scale
+	case TypeString:
+		v.Text = strings.TrimRight(string(b), "\x00 ")
+	case TypeBitfield:
+		v.Number = float64(u)
+		names := []string{}
+		for n := uint32(0); n < 64; n++ {
+			if name, ok := p.Bits[n]; ok && u&(1<<n) != 0 {
+				names = append(names, name)
+			}
+		}
+		v.Text = strings.Join(names, "|")
+	}
+	return v
+}
+
+func (v *Value) PrettyString() string {
+	name := v.GetName()
+	if v.GetDevice() != "" {
+		name = v.GetDevice() + "." + name
+	}
+	if v.GetText() != "" {
+		return fmt.Sprintf("%s=%q", name, v.GetText())
+	}
+	return fmt.Sprintf("%s=%g%s", name, v.GetNumber(), v.GetUnit())
+}
+
+// ValueString returns the value alone: text, or number without unit
+func (v *Value) ValueString() string {
+	if v.GetText() != "" {
+		return v.GetText()
+	}
+	return strconv.FormatFloat(v.GetNumber(), 'f', -1, 64)
+}
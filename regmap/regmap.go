@@ -0,0 +1,293 @@
+package regmap
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/andreaaizza/sniffer/dissector"
+	"gopkg.in/yaml.v3"
+)
+
+// Data types of points
+const (
+	TypeInt16    = "int16"
+	TypeUint16   = "uint16"
+	TypeInt32    = "int32"
+	TypeUint32   = "uint32"
+	TypeFloat32  = "float32"
+	TypeFloat64  = "float64"
+	TypeString   = "string"
+	TypeBitfield = "bitfield"
+)
+
+// Word and byte orders
+const (
+	OrderBig    = "big"
+	OrderLittle = "little"
+)
+
+// Map register map: named points of devices
+type Map struct {
+	Devices []*Device `json:"devices" yaml:"devices"`
+
+	// points by slave address
+	points map[uint32][]*Point
+}
+
+// Device a slave with its points
+type Device struct {
+	Slave  uint32   `json:"slave" yaml:"slave"`
+	Name   string   `json:"name" yaml:"name"`
+	Points []*Point `json:"points" yaml:"points"`
+}
+
+// Point a value stored in one or more registers
+type Point struct {
+	Name string `json:"name" yaml:"name"`
+	// Table holdingRegisters or inputRegisters, see dissector.ParseTable
+	Table   dissector.Table `json:"table" yaml:"table"`
+	Address uint32          `json:"address" yaml:"address"`
+	// Type one of int16, uint16, int32, uint32, float32, float64, string, bitfield
+	Type string `json:"type" yaml:"type"`
+	// Length in registers, for string (required) and bitfield (1, 2 or 4, default 1)
+	Length uint32 `json:"length,omitempty" yaml:"length,omitempty"`
+	// WordOrder of values in more registers: big (default) high word first, little low word first
+	WordOrder string `json:"wordOrder,omitempty" yaml:"wordOrder,omitempty"`
+	// ByteOrder of bytes in a register: big (default) high byte first, little low byte first
+	ByteOrder string `json:"byteOrder,omitempty" yaml:"byteOrder,omitempty"`
+	// Scale numeric values are multiplied by, 1 if 0
+	Scale float64 `json:"scale,omitempty" yaml:"scale,omitempty"`
+	Unit  string  `json:"unit,omitempty" yaml:"unit,omitempty"`
+	// Bits names of bits of a bitfield, by bit number
+	Bits map[uint32]string `json:"bits,omitempty" yaml:"bits,omitempty"`
+
+	// Deadband change events are reported when the value changes by more than this, see package events
+	Deadband float64 `json:"deadband,omitempty" yaml:"deadband,omitempty"`
+	// DeadbandPercent change events are reported when the value changes by more than this percent of the last
+	// value reported
+	DeadbandPercent float64 `json:"deadbandPercent,omitempty" yaml:"deadbandPercent,omitempty"`
+
+	device *Device
+}
+
+// Load loads a register map from a YAML (.yaml, .yml), JSON (.json) or CSV (.csv) file
+func Load(path string) (m *Map, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if m, err = Parse(b, format); err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	return
+}
+
+// Parse parses a register map in format yaml, yml, json or csv.
+//
+// CSV files have a header with column names as JSON field names, one row for each point, with device slave and
+// name in columns slave and device. Bits are listed as number:name separated by ;
+func Parse(b []byte, format string) (m *Map, err error) {
+	m = &Map{}
+	switch format {
+	case "yaml", "yml":
+		err = yaml.Unmarshal(b, m)
+	case "json":
+		err = json.Unmarshal(b, m)
+	case "csv":
+		err = m.parseCSV(bytes.NewReader(b))
+	default:
+		err = fmt.Errorf("unknown register map format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = m.init(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (m *Map) parseCSV(r io.Reader) error {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"slave", "name", "table", "address", "type"} {
+		if _, ok := columns[strings.ToLower(required)]; !ok {
+			return fmt.Errorf("missing column %s", required)
+		}
+	}
+
+	devices := make(map[uint32]*Device)
+	for n, row := range rows[1:] {
+		line := n + 2
+		get := func(name string) string {
+			if i, ok := columns[strings.ToLower(name)]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		number := func(name string) (uint32, error) {
+			s := get(name)
+			if s == "" {
+				return 0, nil
+			}
+			v, err := strconv.ParseUint(s, 0, 32)
+			if err != nil {
+				return 0, fmt.Errorf("line %d: %s: %w", line, name, err)
+			}
+			return uint32(v), nil
+		}
+
+		slave, err := number("slave")
+		if err != nil {
+			return err
+		}
+		p := &Point{
+			Name:      get("name"),
+			Type:      get("type"),
+			WordOrder: get("wordOrder"),
+			ByteOrder: get("byteOrder"),
+			Unit:      get("unit"),
+		}
+		if p.Table, err = dissector.ParseTable(get("table")); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if p.Address, err = number("address"); err != nil {
+			return err
+		}
+		if p.Length, err = number("length"); err != nil {
+			return err
+		}
+		for name, f := range map[string]*float64{"scale": &p.Scale, "deadband": &p.Deadband, "deadbandPercent": &p.DeadbandPercent} {
+			if s := get(name); s != "" {
+				if *f, err = strconv.ParseFloat(s, 64); err != nil {
+					return fmt.Errorf("line %d: %s: %w", line, name, err)
+				}
+			}
+		}
+		if s := get("bits"); s != "" {
+			p.Bits = make(map[uint32]string)
+			for _, bit := range strings.Split(s, ";") {
+				kv := strings.SplitN(bit, ":", 2)
+				n, err := strconv.ParseUint(strings.TrimSpace(kv[0]), 0, 6)
+				if len(kv) != 2 || err != nil {
+					return fmt.Errorf("line %d: invalid bit %q", line, bit)
+				}
+				p.Bits[uint32(n)] = strings.TrimSpace(kv[1])
+			}
+		}
+
+		d, ok := devices[slave]
+		if !ok {
+			d = &Device{Slave: slave, Name: get("device")}
+			devices[slave] = d
+			m.Devices = append(m.Devices, d)
+		}
+		d.Points = append(d.Points, p)
+	}
+	return nil
+}
+
+// init validates points, sets defaults and indexes them
+func (m *Map) init() error {
+	m.points = make(map[uint32][]*Point)
+	for _, d := range m.Devices {
+		for _, p := range d.Points {
+			if err := p.init(d); err != nil {
+				return fmt.Errorf("slave %d point %q: %w", d.Slave, p.Name, err)
+			}
+			m.points[d.Slave] = append(m.points[d.Slave], p)
+		}
+	}
+	return nil
+}
+
+func (p *Point) init(d *Device) (err error) {
+	p.device = d
+	if !p.Table.IsRegister() {
+		return fmt.Errorf("table %s has no registers", p.Table)
+	}
+	p.Type = strings.ToLower(p.Type)
+	switch p.Type {
+	case TypeInt16, TypeUint16, TypeInt32, TypeUint32, TypeFloat32, TypeFloat64:
+	case TypeString:
+		if p.Length == 0 {
+			return fmt.Errorf("string needs a length")
+		}
+	case TypeBitfield:
+		switch p.Length {
+		case 0:
+			p.Length = 1
+		case 1, 2, 4:
+		default:
+			return fmt.Errorf("bitfield length should be 1, 2 or 4")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", p.Type)
+	}
+	if p.WordOrder, err = order(p.WordOrder); err != nil {
+		return
+	}
+	if p.ByteOrder, err = order(p.ByteOrder); err != nil {
+		return
+	}
+	if p.Scale == 0 {
+		p.Scale = 1
+	}
+	if p.Deadband < 0 || p.DeadbandPercent < 0 {
+		return fmt.Errorf("negative deadband")
+	}
+	return
+}
+
+// Point returns the point name of slave, nil if none
+func (m *Map) Point(slave uint32, name string) *Point {
+	if m == nil {
+		return nil
+	}
+	for _, p := range m.points[slave] {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func order(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", OrderBig:
+		return OrderBig, nil
+	case OrderLittle:
+		return OrderLittle, nil
+	}
+	return "", fmt.Errorf("unknown order %q", s)
+}
+
+// Registers returns the number of registers the point is stored in
+func (p *Point) Registers() uint32 {
+	switch p.Type {
+	case TypeInt32, TypeUint32, TypeFloat32:
+		return 2
+	case TypeFloat64:
+		return 4
+	case TypeString, TypeBitfield:
+		return p.Length
+	}
+	return 1
+}
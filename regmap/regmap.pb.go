@@ -0,0 +1,206 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.25.0
+// 	protoc        v3.12.3
+// source: regmap/regmap.proto
+
+package regmap
+
+import (
+	proto "github.com/golang/protobuf/proto"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+// Value of a point of a register map, decoded from registers
+type Value struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Device  string  `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	Name    string  `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Slave   uint32  `protobuf:"varint,3,opt,name=slave,proto3" json:"slave,omitempty"`     // 8bit
+	Address uint32  `protobuf:"varint,4,opt,name=address,proto3" json:"address,omitempty"` // first register, 16bit
+	Number  float64 `protobuf:"fixed64,5,opt,name=number,proto3" json:"number,omitempty"`  // numeric types, scaled. Raw value of bitfields
+	Text    string  `protobuf:"bytes,6,opt,name=text,proto3" json:"text,omitempty"`        // strings. Names of bits set of bitfields
+	Unit    string  `protobuf:"bytes,7,opt,name=unit,proto3" json:"unit,omitempty"`
+}
+
+func (x *Value) Reset() {
+	*x = Value{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_regmap_regmap_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Value) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Value) ProtoMessage() {}
+
+func (x *Value) ProtoReflect() protoreflect.Message {
+	mi := &file_regmap_regmap_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Value.ProtoReflect.Descriptor instead.
+func (*Value) Descriptor() ([]byte, []int) {
+	return file_regmap_regmap_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Value) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *Value) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Value) GetSlave() uint32 {
+	if x != nil {
+		return x.Slave
+	}
+	return 0
+}
+
+func (x *Value) GetAddress() uint32 {
+	if x != nil {
+		return x.Address
+	}
+	return 0
+}
+
+func (x *Value) GetNumber() float64 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *Value) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *Value) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+var File_regmap_regmap_proto protoreflect.FileDescriptor
+
+var file_regmap_regmap_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x72, 0x65, 0x67, 0x6d, 0x61, 0x70, 0x2f, 0x72, 0x65, 0x67, 0x6d, 0x61, 0x70, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x06, 0x72, 0x65, 0x67, 0x6d, 0x61, 0x70, 0x22, 0xa3, 0x01,
+	0x0a, 0x05, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x64, 0x65, 0x76, 0x69, 0x63,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65, 0x12,
+	0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e,
+	0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x6c, 0x61, 0x76, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x05, 0x73, 0x6c, 0x61, 0x76, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x64, 0x64,
+	0x72, 0x65, 0x73, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x61, 0x64, 0x64, 0x72,
+	0x65, 0x73, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x01, 0x52, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x74,
+	0x65, 0x78, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x65, 0x78, 0x74, 0x12,
+	0x12, 0x0a, 0x04, 0x75, 0x6e, 0x69, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75,
+	0x6e, 0x69, 0x74, 0x42, 0x27, 0x5a, 0x25, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f,
+	0x6d, 0x2f, 0x61, 0x6e, 0x64, 0x72, 0x65, 0x61, 0x61, 0x69, 0x7a, 0x7a, 0x61, 0x2f, 0x73, 0x6e,
+	0x69, 0x66, 0x66, 0x65, 0x72, 0x2f, 0x72, 0x65, 0x67, 0x6d, 0x61, 0x70, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_regmap_regmap_proto_rawDescOnce sync.Once
+	file_regmap_regmap_proto_rawDescData = file_regmap_regmap_proto_rawDesc
+)
+
+func file_regmap_regmap_proto_rawDescGZIP() []byte {
+	file_regmap_regmap_proto_rawDescOnce.Do(func() {
+		file_regmap_regmap_proto_rawDescData = protoimpl.X.CompressGZIP(file_regmap_regmap_proto_rawDescData)
+	})
+	return file_regmap_regmap_proto_rawDescData
+}
+
+var file_regmap_regmap_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_regmap_regmap_proto_goTypes = []interface{}{
+	(*Value)(nil), // 0: regmap.Value
+}
+var file_regmap_regmap_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_regmap_regmap_proto_init() }
+func file_regmap_regmap_proto_init() {
+	if File_regmap_regmap_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_regmap_regmap_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Value); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_regmap_regmap_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_regmap_regmap_proto_goTypes,
+		DependencyIndexes: file_regmap_regmap_proto_depIdxs,
+		MessageInfos:      file_regmap_regmap_proto_msgTypes,
+	}.Build()
+	File_regmap_regmap_proto = out.File
+	file_regmap_regmap_proto_rawDesc = nil
+	file_regmap_regmap_proto_goTypes = nil
+	file_regmap_regmap_proto_depIdxs = nil
+}
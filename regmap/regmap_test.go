@@ -0,0 +1,122 @@
+package regmap
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/util"
+)
+
+const testYAML = `
+devices:
+  - slave: 2
+    name: meter
+    points:
+      - {name: voltage, table: input, address: 0, type: float32, unit: V}
+      - {name: energy, table: input, address: 2, type: uint32, wordOrder: little, scale: 0.1, unit: kWh}
+      - {name: serial, table: input, address: 4, type: string, length: 2}
+      - {name: status, table: input, address: 6, type: bitfield, bits: {0: run, 3: alarm}}
+      - {name: power, table: input, address: 7, type: int16, byteOrder: little, unit: W}
+      - {name: setpoint, table: holding, address: 0, type: int16}
+      - {name: limit, table: holding, address: 1, type: float32}
+`
+
+const testCSV = `slave,device,name,table,address,type,length,wordOrder,byteOrder,scale,unit,bits
+2,meter,voltage,input,0,float32,,,,,V,
+2,meter,energy,input,2,uint32,,little,,0.1,kWh,
+2,meter,serial,input,4,string,2,,,,,
+2,meter,status,input,6,bitfield,,,,,,0:run;3:alarm
+2,meter,power,input,7,int16,,,little,,W,
+2,meter,setpoint,holding,0,int16,,,,,,
+2,meter,limit,holding,1,float32,,,,,,
+`
+
+func TestDecode(t *testing.T) {
+	registers := []byte{
+		0x43, 0x66, 0x19, 0x9A, // 230.1
+		0x00, 0x0A, 0x00, 0x01, // 0x1000A = 65546
+		'A', 'B', 'C', 0x00,
+		0x00, 0x09, // bits 0, 3
+		0x18, 0xFC, // -1000
+	}
+	want := []string{`meter.voltage=230.1V`, `meter.energy=6554.6kWh`, `meter.serial="ABC"`, `meter.status="run|alarm"`, `meter.power=-1000W`}
+
+	for _, format := range []string{"yaml", "csv"} {
+		b := []byte(testYAML)
+		if format == "csv" {
+			b = []byte(testCSV)
+		}
+		m, err := Parse(b, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		values := m.Decode(2, dissector.TableInputRegisters, 0, registers)
+		if len(values) != len(want) {
+			t.Fatalf("%s: got %d values, want %d", format, len(values), len(want))
+		}
+		for i, v := range values {
+			if got := v.PrettyString(); got != want[i] {
+				t.Errorf("%s: got %s, want %s", format, got, want[i])
+			}
+		}
+
+		// points not entirely read, other slaves
+		if values := m.Decode(2, dissector.TableInputRegisters, 1, registers[:4]); len(values) != 0 {
+			t.Errorf("%s: got %d values of partially read points, want 0", format, len(values))
+		}
+		if values := m.Decode(3, dissector.TableInputRegisters, 0, registers); len(values) != 0 {
+			t.Errorf("%s: got %d values of unknown slave, want 0", format, len(values))
+		}
+	}
+
+	if _, err := Parse([]byte("devices: [{slave: 1, points: [{name: x, table: coils, address: 0, type: int16}]}]"), "yaml"); err == nil {
+		t.Error("got no error for a point in coils")
+	}
+}
+
+func TestDecodeADUs(t *testing.T) {
+	frames := [][]byte{
+		// write setpoint and limit, answered
+		{0x02, 0x10, 0x00, 0x00, 0x00, 0x03, 0x06, 0xFF, 0xFE, 0x43, 0x66, 0x19, 0x9A, 0xA0, 0xF8},
+		{0x02, 0x10, 0x00, 0x00, 0x00, 0x03, 0x80, 0x3B},
+		// write setpoint, read limit
+		{0x02, 0x17, 0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0x02, 0x00, 0x05, 0x80, 0xBE},
+		{0x02, 0x17, 0x04, 0x43, 0x66, 0x19, 0x9A, 0xB4, 0x47},
+		// write setpoint
+		{0x02, 0x06, 0x00, 0x00, 0x00, 0x07, 0xC8, 0x3B},
+	}
+	var dus []*logger.DataUnit
+	for i, f := range frames {
+		ts := util.TimestampBuilder(time.Date(2020, 9, 14, 8, 45, 54, i*20e6, time.UTC))
+		dus = append(dus, &logger.DataUnit{Time: &ts, Data: f})
+	}
+	adus, _ := dissector.Dissect(dus, "/dev/ttyUSB0", dissector.FilterAnyModbus{})
+	if len(adus) != len(frames) {
+		t.Fatalf("got %d ADUs, want %d", len(adus), len(frames))
+	}
+	m, err := Parse([]byte(testYAML), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		req, rsp *dissector.Result
+		want     string
+	}{
+		{adus[0], adus[1], "meter.setpoint=-2 meter.limit=230.1"},
+		{adus[2], adus[3], "meter.setpoint=5 meter.limit=230.1"},
+		{adus[4], nil, "meter.setpoint=7"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, v := range m.DecodeADUs(tt.req.GetAdu(), tt.rsp.GetAdu()) {
+			got = append(got, v.PrettyString())
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("FC%d: got %v, want %s", tt.req.GetAdu().GetPduRequest().GetFunctionCode(), got, tt.want)
+		}
+	}
+}
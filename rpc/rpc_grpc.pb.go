@@ -0,0 +1,246 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package rpc
+
+import (
+	context "context"
+	sniffer "github.com/andreaaizza/sniffer"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// SnifferClient is the client API for Sniffer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SnifferClient interface {
+	// Subscribe streams results as soon as they are matched, until the client cancels or the sniffer stops
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Sniffer_SubscribeClient, error)
+	// GetStats returns bus statistics
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error)
+	// GetProcessImage returns the last value of coils, inputs and registers read or written
+	GetProcessImage(ctx context.Context, in *GetProcessImageRequest, opts ...grpc.CallOption) (*ProcessImage, error)
+	// ListPorts returns the ports sniffed
+	ListPorts(ctx context.Context, in *ListPortsRequest, opts ...grpc.CallOption) (*Ports, error)
+}
+
+type snifferClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSnifferClient(cc grpc.ClientConnInterface) SnifferClient {
+	return &snifferClient{cc}
+}
+
+func (c *snifferClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Sniffer_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Sniffer_ServiceDesc.Streams[0], "/rpc.Sniffer/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &snifferSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Sniffer_SubscribeClient interface {
+	Recv() (*sniffer.Result, error)
+	grpc.ClientStream
+}
+
+type snifferSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *snifferSubscribeClient) Recv() (*sniffer.Result, error) {
+	m := new(sniffer.Result)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *snifferClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error) {
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, "/rpc.Sniffer/GetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *snifferClient) GetProcessImage(ctx context.Context, in *GetProcessImageRequest, opts ...grpc.CallOption) (*ProcessImage, error) {
+	out := new(ProcessImage)
+	err := c.cc.Invoke(ctx, "/rpc.Sniffer/GetProcessImage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *snifferClient) ListPorts(ctx context.Context, in *ListPortsRequest, opts ...grpc.CallOption) (*Ports, error) {
+	out := new(Ports)
+	err := c.cc.Invoke(ctx, "/rpc.Sniffer/ListPorts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SnifferServer is the server API for Sniffer service.
+// All implementations must embed UnimplementedSnifferServer
+// for forward compatibility
+type SnifferServer interface {
+	// Subscribe streams results as soon as they are matched, until the client cancels or the sniffer stops
+	Subscribe(*SubscribeRequest, Sniffer_SubscribeServer) error
+	// GetStats returns bus statistics
+	GetStats(context.Context, *GetStatsRequest) (*Stats, error)
+	// GetProcessImage returns the last value of coils, inputs and registers read or written
+	GetProcessImage(context.Context, *GetProcessImageRequest) (*ProcessImage, error)
+	// ListPorts returns the ports sniffed
+	ListPorts(context.Context, *ListPortsRequest) (*Ports, error)
+	mustEmbedUnimplementedSnifferServer()
+}
+
+// UnimplementedSnifferServer must be embedded to have forward compatible implementations.
+type UnimplementedSnifferServer struct {
+}
+
+func (UnimplementedSnifferServer) Subscribe(*SubscribeRequest, Sniffer_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedSnifferServer) GetStats(context.Context, *GetStatsRequest) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedSnifferServer) GetProcessImage(context.Context, *GetProcessImageRequest) (*ProcessImage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetProcessImage not implemented")
+}
+func (UnimplementedSnifferServer) ListPorts(context.Context, *ListPortsRequest) (*Ports, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPorts not implemented")
+}
+func (UnimplementedSnifferServer) mustEmbedUnimplementedSnifferServer() {}
+
+// UnsafeSnifferServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SnifferServer will
+// result in compilation errors.
+type UnsafeSnifferServer interface {
+	mustEmbedUnimplementedSnifferServer()
+}
+
+func RegisterSnifferServer(s grpc.ServiceRegistrar, srv SnifferServer) {
+	s.RegisterService(&Sniffer_ServiceDesc, srv)
+}
+
+func _Sniffer_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SnifferServer).Subscribe(m, &snifferSubscribeServer{stream})
+}
+
+type Sniffer_SubscribeServer interface {
+	Send(*sniffer.Result) error
+	grpc.ServerStream
+}
+
+type snifferSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *snifferSubscribeServer) Send(m *sniffer.Result) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Sniffer_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SnifferServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Sniffer/GetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SnifferServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sniffer_GetProcessImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetProcessImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SnifferServer).GetProcessImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Sniffer/GetProcessImage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SnifferServer).GetProcessImage(ctx, req.(*GetProcessImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sniffer_ListPorts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPortsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SnifferServer).ListPorts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Sniffer/ListPorts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SnifferServer).ListPorts(ctx, req.(*ListPortsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Sniffer_ServiceDesc is the grpc.ServiceDesc for Sniffer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Sniffer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "rpc.Sniffer",
+	HandlerType: (*SnifferServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStats",
+			Handler:    _Sniffer_GetStats_Handler,
+		},
+		{
+			MethodName: "GetProcessImage",
+			Handler:    _Sniffer_GetProcessImage_Handler,
+		},
+		{
+			MethodName: "ListPorts",
+			Handler:    _Sniffer_ListPorts_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Sniffer_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "rpc/rpc.proto",
+}
@@ -0,0 +1,216 @@
+// Package rpc serves sniffed traffic over gRPC: live results, bus statistics, process image and ports, see rpc.proto
+package rpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/filter"
+	"github.com/andreaaizza/sniffer/util"
+
+	tspb "github.com/golang/protobuf/ptypes/timestamp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SubscriberBufferDefault results waiting to be sent to a subscriber, beyond which new ones are dropped for it
+const SubscriberBufferDefault = 256
+
+type subscriber struct {
+	filter  *filter.Filter
+	results chan *sniffer.Result
+}
+
+// Server implements the Sniffer service of a Source. Results are sent to each subscriber from a buffer, so that a
+// slow one never blocks the sniffer nor other subscribers.
+type Server struct {
+	UnimplementedSnifferServer
+
+	src    sniffer.Source
+	remove func()
+
+	mux         sync.Mutex
+	subscribers map[*subscriber]bool
+	closed      bool
+	done        chan struct{}
+	dropped     uint64
+}
+
+// NewServer creates a server of src
+func NewServer(src sniffer.Source) *Server {
+	srv := &Server{src: src, subscribers: make(map[*subscriber]bool), done: make(chan struct{})}
+	srv.remove = src.OnResult(srv.publish)
+	return srv
+}
+
+// Register registers the service to g
+func (srv *Server) Register(g *grpc.Server) {
+	RegisterSnifferServer(g, srv)
+}
+
+// Dropped returns the number of results dropped because a subscriber was too slow
+func (srv *Server) Dropped() uint64 {
+	return atomic.LoadUint64(&srv.dropped)
+}
+
+// Close ends the streams of subscribers. Call before stopping the grpc.Server, so that it does not wait for them.
+func (srv *Server) Close() {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	if !srv.closed {
+		srv.closed = true
+		srv.remove()
+		close(srv.done)
+	}
+}
+
+// publish queues r to subscribers matching it
+func (srv *Server) publish(r *sniffer.Result) {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	for sub := range srv.subscribers {
+		if !sub.filter.Match(r) {
+			continue
+		}
+		select {
+		case sub.results <- r:
+		default:
+			atomic.AddUint64(&srv.dropped, 1)
+		}
+	}
+}
+
+// Subscribe streams results matching the filter of req
+func (srv *Server) Subscribe(req *SubscribeRequest, stream Sniffer_SubscribeServer) error {
+	sub := &subscriber{results: make(chan *sniffer.Result, SubscriberBufferDefault)}
+	if req.GetFilter() != "" {
+		f, err := filter.Compile(req.GetFilter())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		sub.filter = f
+	}
+
+	srv.mux.Lock()
+	if srv.closed {
+		srv.mux.Unlock()
+		return status.Error(codes.Unavailable, "sniffer closed")
+	}
+	srv.subscribers[sub] = true
+	srv.mux.Unlock()
+	defer func() {
+		srv.mux.Lock()
+		delete(srv.subscribers, sub)
+		srv.mux.Unlock()
+	}()
+
+	for {
+		select {
+		case r := <-sub.results:
+			if err := stream.Send(r); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-srv.done:
+			return nil
+		}
+	}
+}
+
+// GetStats returns a snapshot of the bus statistics
+func (srv *Server) GetStats(ctx context.Context, req *GetStatsRequest) (*Stats, error) {
+	snap := srv.src.Metrics().Snapshot()
+	stats := &Stats{Time: protoTime(snap.Time), UptimeSeconds: snap.UptimeSeconds}
+	for _, p := range snap.Ports {
+		stats.Ports = append(stats.Ports, &PortStats{
+			Port:            p.Port,
+			Baud:            uint32(p.Baud),
+			Bytes:           p.Bytes,
+			Frames:          p.Frames,
+			InvalidFrames:   p.InvalidFrames,
+			InvalidBytes:    p.InvalidBytes,
+			Connected:       p.Connected,
+			Reconnects:      p.Reconnects,
+			BytesPerSecond:  p.BytesPerSecond,
+			FramesPerSecond: p.FramesPerSecond,
+			Utilisation:     p.Utilisation,
+			CrcErrorRate:    p.CRCErrorRate,
+		})
+	}
+	for _, sl := range snap.Slaves {
+		s := &SlaveStats{
+			Port:          sl.Port,
+			Address:       sl.Address,
+			Requests:      sl.Requests,
+			Responses:     sl.Responses,
+			Exceptions:    sl.Exceptions,
+			Timeouts:      sl.Timeouts,
+			ExceptionRate: sl.ExceptionRate,
+			TimeoutRate:   sl.TimeoutRate,
+			Latency: &Histogram{Bounds: sl.Latency.Bounds, Counts: sl.Latency.Counts, Count: sl.Latency.Count,
+				Sum: sl.Latency.Sum},
+		}
+		for _, f := range sl.Functions {
+			s.Functions = append(s.Functions, &FunctionStats{FunctionCode: f.FunctionCode, Requests: f.Requests,
+				Responses: f.Responses, Timeouts: f.Timeouts, Exceptions: f.Exceptions})
+		}
+		stats.Slaves = append(stats.Slaves, s)
+	}
+	return stats, nil
+}
+
+// GetProcessImage returns the known points selected by req
+func (srv *Server) GetProcessImage(ctx context.Context, req *GetProcessImageRequest) (*ProcessImage, error) {
+	table := dissector.TableNone
+	if req.GetTable() != "" {
+		t, err := dissector.ParseTable(req.GetTable())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		table = t
+	}
+	var since time.Time
+	if req.GetChangedSince() != nil {
+		since = util.TimeBuilder(req.GetChangedSince())
+	}
+	image := &ProcessImage{}
+	for _, p := range srv.src.ProcessImage().ChangedSince(since) {
+		if req.GetSlave() != 0 && p.Slave != req.GetSlave() || table != dissector.TableNone && p.Table != table {
+			continue
+		}
+		image.Points = append(image.Points, &Point{Slave: p.Slave, Table: p.Table.String(), Address: p.Address,
+			Value: p.Value, Updated: protoTime(p.Updated), Changed: protoTime(p.Changed)})
+	}
+	return image, nil
+}
+
+// ListPorts returns the ports sniffed
+func (srv *Server) ListPorts(ctx context.Context, req *ListPortsRequest) (*Ports, error) {
+	snap := srv.src.Metrics().Snapshot()
+	connected := make(map[string]bool)
+	for _, p := range snap.Ports {
+		connected[p.Port] = p.Connected
+	}
+	ports := &Ports{}
+	configs := srv.src.Ports()
+	for i, c := range configs {
+		ports.Ports = append(ports.Ports, &Port{Name: c.Port, Baud: uint32(c.Baud), FrameFormat: c.FrameFormat,
+			Role: sniffer.PortRole(i, len(configs)), Connected: connected[c.Port]})
+	}
+	return ports, nil
+}
+
+// protoTime returns t as protobuf, nil if zero
+func protoTime(t time.Time) *tspb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	ts := util.TimestampBuilder(t)
+	return &ts
+}
@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServer(t *testing.T) {
+	src := sniffertest.NewSource()
+	srv := NewServer(src)
+
+	l := bufconn.Listen(1 << 16)
+	g := grpc.NewServer()
+	srv.Register(g)
+	go g.Serve(l)
+	defer g.Stop()
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(
+		func(context.Context, string) (net.Conn, error) { return l.Dial() }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := NewSnifferClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// invalid filter
+	stream, err := client.Subscribe(ctx, &SubscribeRequest{Filter: "slave =="})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v, want InvalidArgument", err)
+	}
+
+	stream, err = client.Subscribe(ctx, &SubscribeRequest{Filter: "exception"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for subscribed := false; !subscribed; time.Sleep(time.Millisecond) {
+		srv.mux.Lock()
+		subscribed = len(srv.subscribers) == 1
+		srv.mux.Unlock()
+	}
+	for _, r := range sniffertest.Results(t) {
+		src.Publish(r)
+	}
+	r, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.GetResponse().GetAdu().IsException() || !r.GetRequest().GetAdu().GetTimeTime().Equal(time.Date(2020, 9, 14, 8, 45, 54, 40e6, time.UTC)) {
+		t.Errorf("got %s, want the exception", r.PrettyString())
+	}
+	srv.Close()
+	if _, err := stream.Recv(); err == nil {
+		t.Error("got no end of stream on close")
+	}
+
+	stats, err := client.GetStats(ctx, &GetStatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.GetPorts()) != 1 || stats.GetPorts()[0].GetBaud() != 9600 || !stats.GetPorts()[0].GetConnected() {
+		t.Errorf("got stats %v", stats)
+	}
+
+	image, err := client.GetProcessImage(ctx, &GetProcessImageRequest{Slave: 2, Table: "holdingRegisters"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(image.GetPoints()) != 2 || image.GetPoints()[1].GetAddress() != 0x1001 || image.GetPoints()[1].GetValue() != 2 {
+		t.Errorf("got image %v", image)
+	}
+	if _, err := client.GetProcessImage(ctx, &GetProcessImageRequest{Table: "registers"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v, want InvalidArgument", err)
+	}
+
+	ports, err := client.ListPorts(ctx, &ListPortsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports.GetPorts()) != 1 || ports.GetPorts()[0].GetRole() != "txrx" || !ports.GetPorts()[0].GetConnected() {
+		t.Errorf("got ports %v", ports)
+	}
+}
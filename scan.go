@@ -0,0 +1,425 @@
+package sniffer
+
+import (
+	"context"
+	"log"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/logger"
+)
+
+var ModbusSpeeds = []int{9600, 19200, 38400, 115200, 57600, 4800, 2400, 1200}
+
+const (
+	// ScanMinMatchesDefault request->response/exception matches needed to stop scanning early
+	ScanMinMatchesDefault = 3
+	// ScanMinConfidenceDefault confidence needed to stop scanning early
+	ScanMinConfidenceDefault = 0.5
+
+	// scanEvaluateEvery captured data is dissected this often while scanning
+	scanEvaluateEvery = 500 * time.Millisecond
+
+	// scanParityConsistency share of bytes which must agree with a parity, to detect it
+	scanParityConsistency = 0.95
+)
+
+// ScanOptions configures a scan
+type ScanOptions struct {
+	// Speed if not nil, only this speed is tried
+	Speed *int
+	// Frame if not nil, only this frame format is tried
+	Frame *string
+	// Seconds capture at each speed for up to this time
+	Seconds int
+	// Estimate ranks ScanSpeeds with EstimateSpeeds before scanning, instead of scanning ModbusSpeeds in order
+	Estimate bool
+	// ProbeSeconds estimating speed, read at each probe speed for up to this time, ScanProbeSecondsDefault if 0
+	ProbeSeconds int
+	// MinMatches stop as soon as this many request->response/exception matches are found, with MinConfidence.
+	// ScanMinMatchesDefault if 0
+	MinMatches int
+	// MinConfidence stop as soon as a configuration is scored this confidence, with MinMatches.
+	// ScanMinConfidenceDefault if 0
+	MinConfidence float64
+
+	Debug bool
+}
+
+// ScanPort scans for a valid Modbus RTU serial port configuration of conf ports.
+// Connect one 485 line to an active line with traffic to run this.
+func ScanPort(conf Config, speed *int, frame *string, scanForSeconds int, debug bool) *Config {
+	reports := ScanPorts(context.Background(), []Config{conf}, ScanOptions{
+		Speed: speed, Frame: frame, Seconds: scanForSeconds, Debug: debug})
+	return reports[0].Config()
+}
+
+// ScanPorts scans candidates concurrently, and returns a report for each of them.
+// Each speed is captured once, and the capture is dissected offline under every frame format hypothesis:
+// reading at 8N1 with errors marked (linux), the parity of 8 bit lines is told by framing errors and the parity
+// of 7 bit lines by the 8th bit. Stop bits cannot be told apart, 1 is reported, 2 for 7 bit lines without parity.
+func ScanPorts(ctx context.Context, candidates []Config, opts ScanOptions) []*ScanReport {
+	if opts.MinMatches <= 0 {
+		opts.MinMatches = ScanMinMatchesDefault
+	}
+	if opts.MinConfidence <= 0 {
+		opts.MinConfidence = ScanMinConfidenceDefault
+	}
+
+	reports := make([]*ScanReport, len(candidates))
+	var wg sync.WaitGroup
+	for i := range candidates {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reports[i] = scanCandidate(ctx, candidates[i], opts)
+		}(i)
+	}
+	wg.Wait()
+	return reports
+}
+
+// scanCandidate tries each speed on conf ports, most likely first if estimated
+func scanCandidate(ctx context.Context, conf Config, opts ScanOptions) (report *ScanReport) {
+	report = &ScanReport{}
+	for _, p := range conf.Ports {
+		report.Ports = append(report.Ports, p.Port)
+	}
+
+	speeds := ModbusSpeeds
+	if opts.Speed != nil {
+		speeds = []int{*opts.Speed}
+	} else if opts.Estimate {
+		seconds := opts.ProbeSeconds
+		if seconds <= 0 {
+			seconds = ScanProbeSecondsDefault
+		}
+		estimates, err := EstimateSpeeds(ctx, conf, seconds, opts.Debug)
+		if err != nil {
+			log.Printf("Estimating speed of %s: %v", conf.portNames(), err)
+		} else {
+			report.Estimates = estimates
+			speeds = []int{}
+			for _, e := range estimates {
+				if opts.Debug {
+					log.Printf("Port %s %s", conf.portNames(), e.PrettyString())
+				}
+				speeds = append(speeds, e.Speed)
+			}
+		}
+	}
+
+	for _, speed := range speeds {
+		scores, err := scanSpeed(ctx, conf, speed, opts)
+		if err != nil {
+			log.Printf("Scanning %s at %d: %v", conf.portNames(), speed, err)
+		}
+		report.add(scores...)
+		if (report.Best != nil && report.Best.confident(opts)) || ctx.Err() != nil {
+			break
+		}
+	}
+	return
+}
+
+// scanSpeed captures conf ports at speed for up to opts.Seconds, and returns the score of each frame format
+// hypothesis
+func scanSpeed(ctx context.Context, conf Config, speed int, opts ScanOptions) (scores []*ScanScore, err error) {
+	frame := "8N1"
+	if opts.Frame != nil {
+		frame = *opts.Frame
+	}
+	if opts.Debug {
+		log.Printf("Capturing %s at %d %s", conf.portNames(), speed, frame)
+	}
+
+	start := time.Now()
+	e := newCaptureEvaluator(conf, speed, opts.Frame)
+	_, err = capture(ctx, conf, speed, frame, opts.Frame == nil, opts.Seconds, opts.Debug,
+		func(captures [][]*logger.DataUnit, marked bool) bool {
+			scores = e.evaluate(captures, marked)
+			confident := false
+			for _, sc := range scores {
+				sc.Seconds = time.Since(start).Seconds()
+				sc.score(opts.MinMatches)
+				if opts.Debug {
+					log.Printf("Port %s %s", conf.portNames(), sc.PrettyString())
+				}
+				confident = confident || sc.confident(opts)
+			}
+			return confident
+		})
+	return
+}
+
+// capture reads conf ports at speed and frame for up to seconds. Every scanEvaluateEvery, and at the end, data
+// captured so far is passed to evaluate, which stops the capture by returning true.
+// Returns data captured, for each port.
+func capture(ctx context.Context, conf Config, speed int, frame string, markErrors bool, seconds int, debug bool,
+	evaluate func(captures [][]*logger.DataUnit, marked bool) bool) (captures [][]*logger.DataUnit, err error) {
+
+	var mux sync.Mutex
+	captures = make([][]*logger.DataUnit, len(conf.Ports))
+	marked := markErrors
+	loggers := []*logger.Logger{}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		for _, l := range loggers {
+			l.Close()
+		}
+		close(done)
+		wg.Wait()
+	}()
+	for i, p := range conf.Ports {
+		l, err := logger.New(&logger.Config{Port: p.Port, Baud: speed, FrameFormat: frame, Debug: debug,
+			MarkErrors: markErrors})
+		if err != nil {
+			return nil, err
+		}
+		loggers = append(loggers, l)
+		marked = marked && l.MarkingErrors()
+
+		c := make(chan *logger.DataUnit)
+		l.Subscribe(c)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case du := <-c:
+					mux.Lock()
+					captures[i] = append(captures[i], du)
+					mux.Unlock()
+				case <-done:
+					return
+				}
+			}
+		}(i)
+	}
+
+	timeout := time.After(time.Duration(seconds) * time.Second)
+	ticker := time.NewTicker(scanEvaluateEvery)
+	defer ticker.Stop()
+	for {
+		stop := false
+		select {
+		case <-ctx.Done():
+			stop = true
+		case <-timeout:
+			stop = true
+		case <-ticker.C:
+		}
+
+		// captures are only appended to, data captured so far can be shared
+		mux.Lock()
+		dus := make([][]*logger.DataUnit, len(captures))
+		for i := range captures {
+			dus[i] = captures[i][:len(captures[i]):len(captures[i])]
+		}
+		mux.Unlock()
+
+		if evaluate(dus, marked) || stop {
+			return dus, nil
+		}
+	}
+}
+
+// hypothesis a frame format data captured is dissected under, with what was found so far
+type hypothesis struct {
+	// dataBits 8 or 7 of data captured at 8N1, 0 if captured with the frame format scanned
+	dataBits int
+	score    ScanScore
+
+	dissectors []*dissector.Offline
+	sniffer    *Sniffer
+	rx, tx     []*dissector.Result
+	// total, even, odd parity counts
+	total, even, odd int
+}
+
+// captureEvaluator scores data captured at a speed under each frame format hypothesis. Data is dissected once:
+// each evaluation only dissects data captured since the previous one.
+type captureEvaluator struct {
+	conf       Config
+	speed      int
+	frame      *string
+	hypotheses []*hypothesis
+	// seen DataUnits of each port dissected so far
+	seen []int
+}
+
+// newCaptureEvaluator creates an evaluator of data captured from conf ports at speed. If frame is not nil, data is
+// captured with that frame format, otherwise at 8N1.
+func newCaptureEvaluator(conf Config, speed int, frame *string) *captureEvaluator {
+	e := &captureEvaluator{conf: conf, speed: speed, frame: frame, seen: make([]int, len(conf.Ports))}
+	dataBits := []int{8, 7}
+	if frame != nil {
+		dataBits = []int{0}
+	}
+	for _, b := range dataBits {
+		h := &hypothesis{dataBits: b, rx: []*dissector.Result{}, tx: []*dissector.Result{},
+			sniffer: &Sniffer{streamOnly: true, stream: newStream(1, ResultsDrop), stop: make(chan struct{})}}
+		// match offline, as the sniffer would
+		h.sniffer.OnResult(func(r *Result) {
+			h.score.Matches++
+			if r.GetResponse().GetAdu().IsException() {
+				h.score.Exceptions++
+			}
+		})
+		for i, p := range conf.Ports {
+			var filter dissector.ResultFilter = dissector.FilterAnyModbus{}
+			if len(conf.Ports) == 2 {
+				if i == 0 {
+					filter = dissector.FilterOnlyModbusRequest{}
+				} else {
+					filter = dissector.FilterOnlyModbusResponseOrException{}
+				}
+			}
+			h.dissectors = append(h.dissectors, dissector.NewOffline(p.Port, filter))
+		}
+		e.hypotheses = append(e.hypotheses, h)
+	}
+	return e
+}
+
+// evaluate dissects data captured since the last evaluation, and returns the score of each hypothesis on all data
+// captured so far
+func (e *captureEvaluator) evaluate(captures [][]*logger.DataUnit, marked bool) (scores []*ScanScore) {
+	added := make([][]*logger.DataUnit, len(captures))
+	for i := range captures {
+		added[i] = captures[i][e.seen[i]:]
+		e.seen[i] = len(captures[i])
+	}
+	for _, h := range e.hypotheses {
+		h.add(added)
+		sc := h.score
+		sc.Speed = e.speed
+		if e.frame != nil {
+			sc.FrameFormat = *e.frame
+		} else {
+			sc.FrameFormat = detectParity(h.dataBits, marked, h.total, h.even, h.odd)
+		}
+		scores = append(scores, &sc)
+	}
+	return
+}
+
+// add dissects data captured, with data bytes masked to the data bits, and counts frames and
+// request->response/exception matches found
+func (h *hypothesis) add(captures [][]*logger.DataUnit) {
+	var all []*dissector.Result
+	h.score.InvalidBytes = 0
+	for i, dus := range captures {
+		if h.dataBits == 7 {
+			masked := make([]*logger.DataUnit, 0, len(dus))
+			for _, du := range dus {
+				data := make([]byte, len(du.GetData()))
+				for j, b := range du.GetData() {
+					data[j] = b & 0x7F
+				}
+				masked = append(masked, &logger.DataUnit{Time: du.GetTime(), Data: data, Gap: du.GetGap()})
+			}
+			dus = masked
+		}
+		for _, du := range dus {
+			h.score.Bytes += len(du.GetData())
+		}
+		all = append(all, h.dissectors[i].Add(dus)...)
+		h.score.InvalidBytes += h.dissectors[i].InvalidBytes()
+	}
+	if h.dataBits != 0 {
+		total, even, odd, _ := parityCounts(captures, h.dataBits)
+		h.total, h.even, h.odd = h.total+total, h.even+even, h.odd+odd
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].GetAdu().GetTimeTime().Before(all[j].GetAdu().GetTimeTime())
+	})
+	for _, r := range all {
+		adu := r.GetAdu()
+		h.score.Frames++
+		if adu.IsRequest() {
+			h.sniffer.pushRequest(r, &h.tx)
+			h.sniffer.findRxTxMatch(&h.rx, &h.tx, adu.GetTimeTime())
+		} else if adu.IsResponse() || adu.IsException() {
+			h.sniffer.pushResponse(r, &h.rx, &h.tx, adu.GetTimeTime())
+		}
+	}
+}
+
+// detectParity tells the frame format of data captured at 8N1, from parity counts
+func detectParity(dataBits int, marked bool, total int, even int, odd int) string {
+	if dataBits == 8 && !marked {
+		// parity cannot be told
+		return "8N1"
+	}
+	switch {
+	case total == 0:
+	case float64(even) >= scanParityConsistency*float64(total):
+		return frameFormat(dataBits, "E")
+	case float64(odd) >= scanParityConsistency*float64(total):
+		return frameFormat(dataBits, "O")
+	}
+	return frameFormat(dataBits, "N")
+}
+
+// parityCounts counts bytes of data captured at 8N1 consistent with even and odd parity, and bytes with the parity
+// bit set. With 8 data bits, the parity bit is read as the stop bit: bytes with framing errors have it 0.
+// With 7 data bits, the parity bit is read as the 8th bit.
+func parityCounts(captures [][]*logger.DataUnit, dataBits int) (total int, even int, odd int, high int) {
+	for _, dus := range captures {
+		for _, du := range dus {
+			errs := make(map[uint32]bool)
+			for _, e := range du.GetFramingErrors() {
+				errs[e] = true
+			}
+			for i, b := range du.GetData() {
+				var parityBit bool
+				ones := bits.OnesCount8(b)
+				if dataBits == 8 {
+					parityBit = !errs[uint32(i)]
+				} else {
+					parityBit = b&0x80 != 0
+					ones = bits.OnesCount8(b & 0x7F)
+				}
+				total++
+				if parityBit {
+					high++
+				}
+				if (ones%2 == 1) == parityBit {
+					even++
+				} else {
+					odd++
+				}
+			}
+		}
+	}
+	return
+}
+
+// portNames returns the names of ports, comma separated
+func (c *Config) portNames() (s string) {
+	for i, p := range c.Ports {
+		if i > 0 {
+			s += ","
+		}
+		s += p.Port
+	}
+	return
+}
+
+// frameFormat returns the frame format of a line with dataBits and parity. Stop bits cannot be told: 1, but 2 for 7 data
+// bits without parity, whose 8th bit read at 8N1 is always 1, a stop bit.
+func frameFormat(dataBits int, parity string) string {
+	if dataBits == 7 {
+		if parity == "N" {
+			return "7N2"
+		}
+		return "7" + parity + "1"
+	}
+	return "8" + parity + "1"
+}
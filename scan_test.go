@@ -0,0 +1,73 @@
+package sniffer
+
+import (
+	"math/bits"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/util"
+)
+
+// captureAt8N1 builds data as read at 8N1 from a 8<parity>1 line: framing errors on bytes with parity bit 0
+func captureAt8N1(parity string, frames ...[]byte) (dus []*logger.DataUnit) {
+	t0 := time.Date(2020, 9, 12, 19, 53, 58, 0, time.UTC)
+	for i, f := range frames {
+		ts := util.TimestampBuilder(t0.Add(time.Duration(i) * 20 * time.Millisecond))
+		du := &logger.DataUnit{Time: &ts, Data: f}
+		for j, b := range f {
+			odd := bits.OnesCount8(b)%2 == 1
+			if (parity == "E" && !odd) || (parity == "O" && odd) {
+				du.FramingErrors = append(du.FramingErrors, uint32(j))
+			}
+		}
+		dus = append(dus, du)
+	}
+	return
+}
+
+func TestEvaluateCapture(t *testing.T) {
+	req := []byte{0x02, 0x04, 0x00, 0x00, 0x00, 0x0A, 0x70, 0x3E}
+	rsp := []byte{0x02, 0x04, 0x14, 0x80, 0x03, 0x80, 0x03, 0x80, 0x01, 0x80, 0x01, 0x80, 0x01, 0x80, 0x03, 0x00, 0x37, 0x80, 0x03, 0x80, 0x03, 0x80, 0x03, 0x90, 0x1F}
+	conf := Config{Ports: []*logger.Config{{Port: "test"}}}
+
+	for _, parity := range []string{"N", "E", "O"} {
+		dus := captureAt8N1(parity, req, rsp, req, rsp)
+		scores := newCaptureEvaluator(conf, 9600, nil).evaluate([][]*logger.DataUnit{dus}, true)
+		if len(scores) != 2 {
+			t.Fatalf("got %d hypotheses, want 2", len(scores))
+		}
+		for _, sc := range scores {
+			sc.score(2)
+		}
+		if sc := scores[0]; sc.FrameFormat != "8"+parity+"1" || sc.Matches != 2 || sc.Frames != 4 || sc.Confidence != 1 {
+			t.Errorf("parity %s: got %s, want 8%s1 with 2 matches of 4 frames, confidence 1", parity, sc.PrettyString(), parity)
+		}
+		if sc := scores[1]; sc.Matches != 0 || sc.Confidence != 0 {
+			t.Errorf("parity %s: got %s, want no matches", parity, sc.PrettyString())
+		}
+	}
+}
+
+func TestEvaluateCaptureIncremental(t *testing.T) {
+	req := []byte{0x02, 0x04, 0x00, 0x00, 0x00, 0x0A, 0x70, 0x3E}
+	rsp := []byte{0x02, 0x04, 0x14, 0x80, 0x03, 0x80, 0x03, 0x80, 0x01, 0x80, 0x01, 0x80, 0x01, 0x80, 0x03, 0x00, 0x37, 0x80, 0x03, 0x80, 0x03, 0x80, 0x03, 0x90, 0x1F}
+	conf := Config{Ports: []*logger.Config{{Port: "test"}}}
+	// a response split across reads, evaluated in between
+	dus := captureAt8N1("E", req, rsp[:10], rsp[10:], req, rsp, req)
+	whole := newCaptureEvaluator(conf, 9600, nil).evaluate([][]*logger.DataUnit{dus}, true)
+
+	e := newCaptureEvaluator(conf, 9600, nil)
+	var scores []*ScanScore
+	for n := 1; n <= len(dus); n++ {
+		scores = e.evaluate([][]*logger.DataUnit{dus[:n]}, true)
+	}
+	for i := range whole {
+		if *scores[i] != *whole[i] {
+			t.Errorf("got %s, want %s", scores[i].PrettyString(), whole[i].PrettyString())
+		}
+	}
+	if sc := scores[0]; sc.FrameFormat != "8E1" || sc.Matches != 2 || sc.Frames != 5 || sc.InvalidBytes != 0 {
+		t.Errorf("got %s, want 8E1 with 2 matches of 5 frames", sc.PrettyString())
+	}
+}
@@ -0,0 +1,102 @@
+package sniffer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/andreaaizza/sniffer/logger"
+)
+
+// ScanReport results of the scan of a candidate: the score of each configuration tried, best first
+type ScanReport struct {
+	Ports []string `json:"ports"`
+	// Estimates speeds ranked before scanning, if estimated
+	Estimates []SpeedEstimate `json:"estimates,omitempty"`
+	// Tried configurations, sorted by confidence
+	Tried []*ScanScore `json:"tried"`
+	// Best configuration, with at least a request->response/exception match. Nil if none.
+	Best *ScanScore `json:"best"`
+}
+
+// ScanScore how likely a configuration is, from data captured with it
+type ScanScore struct {
+	Speed       int    `json:"speed"`
+	FrameFormat string `json:"frameFormat"`
+	// Seconds data was captured for
+	Seconds float64 `json:"seconds"`
+
+	// Matches request->response/exception pairs
+	Matches int `json:"matches"`
+	// Exceptions pairs with an exception
+	Exceptions int `json:"exceptions"`
+	// Frames with valid CRC
+	Frames int `json:"frames"`
+	// Bytes captured
+	Bytes int `json:"bytes"`
+	// InvalidBytes bytes which did not build any frame
+	InvalidBytes int `json:"invalidBytes"`
+
+	// GarbageRatio share of InvalidBytes over Bytes
+	GarbageRatio float64 `json:"garbageRatio"`
+	// Confidence [0..1]: share of frames in a matched pair, times share of valid bytes, times share of
+	// MinMatches found
+	Confidence float64 `json:"confidence"`
+}
+
+// Config returns the configuration of the best score, nil if none
+func (r *ScanReport) Config() *Config {
+	if r.Best == nil {
+		return nil
+	}
+	c := &Config{}
+	for _, p := range r.Ports {
+		c.Ports = append(c.Ports, &logger.Config{Port: p, Baud: r.Best.Speed, FrameFormat: r.Best.FrameFormat})
+	}
+	return c
+}
+
+// add adds scores of configurations tried, and updates Best
+func (r *ScanReport) add(scores ...*ScanScore) {
+	r.Tried = append(r.Tried, scores...)
+	sort.SliceStable(r.Tried, func(i, j int) bool {
+		if r.Tried[i].Confidence != r.Tried[j].Confidence {
+			return r.Tried[i].Confidence > r.Tried[j].Confidence
+		}
+		return r.Tried[i].Matches > r.Tried[j].Matches
+	})
+	r.Best = nil
+	if len(r.Tried) > 0 && r.Tried[0].Matches > 0 {
+		r.Best = r.Tried[0]
+	}
+}
+
+// score calculates GarbageRatio and Confidence
+func (s *ScanScore) score(minMatches int) {
+	s.GarbageRatio, s.Confidence = 0, 0
+	if s.Bytes > 0 {
+		s.GarbageRatio = float64(s.InvalidBytes) / float64(s.Bytes)
+	}
+	if s.Frames > 0 && minMatches > 0 {
+		paired := math.Min(1, float64(2*s.Matches)/float64(s.Frames))
+		enough := math.Min(1, float64(s.Matches)/float64(minMatches))
+		s.Confidence = paired * (1 - s.GarbageRatio) * enough
+	}
+}
+
+// confident returns true if the score is enough to stop scanning
+func (s *ScanScore) confident(opts ScanOptions) bool {
+	return s.Matches >= opts.MinMatches && s.Confidence >= opts.MinConfidence
+}
+
+func (s *ScanScore) PrettyString() string {
+	return fmt.Sprintf("baud: %d, frame format: %s, matches: %d, exceptions: %d, frames: %d, garbage: %.1f%%, confidence: %.2f",
+		s.Speed, s.FrameFormat, s.Matches, s.Exceptions, s.Frames, 100*s.GarbageRatio, s.Confidence)
+}
+
+func (r *ScanReport) PrettyString() (str string) {
+	for _, s := range r.Tried {
+		str += s.PrettyString() + "\n"
+	}
+	return
+}
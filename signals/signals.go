@@ -1,6 +1,7 @@
 package signals
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -42,3 +43,22 @@ func Init() {
 		}
 	}()
 }
+
+// Context returns a context cancelled at SIGINT or SIGTERM, use instead of Init() to shut down gracefully
+func Context(parent context.Context) (ctx context.Context, cancel context.CancelFunc) {
+	ctx, cancel = context.WithCancel(parent)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			log.Print("Cought signal: ", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return
+}
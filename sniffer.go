@@ -1,57 +1,155 @@
 package sniffer
 
 import (
+	"context"
 	"fmt"
 	"log"
 	sync "sync"
 	"time"
 
+	"github.com/andreaaizza/sniffer/audit"
+	"github.com/andreaaizza/sniffer/cycle"
 	"github.com/andreaaizza/sniffer/dissector"
 	"github.com/andreaaizza/sniffer/logger"
-	"github.com/andreaaizza/sniffer/util"
+	"github.com/andreaaizza/sniffer/metrics"
+	"github.com/andreaaizza/sniffer/processimage"
+	"github.com/andreaaizza/sniffer/regmap"
 	"google.golang.org/protobuf/proto"
 )
 
 // ModbusFlushDataOlderThanSeconds APUs older than 5 seconds are to be flushed
 const ModbusFlushDataOlderThanSeconds uint = 5
 
-// Modbus data for scanning, most frequent first
-var ModbusSpeeds = []int{9600, 19200, 38400, 115200, 57600, 4800, 2400, 1200}
-
-func allModbusFrames() (frames []string) {
-	frames = make([]string, 0)
-	b := []string{"8", "7"}
-	p := []string{"N", "E", "O"}
-	s := []string{"1", "2", "15"}
-	for _, bb := range b {
-		for _, pp := range p {
-			for _, ss := range s {
-				frames = append(frames, bb+pp+ss)
-			}
-		}
-	}
-	return
+// Source what servers of sniffed traffic read, e.g. rpc and web, implemented by *Sniffer
+type Source interface {
+	OnResult(f func(*Result)) (remove func())
+	Metrics() *metrics.Metrics
+	ProcessImage() *processimage.ProcessImage
+	Ports() []*logger.Config
 }
 
 type Sniffer struct {
 	dissector []*dissector.Dissector
+	ports     []*logger.Config
 
-	Results Results
+	results Results
 	resMux  sync.Mutex
 
-	stop chan struct{}
+	metrics *metrics.Metrics
+	cycle   *cycle.Cycle
+	image   *processimage.ProcessImage
+	regmap  *regmap.Map
+	audit   audit.Writer
+
+	stream     stream
+	streamOnly bool
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	// failed is closed on the first failure, err
+	failed   chan struct{}
+	failOnce sync.Once
+	err      error
+}
+
+// Ports returns the configuration of the ports sniffed: requests and responses on the first, or requests on the first
+// and responses on the second if duplex
+func (s *Sniffer) Ports() []*logger.Config {
+	return s.ports
+}
+
+// PortRole returns the role of the i-th of n ports sniffed, see Ports: txrx if half-duplex, tx (requests) or rx
+// (responses) if duplex
+func PortRole(i, n int) string {
+	if n != 2 {
+		return "txrx"
+	}
+	return []string{"tx", "rx"}[i]
+}
+
+// Metrics returns bus statistics collected by the sniffer, use Metrics().Snapshot() to read them
+func (s *Sniffer) Metrics() *metrics.Metrics {
+	return s.metrics
+}
+
+// Cycle returns the polling cycle learned from matched requests, use Cycle().Report() to read it
+func (s *Sniffer) Cycle() *cycle.Cycle {
+	return s.cycle
+}
+
+// ProcessImage returns the shadow of coils, inputs and registers of every slave, from values read and written
+func (s *Sniffer) ProcessImage() *processimage.ProcessImage {
+	return s.image
 }
 
-// Close closes
+// Close stops all go routines, closes ports and the Results() channel. It can be called more than once.
 func (s *Sniffer) Close() {
-	// close dissector
-	for _, d := range s.dissector {
-		d.Close()
+	s.closeOnce.Do(func() {
+		// stop matching
+		close(s.stop)
+		s.wg.Wait()
+
+		// close dissector
+		for _, d := range s.dissector {
+			d.Close()
+		}
+
+		close(s.stream.results)
+	})
+}
+
+// Err returns the first failure, e.g. a serial adapter unplugged with reconnection disabled or an audit log which
+// cannot be written, nil if none. It does not wait: use Run to wait for it.
+func (s *Sniffer) Err() error {
+	select {
+	case <-s.failed:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Run blocks until ctx is done or the first failure, then closes the sniffer: on a failure the sniffer stops, also
+// on the other port if duplex. Returns nil if ctx is done, the failure otherwise.
+func (s *Sniffer) Run(ctx context.Context) error {
+	defer s.Close()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-s.failed:
+		return s.err
+	}
+}
+
+// fail reports a failure, only the first one is returned by Err and Run, later ones are logged
+func (s *Sniffer) fail(err error) {
+	first := false
+	s.failOnce.Do(func() {
+		first = true
+		s.err = err
+		close(s.failed)
+	})
+	if !first {
+		log.Print(err)
 	}
 }
 
 type Config struct {
 	Ports []*logger.Config
+
+	// ResultsBuffer size of the Results() channel, ResultsBufferDefault if 0
+	ResultsBuffer int
+	// ResultsPolicy what to do when the Results() channel is full
+	ResultsPolicy ResultsPolicy
+	// StreamOnly do not queue results for GetResultsAndFlush(), use when consuming Results() or OnResult()
+	StreamOnly bool
+	// RegisterMap decodes registers of results into named Values, if not nil
+	RegisterMap *regmap.Map
+	// AuditLog each write request, answered or not, is recorded to, if not nil
+	AuditLog audit.Writer
 }
 
 func (c *Config) PrettyString() (s string) {
@@ -62,25 +160,38 @@ func (c *Config) PrettyString() (s string) {
 }
 
 // NewModbusRTUSniffer creates and starts a sniffer for Modbus RTU
-// Process runs on go routine, which can be stopped with Sniffer.Close()
-// You need to secure main program does not exit e.g. for{select{}}
+// Process runs on go routine, which can be stopped with Sniffer.Close() or waited for with Sniffer.Run()
+// Results can be streamed with Results() or OnResult(), or polled with GetResultsAndFlush()
 // if 1 port is provided, then it sniffs half-duples
 // if 2 ports are provided, then is sniffs duplex (Requests on port[0] (tx), Responses/Exception on port[1] (rx)
 func NewModbusRTUSniffer(conf Config) (s *Sniffer, err error) {
 
 	if len(conf.Ports) == 0 || len(conf.Ports) > 2 {
-		log.Panic("Sniffer should have either 1 or 2 ports as input")
+		return nil, fmt.Errorf("sniffer should have either 1 or 2 ports as input, got %d", len(conf.Ports))
 	}
 	isDuplex := len(conf.Ports) == 2
 
 	// create sniffer
 	s = &Sniffer{
 		dissector: make([]*dissector.Dissector, 0),
+		ports:     conf.Ports,
+		metrics:   metrics.New(),
+		cycle:     cycle.New(),
+		image:     processimage.New(),
+		regmap:    conf.RegisterMap,
+		audit:     conf.AuditLog,
+
+		stream:     newStream(conf.ResultsBuffer, conf.ResultsPolicy),
+		streamOnly: conf.StreamOnly,
+
+		stop:   make(chan struct{}),
+		failed: make(chan struct{}),
 	}
 
-	// set logger flushing time
+	// set logger flushing time and statistics
 	for _, p := range conf.Ports {
 		p.FlushAfterSeconds = logger.LoggerFlushAfterSecondsModbusRTU
+		p.Metrics = s.metrics
 	}
 
 	// creates dissectors
@@ -96,6 +207,7 @@ func NewModbusRTUSniffer(conf Config) (s *Sniffer, err error) {
 		// port[1] is rx
 		rxDiss, err = dissector.New(conf.Ports[1], dissector.FilterOnlyModbusResponseOrException{})
 		if err != nil {
+			txDiss.Close()
 			return
 		}
 		s.dissector = append(s.dissector, txDiss)
@@ -111,50 +223,64 @@ func NewModbusRTUSniffer(conf Config) (s *Sniffer, err error) {
 		s.dissector = append(s.dissector, txrx)
 	}
 
+	for _, d := range s.dissector {
+		d.OnGarbage(s.publishGarbage)
+	}
+
 	// results buffers
-	rx := []dissector.Result{}
-	tx := []dissector.Result{}
+	rx := []*dissector.Result{}
+	tx := []*dissector.Result{}
 
+	s.wg.Add(1)
 	if isDuplex {
 		// DUPLEX
 		go func() {
+			defer s.wg.Done()
 			for {
 				select {
 				case <-s.stop:
 					return
 
-				// only TX (Requests)
+				case err := <-s.dissector[0].Err():
+					s.fail(err)
+				case err := <-s.dissector[1].Err():
+					s.fail(err)
+
+				// only TX (Requests), RX may have been read first
 				case r := <-s.dissector[0].Producer:
-					tx = append(tx, r)
+					s.publishFrame(r)
+					s.pushRequest(r, &tx)
+
+					s.findRxTxMatch(&rx, &tx, time.Now())
 
 				// only RX (Responses/Exceptions)
 				case r := <-s.dissector[1].Producer:
-					// fill queue
-					rx = append(rx, r)
-
-					s.findRxTxMatch(&rx, &tx)
+					s.publishFrame(r)
+					s.pushResponse(r, &rx, &tx, time.Now())
 				}
 			}
 		}()
 	} else {
 		// HALF DUPLEX
 		go func() {
+			defer s.wg.Done()
 			for {
 				select {
 				case <-s.stop:
 					return
 
+				case err := <-s.dissector[0].Err():
+					s.fail(err)
+
 				// both Requests and Responses/Exceptions
 				case r := <-s.dissector[0].Producer:
+					s.publishFrame(r)
 					adu := r.GetAdu()
 					if adu.IsRequest() {
-						tx = append(tx, r)
+						s.pushRequest(r, &tx)
 						break
 					} else if adu.IsException() || adu.IsResponse() {
-						rx = append(rx, r)
-
-						s.findRxTxMatch(&rx, &tx)
-
+						s.pushResponse(r, &rx, &tx, time.Now())
 						break
 					}
 					log.Printf("Unhandled adu received: %v", adu)
@@ -166,46 +292,128 @@ func NewModbusRTUSniffer(conf Config) (s *Sniffer, err error) {
 	return
 }
 
-func (s *Sniffer) findOneMatch(rx *[]dissector.Result, tx *[]dissector.Result) (found bool) {
-	// for each REQ in time ascending order
-	for ti := range *tx {
-		// find the nearest (in time) future REX/EXC
-		for ri := range *rx {
+// pushRequest queues a new request, accounts it in metrics and publishes it to request callbacks
+func (s *Sniffer) pushRequest(r *dissector.Result, tx *[]*dissector.Result) {
+	adu := r.GetAdu()
+	s.metrics.AddRequest(r.GetPort(), adu.GetAddress(), adu.GetPduRequest().GetFunctionCode())
+	*tx = append(*tx, r)
+	s.publishRequest(r)
+}
+
+// pushResponse queues a new response/exception and finds matching requests, now is the current time
+func (s *Sniffer) pushResponse(r *dissector.Result, rx *[]*dissector.Result, tx *[]*dissector.Result, now time.Time) {
+	*rx = append(*rx, r)
+	s.findRxTxMatch(rx, tx, now)
+}
+
+// addMatch accounts a matched request->response/exception in metrics, polling cycle, audit log and process image. Transactions are accounted on the request port.
+func (s *Sniffer) addMatch(res *Result) {
+	req := res.GetRequest().GetAdu()
+	rsp := res.GetResponse().GetAdu()
+	fc := req.GetPduRequest().GetFunctionCode()
+	if rsp.IsException() {
+		s.metrics.AddException(res.GetRequest().GetPort(), req.GetAddress(), fc,
+			rsp.GetPduResponseException().GetExceptionCode(), res.Latency())
+	} else {
+		s.metrics.AddResponse(res.GetRequest().GetPort(), req.GetAddress(), fc, res.Latency())
+	}
+	s.cycle.Add(cycle.Entry{
+		Address:      req.GetAddress(),
+		FunctionCode: fc,
+		Start:        req.GetPduRequest().StartAddress(),
+		Quantity:     req.GetPduRequest().Quantity(),
+	}, req.GetTimeTime(), res.Latency())
+	// old values are read before the image is updated
+	s.addAudit(res.GetRequest(), res.GetResponse())
+	s.image.Update(req, rsp)
+}
+
+// addTimeout accounts a request never answered
+func (s *Sniffer) addTimeout(r *dissector.Result) {
+	adu := r.GetAdu()
+	s.metrics.AddTimeout(r.GetPort(), adu.GetAddress(), adu.GetPduRequest().GetFunctionCode())
+	s.addAudit(r, nil)
+}
+
+// addAudit records a write request and its response (nil if none) to the audit log
+func (s *Sniffer) addAudit(req *dissector.Result, rsp *dissector.Result) {
+	if s.audit == nil {
+		return
+	}
+	if r := audit.NewRecord(req, rsp, s.image); r != nil {
+		if err := s.audit.Write(r); err != nil {
+			s.fail(fmt.Errorf("audit log: %w", err))
+		}
+	}
+}
+
+// matchRequest returns the index in tx of the request answered by response/exception rsp, -1 if none. It is the
+// latest request to the same slave, with the same function code, not read after rsp: a slave only answers the last
+// request, and bytes read together share the same time, so a request and its answer can have equal times.
+func matchRequest(rsp *dissector.ADU, tx []*dissector.Result) int {
+	rspTime := rsp.GetTimeTime()
+	match := -1
+	for ti, r := range tx {
+		req := r.GetAdu()
+		reqTime := req.GetTimeTime()
+		if !reqTime.After(rspTime) &&
+			req.GetAddress() == rsp.GetAddress() &&
+			((rsp.IsResponse() &&
+				rsp.GetPduResponse().GetFunctionCode() == req.GetPduRequest().GetFunctionCode()) ||
+				(rsp.IsException() &&
+					rsp.GetPduResponseException().GetFunctionExceptionCode()&0x7F == req.GetPduRequest().GetFunctionCode())) &&
+			(match < 0 || !reqTime.Before(tx[match].GetAdu().GetTimeTime())) {
+			match = ti
+		}
+	}
+	return match
+}
+
+// findOneMatch matches the first response/exception, in arrival order, answering a request. Older requests to the
+// same slave were never answered, and are accounted as timeouts.
+func (s *Sniffer) findOneMatch(rx *[]*dissector.Result, tx *[]*dissector.Result) (found bool) {
+	for ri := range *rx {
+		aduRx := (*rx)[ri].GetAdu()
+		match := matchRequest(aduRx, *tx)
+		if match < 0 {
+			// res (rx) has no matching req (tx)
+			continue
+		}
+
+		// match found
+		res := Result{Request: (*tx)[match], Response: (*rx)[ri]}
+		res.Values = s.regmap.DecodeADUs(res.GetRequest().GetAdu(), res.GetResponse().GetAdu())
+		s.addMatch(&res)
+		if !s.streamOnly {
+			s.resMux.Lock()
+			s.results.Results = append(s.results.Results, &res)
+			s.resMux.Unlock()
+		}
+		s.publish(&res)
+
+		// remove from rx, and from tx with older requests to the same slave
+		*rx = append((*rx)[:ri], (*rx)[ri+1:]...)
+		reqTime := res.GetRequest().GetAdu().GetTimeTime()
+		for ti := len(*tx) - 1; ti >= 0; ti-- {
 			aduTx := (*tx)[ti].GetAdu()
-			aduRx := (*rx)[ri].GetAdu()
-			aduTxTime := util.TimeBuilder(aduTx.GetTime())
-			aduRxTime := util.TimeBuilder(aduRx.GetTime())
-
-			if aduTxTime.Before(aduRxTime) &&
-				aduTx.GetAddress() == aduRx.GetAddress() &&
-				((aduRx.IsResponse() &&
-					aduRx.GetPduResponse().GetFunctionCode() == aduTx.GetPduRequest().GetFunctionCode()) ||
-					(aduRx.IsException() &&
-						aduRx.GetPduResponseException().GetFunctionExceptionCode()&0x7F == aduTx.GetPduRequest().GetFunctionCode())) {
-				// match found
-				res := Result{Request: &dissector.Result{Adu: aduTx}, Response: &dissector.Result{Adu: aduRx}}
-				s.resMux.Lock()
-				s.Results.Results = append(s.Results.Results, &res)
-				s.resMux.Unlock()
-
-				//log.Print("FOUND: ", res) //LOG
-
-				// remove from tx and rx
+			if ti == match {
+				*tx = append((*tx)[:ti], (*tx)[ti+1:]...)
+			} else if aduTx.GetAddress() == aduRx.GetAddress() && aduTx.GetTimeTime().Before(reqTime) {
+				s.addTimeout((*tx)[ti])
 				*tx = append((*tx)[:ti], (*tx)[ti+1:]...)
-				*rx = append((*rx)[:ri], (*rx)[ri+1:]...)
-				return true
 			}
 		}
-		// req (tx) has no matching res (rx)
+		return true
 	}
 	return false
 }
 
-func (s *Sniffer) findRxTxMatch(rx *[]dissector.Result, tx *[]dissector.Result) {
-	// flush old data first
-	now := time.Now()
+func (s *Sniffer) findRxTxMatch(rx *[]*dissector.Result, tx *[]*dissector.Result, now time.Time) {
+	// flush old data first, requests flushed never got an answer
 	flushOldData(rx, now)
-	flushOldData(tx, now)
+	for _, r := range flushOldData(tx, now) {
+		s.addTimeout(r)
+	}
 
 	// for each REQ find matching RES/EXC
 	for {
@@ -218,19 +426,21 @@ func (s *Sniffer) findRxTxMatch(rx *[]dissector.Result, tx *[]dissector.Result)
 // GetResults return results, and flushes
 func (s *Sniffer) GetResultsAndFlush() (res Results) {
 	s.resMux.Lock()
-	res = s.Results
+	res = Results{Results: s.results.Results}
 	s.flushResults()
 	s.resMux.Unlock()
 	return
 }
 
 func (s *Sniffer) GetResultsCount() int {
-	return len(s.Results.Results)
+	s.resMux.Lock()
+	defer s.resMux.Unlock()
+	return len(s.results.Results)
 }
 
 // FlushResults clear results queue
 func (s *Sniffer) flushResults() {
-	s.Results.Reset()
+	s.results.Reset()
 }
 
 // ProtoBytes extracts results as protobuf Marshalled bytes
@@ -238,7 +448,7 @@ func (s *Sniffer) ProtoBytesAndFlush() (b []byte, err error) {
 	s.resMux.Lock()
 	defer s.resMux.Unlock()
 
-	b, err = proto.Marshal(&s.Results)
+	b, err = proto.Marshal(&s.results)
 	if err != nil {
 		return
 	}
@@ -247,86 +457,25 @@ func (s *Sniffer) ProtoBytesAndFlush() (b []byte, err error) {
 }
 
 func (r *Result) PrettyString() string {
-	return fmt.Sprint(r.Request.PrettyString(), " -> ", r.Response.PrettyString())
-}
-
-// Scan for Modbus RTU valid serial port configuration
-// connect one 485 line to an active line with traffic to run this
-func ScanPort(conf Config, speed *int, frame *string, scanForSeconds int, debug bool) *Config {
-	port := []string{}
-	for _, c := range conf.Ports {
-		port = append(port, c.Port)
+	str := fmt.Sprint(r.Request.PrettyString(), " -> ", r.Response.PrettyString())
+	for _, v := range r.GetValues() {
+		str += " " + v.PrettyString()
 	}
-	configs := buildConfigs(port, speed, frame, debug)
-
-	for _, c := range configs {
-		// create sniffer and try finding results for limited time
-		err := tryConfig(c, scanForSeconds)
-		if err == nil {
-			return &c
-		} else {
-			if debug {
-				log.Print(err)
-			}
-		}
-
-	}
-	return nil
+	return str
 }
 
-// buildConfigs builds all possible configs with specific port and speed/frame combinations
-func buildConfigs(port []string, thisSpeed *int, thisFrame *string, debug bool) (confs []Config) {
-	confs = make([]Config, 0)
-	for _, speed := range ModbusSpeeds {
-		for _, frame := range allModbusFrames() {
-			if thisSpeed != nil && *thisSpeed != speed {
-				continue
-			}
-			if thisFrame != nil && *thisFrame != frame {
-				continue
-			}
-			conf := Config{}
-			for _, p := range port {
-				conf.Ports = append(conf.Ports, &logger.Config{Port: p, Baud: speed, FrameFormat: frame, FlushAfterSeconds: 0, Debug: debug})
-			}
-			confs = append(confs, conf)
-		}
-	}
-	return
+// Latency returns time elapsed between request and response/exception
+func (r *Result) Latency() time.Duration {
+	return r.GetResponse().GetAdu().GetTimeTime().Sub(r.GetRequest().GetAdu().GetTimeTime())
 }
 
-// tryConfig runs a sniffer with specific {config, seconds}, return nil if results are found or specific error
-func tryConfig(c Config, seconds int) (err error) {
-
-	log.Printf("Trying %s", c.PrettyString())
-
-	s, err := NewModbusRTUSniffer(c)
-	if err != nil {
-		return fmt.Errorf("Cannot create sniffer")
-	}
-	defer s.Close()
-
-	for {
-		select {
-		case <-time.After(time.Duration(seconds) * time.Second):
-			results := s.GetResultsAndFlush()
-
-			if len(results.GetResults()) > 0 {
-				return
-			} else {
-				return fmt.Errorf("No valid data recevied")
-			}
-		}
-	}
-}
-
-func flushOldData(r *[]dissector.Result, now time.Time) {
-	count := 0
+// flushOldData removes ADUs older than ModbusFlushDataOlderThanSeconds, returns flushed ones
+func flushOldData(r *[]*dissector.Result, now time.Time) (flushed []*dissector.Result) {
 	for i := len(*r) - 1; i >= 0; i-- {
-		if now.After((*r)[0].GetAdu().GetTimeTime().Add(time.Duration(ModbusFlushDataOlderThanSeconds) * time.Second)) {
+		if now.After((*r)[i].GetAdu().GetTimeTime().Add(time.Duration(ModbusFlushDataOlderThanSeconds) * time.Second)) {
+			flushed = append(flushed, (*r)[i])
 			*r = append((*r)[:i], (*r)[i+1:]...)
-			count++
 		}
 	}
-	log.Printf("Flushed %d ADUs from buffer", count)
+	return
 }
@@ -0,0 +1,223 @@
+package sniffer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/audit"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/logger"
+	"github.com/andreaaizza/sniffer/metrics"
+	"github.com/andreaaizza/sniffer/processimage"
+	"github.com/andreaaizza/sniffer/util"
+)
+
+func TestMatch(t *testing.T) {
+	var (
+		readA      = []byte{0x02, 0x03, 0x10, 0x00, 0x00, 0x02, 0xC0, 0xF8}
+		answerA    = []byte{0x02, 0x03, 0x04, 0x00, 0x01, 0x00, 0x02, 0x19, 0x32}
+		readB      = []byte{0x02, 0x04, 0x00, 0x00, 0x00, 0x02, 0x71, 0xF8}
+		exceptionB = []byte{0x02, 0x84, 0x02, 0x32, 0xC1}
+		readC      = []byte{0x03, 0x03, 0x10, 0x00, 0x00, 0x02, 0xC1, 0x29}
+		answerC    = []byte{0x03, 0x03, 0x04, 0x00, 0x07, 0x00, 0x08, 0x69, 0xF4}
+	)
+	type frame struct {
+		at   time.Duration
+		data []byte
+	}
+	tests := []struct {
+		name   string
+		frames []frame
+		// want matches as request-response indexes in frames
+		want     []string
+		timeouts uint64
+	}{
+		{"answered", []frame{{0, readA}, {20 * time.Millisecond, answerA}}, []string{"0-1"}, 0},
+		{"read together", []frame{{0, readA}, {0, answerA}}, []string{"0-1"}, 0},
+		{"exception", []frame{{0, readB}, {20 * time.Millisecond, exceptionB}}, []string{"0-1"}, 0},
+		{"latest request answered", []frame{{0, readA}, {100 * time.Millisecond, readA},
+			{120 * time.Millisecond, answerA}}, []string{"1-2"}, 1},
+		{"other slave", []frame{{0, readA}, {20 * time.Millisecond, answerC}}, nil, 0},
+		{"other function", []frame{{0, readA}, {20 * time.Millisecond, exceptionB}}, nil, 0},
+		{"answer before request", []frame{{0, answerA}, {20 * time.Millisecond, readA}}, nil, 0},
+		{"slaves interleaved", []frame{{0, readA}, {10 * time.Millisecond, readC}, {30 * time.Millisecond, answerC},
+			{40 * time.Millisecond, answerA}}, []string{"1-2", "0-3"}, 0},
+	}
+	t0 := time.Date(2020, 9, 14, 8, 45, 54, 0, time.UTC)
+	for _, tt := range tests {
+		s := &Sniffer{stream: newStream(len(tt.frames), ResultsDrop), stop: make(chan struct{}), metrics: metrics.New()}
+		index := make(map[*dissector.Result]int)
+		rx := []*dissector.Result{}
+		tx := []*dissector.Result{}
+		for i, f := range tt.frames {
+			// a request follows, so that exceptions are dissected
+			ts := util.TimestampBuilder(t0.Add(f.at))
+			results, _ := dissector.Dissect([]*logger.DataUnit{{Time: &ts, Data: f.data}, {Time: &ts, Data: readA}},
+				"/dev/ttyUSB0", dissector.FilterAnyModbus{})
+			r := results[0]
+			index[r] = i
+			if r.GetAdu().IsRequest() {
+				s.pushRequest(r, &tx)
+				s.findRxTxMatch(&rx, &tx, t0.Add(f.at))
+			} else {
+				s.pushResponse(r, &rx, &tx, t0.Add(f.at))
+			}
+		}
+
+		var got []string
+		for _, r := range s.GetResultsAndFlush().Results {
+			got = append(got, fmt.Sprintf("%d-%d", index[r.GetRequest()], index[r.GetResponse()]))
+		}
+		var timeouts uint64
+		for _, sl := range s.metrics.Snapshot().Slaves {
+			timeouts += sl.Timeouts
+		}
+		if !reflect.DeepEqual(got, tt.want) || timeouts != tt.timeouts {
+			t.Errorf("%s: got matches %v, %d timeouts, want %v, %d", tt.name, got, timeouts, tt.want, tt.timeouts)
+		}
+	}
+}
+
+// auditLog records written to the audit log
+type auditLog []*audit.Record
+
+func (l *auditLog) Write(r *audit.Record) error {
+	*l = append(*l, r)
+	return nil
+}
+
+func TestEchoReadTogether(t *testing.T) {
+	// a write and its echo read together, a request follows
+	write := []byte{0x02, 0x06, 0x00, 0x01, 0x12, 0x34, 0xD5, 0x4E}
+	readA := []byte{0x02, 0x03, 0x10, 0x00, 0x00, 0x02, 0xC0, 0xF8}
+	t0 := time.Date(2020, 9, 14, 8, 45, 54, 0, time.UTC)
+	ts := util.TimestampBuilder(t0)
+	data := append(append(append([]byte{}, write...), write...), readA...)
+	results, _ := dissector.Dissect([]*logger.DataUnit{{Time: &ts, Data: data}}, "/dev/ttyUSB0",
+		dissector.FilterAnyModbus{})
+	if len(results) != 3 {
+		t.Fatalf("got %d ADUs, want 3", len(results))
+	}
+
+	var log auditLog
+	s := &Sniffer{stream: newStream(1, ResultsDrop), stop: make(chan struct{}), metrics: metrics.New(),
+		image: processimage.New(), audit: &log}
+	var requests int
+	s.OnRequest(func(*dissector.Result) { requests++ })
+	rx := []*dissector.Result{}
+	tx := []*dissector.Result{}
+	for _, r := range results[:2] {
+		if r.GetAdu().IsRequest() {
+			s.pushRequest(r, &tx)
+			s.findRxTxMatch(&rx, &tx, t0)
+		} else {
+			s.pushResponse(r, &rx, &tx, t0)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("got %d requests, want the write only", requests)
+	}
+	if len(log) != 1 || log[0].Status != audit.StatusAcknowledged {
+		t.Fatalf("got audit log %v, want the write acknowledged", log)
+	}
+	for _, sl := range s.metrics.Snapshot().Slaves {
+		if sl.Timeouts != 0 {
+			t.Errorf("got %d timeouts, want none", sl.Timeouts)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := &Sniffer{stream: newStream(1, ResultsDrop), stop: make(chan struct{}), failed: make(chan struct{})}
+	if err := s.Err(); err != nil {
+		t.Errorf("got %v before any failure", err)
+	}
+	s.fail(fmt.Errorf("port failed"))
+	s.fail(fmt.Errorf("second failure"))
+	if err := s.Run(context.Background()); err == nil || err.Error() != "port failed" {
+		t.Errorf("got %v from Run, want the first failure", err)
+	}
+	if err := s.Err(); err == nil || err.Error() != "port failed" {
+		t.Errorf("got %v from Err after Run, want the first failure", err)
+	}
+}
+
+func TestResultsDrop(t *testing.T) {
+	s := &Sniffer{stream: newStream(2, ResultsDrop), stop: make(chan struct{})}
+	for i := 0; i < 5; i++ {
+		s.publish(&Result{})
+	}
+	if n := s.DroppedResults(); n != 3 {
+		t.Errorf("got %d results dropped, want 3", n)
+	}
+	s.Close()
+	n := 0
+	for range s.Results() {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("got %d results, want 2, then the channel closed", n)
+	}
+}
+
+func TestResultsBlock(t *testing.T) {
+	s := &Sniffer{stream: newStream(1, ResultsBlock), stop: make(chan struct{})}
+	published := make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.publish(&Result{})
+		s.publish(&Result{})
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("got the second result published with the channel full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by a full channel")
+	}
+	if n := s.DroppedResults(); n != 0 {
+		t.Errorf("got %d results dropped, want none when blocking", n)
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	s := &Sniffer{stream: newStream(1, ResultsDrop), stop: make(chan struct{})}
+	var got []string
+	var removeB func()
+	s.OnResult(func(*Result) {
+		got = append(got, "a")
+		// while publishing
+		removeB()
+	})
+	removeB = s.OnResult(func(*Result) { got = append(got, "b") })
+	s.OnResult(func(*Result) { got = append(got, "c") })
+	s.OnRequest(func(*dissector.Result) { got = append(got, "request") })
+	s.OnFrame(func(*dissector.Result) { got = append(got, "frame") })
+	s.OnGarbage(func(*dissector.Garbage) { got = append(got, "garbage") })
+
+	// b is removed from the next publish, the one in progress still calls the callbacks registered when it started
+	s.publish(&Result{})
+	s.publish(&Result{})
+	s.publishRequest(&dissector.Result{})
+	s.publishFrame(&dissector.Result{})
+	s.publishGarbage(&dissector.Garbage{})
+	want := []string{"a", "b", "c", "a", "c", "request", "frame", "garbage"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got callbacks %v, want %v", got, want)
+	}
+}
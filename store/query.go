@@ -0,0 +1,195 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"google.golang.org/protobuf/proto"
+)
+
+// Query selects rows, oldest first. Zero values select any.
+type Query struct {
+	// From, To time range, To excluded
+	From time.Time
+	To   time.Time
+	// Slaves, FunctionCodes do not apply to garbage
+	Slaves        []uint32
+	FunctionCodes []uint32
+	// Exceptions selects exceptions only, of results and frames
+	Exceptions bool
+	// Limit number of rows
+	Limit int
+}
+
+// where returns the SQL clauses of q, after WHERE, and their arguments. slaveFC tells if the table has slave and fc.
+func (q *Query) where(slaveFC bool, exception bool) (string, []interface{}) {
+	conds := []string{"1"}
+	var args []interface{}
+	if !q.From.IsZero() {
+		conds = append(conds, "time >= ?")
+		args = append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, "time < ?")
+		args = append(args, q.To.UnixNano())
+	}
+	in := func(column string, values []uint32) {
+		if len(values) == 0 {
+			return
+		}
+		conds = append(conds, column+" IN (?"+strings.Repeat(", ?", len(values)-1)+")")
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	if slaveFC {
+		in("slave", q.Slaves)
+		in("fc", q.FunctionCodes)
+	}
+	if exception && q.Exceptions {
+		conds = append(conds, "exception IS NOT NULL")
+	}
+	clauses := strings.Join(conds, " AND ") + " ORDER BY time, rowid"
+	if q.Limit > 0 {
+		clauses += " LIMIT " + strconv.Itoa(q.Limit)
+	}
+	return clauses, args
+}
+
+// each calls f with each row of query, until f returns an error, which is returned
+func (s *Store) each(query string, args []interface{}, f func(*sql.Rows) error) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := f(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Results calls f with the results selected by q, until f returns an error, which is returned. f must not use the
+// store.
+func (s *Store) Results(q Query, f func(*sniffer.Result) error) error {
+	where, args := q.where(true, true)
+	return s.each("SELECT result FROM results WHERE "+where, args, func(rows *sql.Rows) error {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return err
+		}
+		r := &sniffer.Result{}
+		if err := proto.Unmarshal(b, r); err != nil {
+			return err
+		}
+		return f(r)
+	})
+}
+
+// Frames calls f with the ADUs selected by q, until f returns an error, which is returned. f must not use the store.
+func (s *Store) Frames(q Query, f func(*dissector.Result) error) error {
+	where, args := q.where(true, true)
+	return s.each("SELECT frame FROM frames WHERE "+where, args, func(rows *sql.Rows) error {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return err
+		}
+		r := &dissector.Result{}
+		if err := proto.Unmarshal(b, r); err != nil {
+			return err
+		}
+		return f(r)
+	})
+}
+
+// Garbage calls f with the runs of bytes selected by q, until f returns an error, which is returned. f must not use
+// the store.
+func (s *Store) Garbage(q Query, f func(*dissector.Garbage) error) error {
+	where, args := q.where(false, false)
+	return s.each("SELECT time, port, data FROM garbage WHERE "+where, args, func(rows *sql.Rows) error {
+		var t int64
+		g := &dissector.Garbage{}
+		if err := rows.Scan(&t, &g.Port, &g.Data); err != nil {
+			return err
+		}
+		g.Time = time.Unix(0, t)
+		return f(g)
+	})
+}
+
+// Alerts calls f with the alerts selected by q, until f returns an error, which is returned. f must not use the store.
+func (s *Store) Alerts(q Query, f func(*Alert) error) error {
+	where, args := q.where(true, false)
+	return s.each("SELECT time, port, slave, fc, source, name, severity, description FROM alerts WHERE "+where, args,
+		func(rows *sql.Rows) error {
+			var t int64
+			a := &Alert{}
+			if err := rows.Scan(&t, &a.Port, &a.Slave, &a.FunctionCode, &a.Source, &a.Name, &a.Severity,
+				&a.Description); err != nil {
+				return err
+			}
+			a.Time = time.Unix(0, t)
+			return f(a)
+		})
+}
+
+// timeLayouts of ParseTime, in local time
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// ParseTime parses s as: an RFC3339 time; a local date and time "2006-01-02 15:04:05", "2006-01-02 15:04" or
+// "2006-01-02"; "now"; "today" or "yesterday", optionally followed by a time "15:04[:05]"; a time of today "15:04[:05]";
+// a negative duration from now, e.g. "-2h30m"
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if strings.HasPrefix(s, "-") {
+		if d, err := time.ParseDuration(s); err == nil {
+			return now.Add(d), nil
+		}
+	}
+	if s == "now" {
+		return now, nil
+	}
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty time")
+	}
+
+	day := now
+	fields := strings.Fields(s)
+	switch {
+	case fields[0] == "today":
+		fields = fields[1:]
+	case fields[0] == "yesterday":
+		day = now.AddDate(0, 0, -1)
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, now.Location()), nil
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, fields[0]); err == nil && len(fields) == 1 {
+			return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, now.Location()), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
@@ -0,0 +1,346 @@
+// Package store keeps frames, results, garbage and alerts in an SQLite database, so they can be queried long after
+// they were sniffed
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/baseline"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/ids"
+	"google.golang.org/protobuf/proto"
+
+	// pure Go SQLite driver, no cgo
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// QueueSizeDefault rows waiting to be written, beyond which new ones are dropped
+	QueueSizeDefault = 10000
+	// BatchSizeDefault rows written in a single transaction
+	BatchSizeDefault = 1000
+	// busyTimeoutMs waits for other processes, e.g. a query, to release the database
+	busyTimeoutMs = 5000
+	// pruneInterval of rows older than MaxAge
+	pruneInterval = time.Hour
+)
+
+// Frame kinds
+const (
+	KindRequest   = "request"
+	KindResponse  = "response"
+	KindException = "exception"
+)
+
+// Times are unix nanoseconds. Results are at the time of the request. fc of exceptions is the function code
+// requested, without the exception bit. Frames and results are protobuf of dissector.Result and sniffer.Result.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS frames (
+		time INTEGER NOT NULL,
+		port TEXT NOT NULL,
+		slave INTEGER NOT NULL,
+		fc INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		exception INTEGER,
+		frame BLOB NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS frames_time ON frames(time)`,
+	`CREATE INDEX IF NOT EXISTS frames_slave ON frames(slave, time)`,
+	`CREATE INDEX IF NOT EXISTS frames_fc ON frames(fc, time)`,
+	`CREATE TABLE IF NOT EXISTS results (
+		time INTEGER NOT NULL,
+		port TEXT NOT NULL,
+		slave INTEGER NOT NULL,
+		fc INTEGER NOT NULL,
+		start INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		latency REAL NOT NULL,
+		exception INTEGER,
+		result BLOB NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS results_time ON results(time)`,
+	`CREATE INDEX IF NOT EXISTS results_slave ON results(slave, time)`,
+	`CREATE INDEX IF NOT EXISTS results_fc ON results(fc, time)`,
+	`CREATE TABLE IF NOT EXISTS garbage (
+		time INTEGER NOT NULL,
+		port TEXT NOT NULL,
+		data BLOB NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS garbage_time ON garbage(time)`,
+	`CREATE TABLE IF NOT EXISTS alerts (
+		time INTEGER NOT NULL,
+		port TEXT NOT NULL,
+		slave INTEGER NOT NULL,
+		fc INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		name TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		description TEXT NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS alerts_time ON alerts(time)`,
+	`CREATE INDEX IF NOT EXISTS alerts_slave ON alerts(slave, time)`,
+	`CREATE INDEX IF NOT EXISTS alerts_fc ON alerts(fc, time)`,
+}
+
+// Tables names of the tables, as accepted by Query
+var Tables = []string{"results", "frames", "garbage", "alerts"}
+
+// Alert an intrusion detection alert or a baseline anomaly
+type Alert struct {
+	Time         time.Time `json:"time"`
+	Port         string    `json:"port"`
+	Slave        uint32    `json:"slave"`
+	FunctionCode uint32    `json:"functionCode"`
+	// Source ids or baseline
+	Source string `json:"source"`
+	// Name rule of ids alerts, kind of baseline anomalies
+	Name        string `json:"name"`
+	Severity    string `json:"severity,omitempty"`
+	Description string `json:"description"`
+}
+
+func (a *Alert) PrettyString() string {
+	return fmt.Sprintf("ALERT %s %s [%s] %02X FC%d %s: %s", a.Source, a.Severity, a.Time.Format(time.RFC3339Nano),
+		a.Slave, a.FunctionCode, a.Name, a.Description)
+}
+
+// NewIDSAlert creates the alert of an intrusion detection alert
+func NewIDSAlert(a *ids.Alert) *Alert {
+	description := a.Request
+	if a.Description != "" {
+		description = a.Description + ": " + a.Request
+	}
+	return &Alert{Time: a.Time, Port: a.Port, Slave: a.Slave, FunctionCode: a.FunctionCode, Source: "ids",
+		Name: a.Rule, Severity: a.Severity, Description: description}
+}
+
+// NewAnomalyAlert creates the alert of a baseline anomaly
+func NewAnomalyAlert(a *baseline.Anomaly) *Alert {
+	return &Alert{Time: a.Time, Port: a.Port, Slave: a.Slave, FunctionCode: a.FunctionCode, Source: "baseline",
+		Name: a.Kind, Description: fmt.Sprintf("%d+%d: %s", a.Start, a.Quantity, a.Description)}
+}
+
+// Options of a Store. Zero values are replaced by defaults.
+type Options struct {
+	// MaxAge rows older than this are deleted, kept forever if 0
+	MaxAge time.Duration
+	// QueueSize, BatchSize see the defaults
+	QueueSize int
+	BatchSize int
+}
+
+// Store writes rows in the background, in batches, and queries them. All methods are safe for concurrent use.
+type Store struct {
+	db   *sql.DB
+	opts Options
+
+	mux     sync.Mutex
+	closed  bool
+	queue   chan interface{}
+	done    chan struct{}
+	dropped uint64
+}
+
+// Open opens the database at path, creating it if needed
+func Open(path string, opts Options) (*Store, error) {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = QueueSizeDefault
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = BatchSizeDefault
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// pragmas are per connection: keep one
+	db.SetMaxOpenConns(1)
+	pragmas := []string{
+		fmt.Sprintf("PRAGMA busy_timeout = %d", busyTimeoutMs),
+		// readers, e.g. queries, do not block the writer
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA synchronous = NORMAL",
+	}
+	for _, q := range append(pragmas, schema...) {
+		if _, err := db.Exec(q); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	s := &Store{
+		db:    db,
+		opts:  opts,
+		queue: make(chan interface{}, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// AddResult queues r. Use as Sniffer.OnResult() callback.
+func (s *Store) AddResult(r *sniffer.Result) {
+	s.add(r)
+}
+
+// AddFrame queues an ADU. Use as Sniffer.OnFrame() callback.
+func (s *Store) AddFrame(r *dissector.Result) {
+	s.add(r)
+}
+
+// AddGarbage queues a run of bytes which did not build any ADU. Use as Sniffer.OnGarbage() callback.
+func (s *Store) AddGarbage(g *dissector.Garbage) {
+	s.add(g)
+}
+
+// AddAlert queues an alert
+func (s *Store) AddAlert(a *Alert) {
+	s.add(a)
+}
+
+func (s *Store) add(row interface{}) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- row:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// Dropped returns the number of rows dropped because the queue was full or they could not be written
+func (s *Store) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close writes the rows queued, then closes the database
+func (s *Store) Close() error {
+	s.mux.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mux.Unlock()
+	<-s.done
+	return s.db.Close()
+}
+
+// run writes rows queued, as many as available in a transaction, and prunes old ones
+func (s *Store) run() {
+	defer close(s.done)
+	s.prune()
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		var batch []interface{}
+		select {
+		case row, ok := <-s.queue:
+			if !ok {
+				return
+			}
+			batch = append(batch, row)
+		case <-ticker.C:
+			s.prune()
+			continue
+		}
+	fill:
+		for len(batch) < s.opts.BatchSize {
+			select {
+			case row, ok := <-s.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, row)
+			default:
+				break fill
+			}
+		}
+		if err := s.write(batch); err != nil {
+			log.Printf("store: %v", err)
+			atomic.AddUint64(&s.dropped, uint64(len(batch)))
+		}
+	}
+}
+
+// write inserts rows in a transaction
+func (s *Store) write(rows []interface{}) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := insert(tx, row); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func insert(tx *sql.Tx, row interface{}) error {
+	switch x := row.(type) {
+	case *sniffer.Result:
+		b, err := proto.Marshal(x)
+		if err != nil {
+			return err
+		}
+		req, rsp := x.GetRequest().GetAdu(), x.GetResponse().GetAdu()
+		pdu := req.GetPduRequest()
+		var exception interface{}
+		if e := rsp.GetPduResponseException(); e != nil {
+			exception = e.GetExceptionCode()
+		}
+		_, err = tx.Exec(`INSERT INTO results (time, port, slave, fc, start, quantity, latency, exception, result)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			req.GetTimeTime().UnixNano(), x.GetRequest().GetPort(), req.GetAddress(), pdu.GetFunctionCode(),
+			pdu.StartAddress(), pdu.Quantity(), x.Latency().Seconds(), exception, b)
+		return err
+
+	case *dissector.Result:
+		b, err := proto.Marshal(x)
+		if err != nil {
+			return err
+		}
+		adu := x.GetAdu()
+		kind, fc := KindRequest, adu.GetPduRequest().GetFunctionCode()
+		var exception interface{}
+		switch {
+		case adu.GetPduResponse() != nil:
+			kind, fc = KindResponse, adu.GetPduResponse().GetFunctionCode()
+		case adu.GetPduResponseException() != nil:
+			e := adu.GetPduResponseException()
+			kind, fc, exception = KindException, e.GetFunctionExceptionCode()&^0x80, e.GetExceptionCode()
+		}
+		_, err = tx.Exec(`INSERT INTO frames (time, port, slave, fc, kind, exception, frame) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			adu.GetTimeTime().UnixNano(), x.GetPort(), adu.GetAddress(), fc, kind, exception, b)
+		return err
+
+	case *dissector.Garbage:
+		_, err := tx.Exec(`INSERT INTO garbage (time, port, data) VALUES (?, ?, ?)`, x.Time.UnixNano(), x.Port, x.Data)
+		return err
+
+	case *Alert:
+		_, err := tx.Exec(`INSERT INTO alerts (time, port, slave, fc, source, name, severity, description)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			x.Time.UnixNano(), x.Port, x.Slave, x.FunctionCode, x.Source, x.Name, x.Severity, x.Description)
+		return err
+	}
+	return fmt.Errorf("cannot store %T", row)
+}
+
+// prune deletes rows older than MaxAge
+func (s *Store) prune() {
+	if s.opts.MaxAge <= 0 {
+		return
+	}
+	before := time.Now().Add(-s.opts.MaxAge).UnixNano()
+	for _, table := range Tables {
+		if _, err := s.db.Exec("DELETE FROM "+table+" WHERE time < ?", before); err != nil {
+			log.Printf("store: pruning %s: %v", table, err)
+		}
+	}
+}
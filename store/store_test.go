@@ -0,0 +1,140 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+)
+
+var t0 = sniffertest.T0
+
+// testFrames returns a read of slave 2 answered, a read of slave 2 answered with an exception, and a trailing request
+func testFrames(t *testing.T) []*dissector.Result {
+	return sniffertest.Dissect(t, "/dev/ttyUSB0", sniffertest.Every(time.Second, sniffertest.ReadHolding,
+		sniffertest.ReadHoldingResponse, sniffertest.ReadInput, sniffertest.ReadInputException, sniffertest.ReadInput))
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.db")
+	s, err := Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adus := testFrames(t)
+	for _, a := range adus {
+		s.AddFrame(a)
+	}
+	s.AddResult(&sniffer.Result{Request: adus[0], Response: adus[1]})
+	s.AddResult(&sniffer.Result{Request: adus[2], Response: adus[3]})
+	s.AddGarbage(&dissector.Garbage{Port: "/dev/ttyUSB0", Time: t0, Data: []byte{0xFF, 0x00}})
+	s.AddAlert(&Alert{Time: t0.Add(2 * time.Second), Port: "/dev/ttyUSB0", Slave: 2, FunctionCode: 4, Source: "ids",
+		Name: "no-input-registers", Severity: "high"})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopened
+	s, err = Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tc := range []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"all", Query{}, []string{"02 03 0002 1000", "02 84 02"}},
+		{"exceptions", Query{Exceptions: true, Slaves: []uint32{2}}, []string{"02 84 02"}},
+		{"function code", Query{FunctionCodes: []uint32{4}}, []string{"02 84 02"}},
+		{"other slave", Query{Slaves: []uint32{7}}, nil},
+		{"time", Query{From: t0.Add(time.Second), To: t0.Add(3 * time.Second)}, []string{"02 84 02"}},
+		{"limit", Query{Limit: 1}, []string{"02 03 0002 1000"}},
+	} {
+		var got []string
+		err := s.Results(tc.q, func(r *sniffer.Result) error {
+			rsp := r.GetResponse().GetAdu()
+			if e := rsp.GetPduResponseException(); e != nil {
+				got = append(got, "02 84 02")
+			} else {
+				pdu := r.GetRequest().GetAdu().GetPduRequest()
+				got = append(got, "02 03 0002 1000")
+				if pdu.Quantity() != 2 || pdu.StartAddress() != 0x1000 {
+					t.Errorf("%s: got request %s", tc.name, r.PrettyString())
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+			}
+		}
+	}
+
+	var frames []*dissector.Result
+	s.Frames(Query{FunctionCodes: []uint32{4}}, func(r *dissector.Result) error {
+		frames = append(frames, r)
+		return nil
+	})
+	if len(frames) != 3 || !frames[1].GetAdu().IsException() || !frames[1].GetAdu().GetTimeTime().Equal(t0.Add(3*time.Second)) {
+		t.Errorf("got frames %v", frames)
+	}
+
+	var garbage []*dissector.Garbage
+	s.Garbage(Query{}, func(g *dissector.Garbage) error {
+		garbage = append(garbage, g)
+		return nil
+	})
+	if len(garbage) != 1 || !garbage[0].Time.Equal(t0) || len(garbage[0].Data) != 2 || garbage[0].Data[0] != 0xFF {
+		t.Errorf("got garbage %v", garbage)
+	}
+
+	var alerts []*Alert
+	s.Alerts(Query{Slaves: []uint32{2}}, func(a *Alert) error {
+		alerts = append(alerts, a)
+		return nil
+	})
+	if len(alerts) != 1 || alerts[0].Name != "no-input-registers" || !alerts[0].Time.Equal(t0.Add(2*time.Second)) {
+		t.Errorf("got alerts %v", alerts)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	loc := time.FixedZone("CET", 3600)
+	now := time.Date(2020, 9, 14, 8, 45, 54, 0, loc)
+	for s, want := range map[string]time.Time{
+		"2020-09-13T14:00:00Z": time.Date(2020, 9, 13, 14, 0, 0, 0, time.UTC),
+		"2020-09-13 14:00":     time.Date(2020, 9, 13, 14, 0, 0, 0, loc),
+		"2020-09-13 14:00:30":  time.Date(2020, 9, 13, 14, 0, 30, 0, loc),
+		"2020-09-13":           time.Date(2020, 9, 13, 0, 0, 0, 0, loc),
+		"yesterday 14:00":      time.Date(2020, 9, 13, 14, 0, 0, 0, loc),
+		"yesterday":            time.Date(2020, 9, 13, 0, 0, 0, 0, loc),
+		"today 08:00:05":       time.Date(2020, 9, 14, 8, 0, 5, 0, loc),
+		"15:00":                time.Date(2020, 9, 14, 15, 0, 0, 0, loc),
+		"-1h30m":               now.Add(-90 * time.Minute),
+		"now":                  now,
+	} {
+		got, err := ParseTime(s, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("%q: got %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "tomorrow", "yesterday 14:00 15:00", "25:00", "1h"} {
+		if _, err := ParseTime(s, now); err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package sniffer
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/andreaaizza/sniffer/dissector"
+)
+
+// ResultsBufferDefault default size of the Results() channel
+const ResultsBufferDefault = 256
+
+// ResultsPolicy tells what to do with a new Result when the Results() channel is full
+type ResultsPolicy int
+
+const (
+	// ResultsDrop drops the new Result, see DroppedResults()
+	ResultsDrop ResultsPolicy = iota
+	// ResultsBlock blocks the sniffer until the channel is read. Data might be lost on the serial side instead.
+	ResultsBlock
+)
+
+type stream struct {
+	results chan *Result
+	policy  ResultsPolicy
+	dropped uint64
+
+	resultCallbacks  callbackList
+	requestCallbacks callbackList
+	frameCallbacks   callbackList
+	garbageCallbacks callbackList
+}
+
+type callback struct {
+	f func(*Result)
+}
+
+type requestCallback struct {
+	f func(*dissector.Result)
+}
+
+type frameCallback struct {
+	f func(*dissector.Result)
+}
+
+type garbageCallback struct {
+	f func(*dissector.Garbage)
+}
+
+// callbackList callbacks of one kind, pointers to callback, requestCallback, frameCallback or garbageCallback
+type callbackList struct {
+	mux sync.Mutex
+	cbs []interface{}
+}
+
+// add registers cb, returns the function unregistering it
+func (l *callbackList) add(cb interface{}) (remove func()) {
+	l.mux.Lock()
+	l.cbs = append(l.cbs, cb)
+	l.mux.Unlock()
+
+	return func() {
+		l.mux.Lock()
+		defer l.mux.Unlock()
+		for i, c := range l.cbs {
+			if c == cb {
+				// copy, as publishers may be ranging over the old slice
+				l.cbs = append(l.cbs[:i:i], l.cbs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// get returns callbacks in order of registration
+func (l *callbackList) get() []interface{} {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.cbs
+}
+
+func newStream(size int, policy ResultsPolicy) stream {
+	if size <= 0 {
+		size = ResultsBufferDefault
+	}
+	return stream{
+		results: make(chan *Result, size),
+		policy:  policy,
+	}
+}
+
+// Results returns the channel each Result is sent to as soon as the request->response/exception match is found.
+// The channel is closed by Close().
+func (s *Sniffer) Results() <-chan *Result {
+	return s.stream.results
+}
+
+// OnResult registers f to be called with each new Result. Callbacks are called in order of registration,
+// on the sniffer go routine, so they should not block. Call remove to unregister.
+func (s *Sniffer) OnResult(f func(*Result)) (remove func()) {
+	return s.stream.resultCallbacks.add(&callback{f: f})
+}
+
+// OnRequest registers f to be called with each request as soon as it is read, answered or not. Callbacks are
+// called in order of registration, on the sniffer go routine, so they should not block. Call remove to unregister.
+func (s *Sniffer) OnRequest(f func(*dissector.Result)) (remove func()) {
+	return s.stream.requestCallbacks.add(&requestCallback{f: f})
+}
+
+// OnFrame registers f to be called with each ADU as soon as it is read: requests, responses and exceptions, matched
+// or not. Callbacks are called in order of registration, on the sniffer go routine, so they should not block. Call
+// remove to unregister.
+func (s *Sniffer) OnFrame(f func(*dissector.Result)) (remove func()) {
+	return s.stream.frameCallbacks.add(&frameCallback{f: f})
+}
+
+// OnGarbage registers f to be called with each run of bytes which did not build any ADU. Callbacks are called in
+// order of registration, on the go routine of the port, so they should not block. Call remove to unregister.
+func (s *Sniffer) OnGarbage(f func(*dissector.Garbage)) (remove func()) {
+	return s.stream.garbageCallbacks.add(&garbageCallback{f: f})
+}
+
+// DroppedResults returns the number of Results dropped because Results() channel was full
+func (s *Sniffer) DroppedResults() uint64 {
+	return atomic.LoadUint64(&s.stream.dropped)
+}
+
+// publishRequest sends a request to request callbacks
+func (s *Sniffer) publishRequest(r *dissector.Result) {
+	for _, cb := range s.stream.requestCallbacks.get() {
+		cb.(*requestCallback).f(r)
+	}
+}
+
+// publishFrame sends an ADU to frame callbacks
+func (s *Sniffer) publishFrame(r *dissector.Result) {
+	for _, cb := range s.stream.frameCallbacks.get() {
+		cb.(*frameCallback).f(r)
+	}
+}
+
+// publishGarbage sends a run of bytes which did not build any ADU to garbage callbacks
+func (s *Sniffer) publishGarbage(g *dissector.Garbage) {
+	for _, cb := range s.stream.garbageCallbacks.get() {
+		cb.(*garbageCallback).f(g)
+	}
+}
+
+// publish sends res to callbacks and Results() channel
+func (s *Sniffer) publish(res *Result) {
+	for _, cb := range s.stream.resultCallbacks.get() {
+		cb.(*callback).f(res)
+	}
+
+	if s.stream.policy == ResultsBlock {
+		select {
+		case s.stream.results <- res:
+		case <-s.stop:
+		}
+		return
+	}
+	select {
+	case s.stream.results <- res:
+	default:
+		atomic.AddUint64(&s.stream.dropped, 1)
+	}
+}
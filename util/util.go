@@ -10,6 +10,11 @@ func TimeBuilder(timestamp *timestamp.Timestamp) time.Time {
 	return time.Unix(timestamp.GetSeconds(), int64(timestamp.GetNanos()))
 }
 
+// Seconds returns s seconds as a duration, rounded to milliseconds for printing
+func Seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
+
 func TimestampBuilder(time time.Time) timestamp.Timestamp {
 	return timestamp.Timestamp{
 		Seconds: time.Unix(),
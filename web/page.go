@@ -0,0 +1,108 @@
+package web
+
+// page the live view: bus statistics and a scrolling table of results from /api/ws. Kept in a string, not embedded,
+// to build with Go 1.15.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Modbus sniffer</title>
+<style>
+body { font-family: sans-serif; margin: 0; font-size: 14px; }
+header { position: sticky; top: 0; background: #263238; color: #fff; padding: 6px 8px; }
+header input { width: 100%; box-sizing: border-box; margin-top: 4px; font-size: 14px; }
+header button { font-size: 14px; margin-top: 4px; }
+#stats { font-size: 12px; opacity: 0.8; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: 2px 6px; border-bottom: 1px solid #ddd; text-align: left; white-space: nowrap; }
+th { background: #eceff1; position: sticky; top: 0; }
+td.values { white-space: normal; }
+tr.exception { background: #ffebee; }
+#error { color: #ff8a80; }
+</style>
+</head>
+<body>
+<header>
+<div><b>Modbus sniffer</b> <span id="ports"></span> <span id="status"></span> <span id="error"></span></div>
+<div id="stats"></div>
+<input id="filter" placeholder="display filter, e.g. slave == 2 &amp;&amp; exception" autocapitalize="off" autocorrect="off">
+<button id="pause">Pause</button> <button id="clear">Clear</button>
+</header>
+<table>
+<thead><tr><th>Time</th><th>Slave</th><th>FC</th><th>Start</th><th>Qty</th><th>Status</th><th>Latency</th><th>Values</th></tr></thead>
+<tbody id="results"></tbody>
+</table>
+<script>
+var maxRows = 500, paused = false, ws = null;
+var rows = document.getElementById("results");
+
+function text(s) { return String(s).replace(/[&<>"]/g, function (c) { return "&#" + c.charCodeAt(0) + ";"; }); }
+
+function addRow(r) {
+	var t = r.request && r.request.adu ? new Date(r.request.adu.time) : null;
+	var status = r.status == "exception" ? "exception " + r.exceptionCode : r.status;
+	var values = (r.values || []).map(function (v) {
+		return text((v.device ? v.device + "." : "") + (v.name || "") + "=" + (v.text || (v.number || 0) + (v.unit || "")));
+	}).join(" ");
+	var tr = document.createElement("tr");
+	if (r.status == "exception") tr.className = "exception";
+	tr.innerHTML = "<td>" + (t ? text(t.toLocaleTimeString() + "." + String(t.getMilliseconds()).padStart(3, "0")) : "") +
+		"</td><td>" + r.slave + "</td><td>" + r.functionCode + "</td><td>" + r.start + "</td><td>" + r.quantity +
+		"</td><td>" + text(status) + "</td><td>" + (parseFloat(r.latency) * 1000).toFixed(1) + " ms</td><td class=values>" +
+		values + "</td>";
+	rows.insertBefore(tr, rows.firstChild);
+	while (rows.childNodes.length > maxRows) rows.removeChild(rows.lastChild);
+}
+
+function connect() {
+	if (ws) { ws.onclose = null; ws.close(); }
+	var f = document.getElementById("filter").value;
+	var url = (location.protocol == "https:" ? "wss://" : "ws://") + location.host + "/api/ws" +
+		(f ? "?filter=" + encodeURIComponent(f) : "");
+	fetch("/api/results?limit=" + maxRows + (f ? "&filter=" + encodeURIComponent(f) : "")).then(function (rsp) {
+		if (!rsp.ok) return rsp.text().then(function (e) { throw e; });
+		return rsp.json();
+	}).then(function (records) {
+		document.getElementById("error").textContent = "";
+		rows.innerHTML = "";
+		records.forEach(addRow);
+		ws = new WebSocket(url);
+		ws.onopen = function () { document.getElementById("status").textContent = "live"; };
+		ws.onmessage = function (e) { if (!paused) addRow(JSON.parse(e.data)); };
+		ws.onclose = function () {
+			document.getElementById("status").textContent = "disconnected";
+			setTimeout(connect, 3000);
+		};
+	}).catch(function (e) {
+		document.getElementById("error").textContent = e;
+	});
+}
+
+function stats() {
+	fetch("/api/stats").then(function (rsp) { return rsp.json(); }).then(function (s) {
+		document.getElementById("stats").textContent = (s.ports || []).map(function (p) {
+			return p.port + ": " + p.framesPerSecond.toFixed(1) + " frames/s, " + p.utilisation.toFixed(1) +
+				"% busy, " + p.invalidFrames + " invalid" + (p.connected ? "" : ", disconnected");
+		}).join(" | ");
+	}).catch(function () {});
+}
+
+fetch("/api/config").then(function (rsp) { return rsp.json(); }).then(function (c) {
+	document.getElementById("ports").textContent = c.ports.map(function (p) {
+		return p.name + " " + p.baud + " " + p.frameFormat;
+	}).join(", ");
+});
+document.getElementById("filter").addEventListener("change", connect);
+document.getElementById("pause").onclick = function () {
+	paused = !paused;
+	this.textContent = paused ? "Resume" : "Pause";
+};
+document.getElementById("clear").onclick = function () { rows.innerHTML = ""; };
+connect();
+stats();
+setInterval(stats, 5000);
+</script>
+</body>
+</html>
+`
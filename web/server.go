@@ -0,0 +1,316 @@
+// Package web serves a live view of the bus over HTTP: a web page, a REST API and a WebSocket feed of results
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andreaaizza/sniffer"
+	"github.com/andreaaizza/sniffer/dissector"
+	"github.com/andreaaizza/sniffer/filter"
+	"github.com/andreaaizza/sniffer/output"
+	"github.com/andreaaizza/sniffer/processimage"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// RecentDefault results kept for /api/results
+	RecentDefault = 1000
+	// ClientBufferDefault results waiting to be sent to a WebSocket client, beyond which new ones are dropped for it
+	ClientBufferDefault = 256
+
+	writeTimeout = 10 * time.Second
+	pingInterval = 30 * time.Second
+)
+
+// Options of a Server. Zero values are replaced by defaults.
+type Options struct {
+	// Config served as JSON by /api/config, along with the ports, e.g. command line flags
+	Config interface{}
+	// Recent see the default
+	Recent int
+}
+
+// Port a port sniffed, as JSON
+type Port struct {
+	Name        string `json:"name"`
+	Baud        int    `json:"baud"`
+	FrameFormat string `json:"frameFormat"`
+	// Role txrx if half-duplex, tx (requests) or rx (responses) if duplex
+	Role string `json:"role"`
+}
+
+type client struct {
+	filter  *filter.Filter
+	records chan []byte
+}
+
+// Server serves:
+//
+//	/                 the live view page: a scrolling table of results
+//	/api/config       ports and Options.Config
+//	/api/stats        bus statistics, as metrics.Snapshot
+//	/api/results      recent results as output.Record, oldest first; ?limit=n newest only, ?filter=expr matching only
+//	/api/image        known points of the process image; ?slave=n, ?table=name of a slave, a table only
+//	/api/ws           WebSocket sending each new result as an output.Record JSON message; ?filter=expr matching only
+//
+// It is safe for concurrent use.
+type Server struct {
+	src     sniffer.Source
+	opts    Options
+	remove  func()
+	handler http.Handler
+
+	mux     sync.Mutex
+	recent  []*sniffer.Result
+	next    int
+	clients map[*client]bool
+	closed  bool
+	done    chan struct{}
+	dropped uint64
+}
+
+// New creates a server of src
+func New(src sniffer.Source, opts Options) *Server {
+	if opts.Recent <= 0 {
+		opts.Recent = RecentDefault
+	}
+	s := &Server{
+		src:     src,
+		opts:    opts,
+		recent:  make([]*sniffer.Result, 0, opts.Recent),
+		clients: make(map[*client]bool),
+		done:    make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.servePage)
+	mux.HandleFunc("/api/config", s.serveConfig)
+	mux.HandleFunc("/api/stats", s.serveStats)
+	mux.HandleFunc("/api/results", s.serveResults)
+	mux.HandleFunc("/api/image", s.serveImage)
+	mux.HandleFunc("/api/ws", s.serveWS)
+	s.handler = mux
+	s.remove = src.OnResult(s.publish)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Dropped returns the number of results dropped because a WebSocket client was too slow
+func (s *Server) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close closes WebSocket connections and stops collecting results
+func (s *Server) Close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.remove()
+		close(s.done)
+	}
+}
+
+// publish keeps r among recent results and queues it to WebSocket clients matching it
+func (s *Server) publish(r *sniffer.Result) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if len(s.recent) < cap(s.recent) {
+		s.recent = append(s.recent, r)
+	} else {
+		s.recent[s.next] = r
+		s.next = (s.next + 1) % len(s.recent)
+	}
+
+	var b []byte
+	for c := range s.clients {
+		if !c.filter.Match(r) {
+			continue
+		}
+		if b == nil {
+			var err error
+			if b, err = json.Marshal(output.NewRecord(r)); err != nil {
+				log.Print(err)
+				return
+			}
+		}
+		select {
+		case c.records <- b:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Recent returns the results kept, oldest first
+func (s *Server) Recent() []*sniffer.Result {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append(append([]*sniffer.Result(nil), s.recent[s.next:]...), s.recent[:s.next]...)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print(err)
+	}
+}
+
+// compileFilter compiles the filter parameter of r, nil if none
+func compileFilter(r *http.Request) (*filter.Filter, error) {
+	if expr := r.URL.Query().Get("filter"); expr != "" {
+		return filter.Compile(expr)
+	}
+	return nil, nil
+}
+
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(page))
+}
+
+func (s *Server) serveConfig(w http.ResponseWriter, r *http.Request) {
+	ports := []Port{}
+	configs := s.src.Ports()
+	for i, c := range configs {
+		ports = append(ports, Port{Name: c.Port, Baud: c.Baud, FrameFormat: c.FrameFormat,
+			Role: sniffer.PortRole(i, len(configs))})
+	}
+	writeJSON(w, struct {
+		Ports  []Port      `json:"ports"`
+		Config interface{} `json:"config,omitempty"`
+	}{ports, s.opts.Config})
+}
+
+func (s *Server) serveStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.src.Metrics().Snapshot())
+}
+
+func (s *Server) serveResults(w http.ResponseWriter, r *http.Request) {
+	f, err := compileFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			http.Error(w, "invalid limit "+l, http.StatusBadRequest)
+			return
+		}
+	}
+	records := []*output.Record{}
+	for _, res := range s.Recent() {
+		if f.Match(res) {
+			records = append(records, output.NewRecord(res))
+		}
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	writeJSON(w, records)
+}
+
+func (s *Server) serveImage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var slave uint64
+	if v := q.Get("slave"); v != "" {
+		var err error
+		if slave, err = strconv.ParseUint(v, 0, 8); err != nil {
+			http.Error(w, "invalid slave "+v, http.StatusBadRequest)
+			return
+		}
+	}
+	table := dissector.TableNone
+	if v := q.Get("table"); v != "" {
+		var err error
+		if table, err = dissector.ParseTable(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	points := []processimage.Point{}
+	for _, p := range s.src.ProcessImage().ChangedSince(time.Time{}) {
+		if q.Get("slave") != "" && uint64(p.Slave) != slave || table != dissector.TableNone && p.Table != table {
+			continue
+		}
+		points = append(points, p)
+	}
+	writeJSON(w, points)
+}
+
+var upgrader = websocket.Upgrader{}
+
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	f, err := compileFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader answered already
+		return
+	}
+	defer conn.Close()
+
+	c := &client{filter: f, records: make(chan []byte, ClientBufferDefault)}
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return
+	}
+	s.clients[c] = true
+	s.mux.Unlock()
+	defer func() {
+		s.mux.Lock()
+		delete(s.clients, c)
+		s.mux.Unlock()
+	}()
+
+	// messages from the client are ignored, reading handles control frames and tells when it is gone
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case b := <-c.records:
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, b); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		case <-s.done:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "sniffer closed"),
+				time.Now().Add(writeTimeout))
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreaaizza/sniffer/internal/sniffertest"
+	"github.com/andreaaizza/sniffer/metrics"
+	"github.com/andreaaizza/sniffer/output"
+	"github.com/andreaaizza/sniffer/processimage"
+
+	"github.com/gorilla/websocket"
+)
+
+func get(t *testing.T, url string, v interface{}) int {
+	rsp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode == http.StatusOK && v != nil {
+		if err := json.NewDecoder(rsp.Body).Decode(v); err != nil {
+			t.Fatalf("%s: %v", url, err)
+		}
+	}
+	return rsp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	src := sniffertest.NewSource()
+	s := New(src, Options{Config: map[string]string{"b": "9600"}, Recent: 1})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/ws?filter=exception", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	for subscribed := false; !subscribed; time.Sleep(time.Millisecond) {
+		s.mux.Lock()
+		subscribed = len(s.clients) == 1
+		s.mux.Unlock()
+	}
+	for _, r := range sniffertest.Results(t) {
+		src.Publish(r)
+	}
+
+	// live, filtered
+	var record output.Record
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := ws.ReadJSON(&record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != output.StatusException || record.FunctionCode != 4 {
+		t.Errorf("got record %+v, want the exception", record)
+	}
+	s.Close()
+	if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("got %v, want close", err)
+	}
+
+	// recent: the last one only
+	var records []output.Record
+	if code := get(t, ts.URL+"/api/results", &records); code != http.StatusOK || len(records) != 1 || records[0].FunctionCode != 4 {
+		t.Errorf("got %d %+v", code, records)
+	}
+	if code := get(t, ts.URL+"/api/results?filter=slave+%3D%3D", nil); code != http.StatusBadRequest {
+		t.Errorf("got %d for an invalid filter", code)
+	}
+
+	var points []processimage.Point
+	if code := get(t, ts.URL+"/api/image?slave=2&table=holding", &points); code != http.StatusOK || len(points) != 2 || points[1].Value != 2 {
+		t.Errorf("got %d %+v", code, points)
+	}
+
+	var config struct {
+		Ports  []Port            `json:"ports"`
+		Config map[string]string `json:"config"`
+	}
+	if code := get(t, ts.URL+"/api/config", &config); code != http.StatusOK || len(config.Ports) != 1 || config.Ports[0].Role != "txrx" || config.Config["b"] != "9600" {
+		t.Errorf("got %d %+v", code, config)
+	}
+
+	var snap metrics.Snapshot
+	if code := get(t, ts.URL+"/api/stats", &snap); code != http.StatusOK || len(snap.Ports) != 1 {
+		t.Errorf("got %d %+v", code, snap)
+	}
+
+	if code := get(t, ts.URL+"/", nil); code != http.StatusOK {
+		t.Errorf("got %d for the page", code)
+	}
+	if code := get(t, ts.URL+"/nope", nil); code != http.StatusNotFound {
+		t.Errorf("got %d for a missing page", code)
+	}
+}